@@ -0,0 +1,69 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/genosis18m/Metaverse_go/internal/database"
+	"github.com/genosis18m/Metaverse_go/internal/models"
+	"github.com/genosis18m/Metaverse_go/internal/utils"
+	"github.com/joho/godotenv"
+)
+
+// The admin command seeds an admin account, for deployments that already have
+// users when the first admin is needed:
+//
+//	go run ./cmd/admin -username alice                    # promote an existing user
+//	go run ./cmd/admin -username alice -password s3cret   # create the user if missing
+func main() {
+	username := flag.String("username", "", "username of the admin")
+	password := flag.String("password", "", "password, used when the user does not exist yet")
+	flag.Parse()
+
+	if *username == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	// Load .env file
+	if err := godotenv.Load(); err != nil {
+		log.Println("No .env file found, using environment variables")
+	}
+
+	if err := database.Connect(); err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	if err := database.AutoMigrate(); err != nil {
+		log.Fatalf("Failed to migrate database: %v", err)
+	}
+
+	var user models.User
+	if err := database.GetDB().Where("username = ?", *username).First(&user).Error; err == nil {
+		if err := database.GetDB().Model(&user).Update("role", models.RoleAdmin).Error; err != nil {
+			log.Fatalf("Failed to promote %s: %v", *username, err)
+		}
+		fmt.Printf("%s (%s) is now an admin\n", user.Username, user.ID)
+		return
+	}
+
+	if *password == "" {
+		log.Fatalf("User %s does not exist; pass -password to create it", *username)
+	}
+	hashedPassword, err := utils.HashPassword(*password)
+	if err != nil {
+		log.Fatalf("Failed to hash password: %v", err)
+	}
+
+	user = models.User{
+		ID:       utils.GenerateCUID(),
+		Username: *username,
+		Password: hashedPassword,
+		Role:     models.RoleAdmin,
+	}
+	if err := database.GetDB().Create(&user).Error; err != nil {
+		log.Fatalf("Failed to create %s: %v", *username, err)
+	}
+	fmt.Printf("Created admin %s (%s)\n", user.Username, user.ID)
+}
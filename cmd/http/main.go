@@ -6,8 +6,10 @@ import (
 	"time"
 
 	"github.com/genosis18m/Metaverse_go/internal/database"
+	"github.com/genosis18m/Metaverse_go/internal/events"
 	"github.com/genosis18m/Metaverse_go/internal/handlers"
 	"github.com/genosis18m/Metaverse_go/internal/middleware"
+	"github.com/genosis18m/Metaverse_go/internal/oidc"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
@@ -30,6 +32,19 @@ func main() {
 	}
 	log.Println("Database tables migrated successfully")
 
+	// Publish space changes to the WebSocket servers
+	bus, err := events.New(os.Getenv("EVENTS_URL"))
+	if err != nil {
+		log.Fatalf("Failed to connect to event bus: %v", err)
+	}
+	defer bus.Close()
+	events.SetBus(bus)
+
+	// Configure OpenID Connect login providers
+	if err := oidc.LoadFromEnv(); err != nil {
+		log.Fatalf("Failed to configure login providers: %v", err)
+	}
+
 	// Initialize Gin router
 	r := gin.Default()
 
@@ -50,17 +65,26 @@ func main() {
 		MaxAge:           12 * time.Hour,
 	}))
 
+	// Public keys for verifying access tokens
+	r.GET("/.well-known/jwks.json", handlers.GetJWKS)
+
 	// API v1 routes
 	v1 := r.Group("/api/v1")
 	{
 		// Public routes
 		v1.POST("/signup", handlers.Signup)
 		v1.POST("/signin", handlers.Signin)
+		v1.POST("/token/refresh", handlers.RefreshToken)
+		v1.POST("/logout", middleware.UserAuth(), handlers.Logout)
+		v1.POST("/logout/all", middleware.UserAuth(), handlers.LogoutAll)
 		v1.GET("/elements", handlers.GetElements)
 		v1.GET("/avatars", handlers.GetAvatars)
 
-		// Google OAuth routes
-		v1.GET("/auth/google", handlers.GoogleAuthURL)
+		// OpenID Connect login routes
+		v1.GET("/auth/providers", handlers.GetOIDCProviders)
+		v1.GET("/auth/oidc/:provider", handlers.OIDCLogin)
+		v1.GET("/auth/oidc/:provider/callback", handlers.OIDCCallback)
+		v1.GET("/auth/google", handlers.GoogleLogin)
 		v1.GET("/auth/google/callback", handlers.GoogleCallback)
 
 		// Health check
@@ -76,6 +100,9 @@ func main() {
 			user.GET("/metadata/bulk", handlers.GetBulkMetadata)
 			user.PUT("/username", handlers.UpdateUsername)
 			user.GET("/profile", handlers.GetProfile)
+			user.GET("/conversations", handlers.GetConversations)
+			user.GET("/conversations/:userId/messages", handlers.GetDirectMessages)
+			user.POST("/conversations/:userId/read", handlers.MarkDirectMessagesRead)
 		}
 
 		// Space routes (requires authentication)
@@ -85,11 +112,30 @@ func main() {
 			space.POST("/", handlers.CreateSpace)
 			space.DELETE("/:spaceId", handlers.DeleteSpace)
 			space.GET("/all", handlers.GetAllSpaces)
+			space.GET("/:spaceId/messages", handlers.GetMessages)
+			space.GET("/:spaceId/zones", handlers.GetZones)
+			space.POST("/:spaceId/zones", handlers.CreateZone)
+			space.PUT("/:spaceId/zones/:zoneId", handlers.UpdateZone)
+			space.DELETE("/:spaceId/zones/:zoneId", handlers.DeleteZone)
+			space.PUT("/:spaceId/settings", handlers.UpdateSpaceSettings)
+			space.PUT("/:spaceId/spawn-points", handlers.UpdateSpawnPoints)
+			space.GET("/:spaceId/portals", handlers.GetPortals)
+			space.POST("/:spaceId/portals", handlers.CreatePortal)
+			space.DELETE("/:spaceId/portals/:portalId", handlers.DeletePortal)
+			space.GET("/:spaceId/members", handlers.GetMembers)
+			space.PUT("/:spaceId/members/:userId", handlers.UpdateMemberRole)
+			space.DELETE("/:spaceId/members/:userId", handlers.RemoveMember)
+			space.GET("/:spaceId/invites", handlers.GetInvites)
+			space.POST("/:spaceId/invites", handlers.CreateInvite)
+			space.DELETE("/:spaceId/invites/:inviteId", handlers.DeleteInvite)
+			space.POST("/invites/:token/accept", handlers.AcceptInvite)
 			space.POST("/element", handlers.AddElement)
+			space.PUT("/element/:id", handlers.MoveElement)
 			space.DELETE("/element", handlers.DeleteElement)
 		}
-		// Public space route (no auth required)
-		v1.GET("/space/:spaceId", handlers.GetSpace)
+		// Public space routes (auth optional, needed for private spaces)
+		v1.GET("/space/:spaceId", middleware.OptionalAuth(), handlers.GetSpace)
+		v1.GET("/spaces", middleware.OptionalAuth(), handlers.GetPublicSpaces)
 
 		// Admin routes (requires admin role)
 		admin := v1.Group("/admin")
@@ -99,6 +145,12 @@ func main() {
 			admin.PUT("/element/:elementId", handlers.UpdateElement)
 			admin.POST("/avatar", handlers.CreateAvatar)
 			admin.POST("/map", handlers.CreateMap)
+			admin.GET("/users", handlers.ListUsers)
+			admin.GET("/users/:userId", handlers.GetUser)
+			admin.PUT("/users/:userId/role", handlers.UpdateUserRole)
+			admin.POST("/users/:userId/suspend", handlers.SuspendUser)
+			admin.POST("/users/:userId/unsuspend", handlers.UnsuspendUser)
+			admin.DELETE("/users/:userId", handlers.DeleteUser)
 		}
 	}
 
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/genosis18m/Metaverse_go/internal/database"
+	"github.com/joho/godotenv"
+)
+
+// The linkgoogle command is a one-off migration for deployments that used the
+// old Google login. It records the email of those users so their next Google
+// sign-in links to the existing account instead of creating a new one:
+//
+//	go run ./cmd/linkgoogle
+func main() {
+	// Load .env file
+	if err := godotenv.Load(); err != nil {
+		log.Println("No .env file found, using environment variables")
+	}
+
+	if err := database.Connect(); err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	if err := database.AutoMigrate(); err != nil {
+		log.Fatalf("Failed to migrate database: %v", err)
+	}
+
+	linked, err := database.LinkLegacyGoogleUsers()
+	if err != nil {
+		log.Fatalf("Failed to link Google users after %d: %v", linked, err)
+	}
+	fmt.Printf("Linked %d Google users\n", linked)
+}
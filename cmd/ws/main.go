@@ -1,11 +1,17 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/genosis18m/Metaverse_go/internal/database"
+	"github.com/genosis18m/Metaverse_go/internal/events"
 	ws "github.com/genosis18m/Metaverse_go/pkg/websocket"
 	"github.com/gorilla/websocket"
 	"github.com/joho/godotenv"
@@ -14,6 +20,8 @@ import (
 var upgrader = websocket.Upgrader{
 	ReadBufferSize:  1024,
 	WriteBufferSize: 1024,
+	// Clients pick JSON or MessagePack through Sec-WebSocket-Protocol
+	Subprotocols: ws.Subprotocols(),
 	CheckOrigin: func(r *http.Request) bool {
 		return true // Allow all origins for development
 	},
@@ -42,12 +50,31 @@ func main() {
 	if err := godotenv.Load(); err != nil {
 		log.Println("No .env file found, using environment variables")
 	}
+	ws.LoadConfig()
 
 	// Connect to database
 	if err := database.Connect(); err != nil {
 		log.Fatalf("Failed to connect to database: %v", err)
 	}
 
+	// Share rooms with other WebSocket server nodes
+	backplane, err := ws.NewBackplane(os.Getenv("BACKPLANE_URL"))
+	if err != nil {
+		log.Fatalf("Failed to connect to backplane: %v", err)
+	}
+	defer backplane.Close()
+	ws.GetRoomManager().SetBackplane(backplane)
+
+	// Push changes made through the HTTP API to the rooms
+	bus, err := events.New(os.Getenv("EVENTS_URL"))
+	if err != nil {
+		log.Fatalf("Failed to connect to event bus: %v", err)
+	}
+	defer bus.Close()
+	if _, err := bus.Subscribe(ws.GetRoomManager().HandleEvent); err != nil {
+		log.Fatalf("Failed to subscribe to event bus: %v", err)
+	}
+
 	// Get port from environment (Railway uses PORT)
 	port := os.Getenv("PORT")
 	if port == "" {
@@ -63,8 +90,25 @@ func main() {
 	})
 	http.HandleFunc("/", handleWebSocket)
 
+	// Stop accepting connections on SIGINT or SIGTERM, then return from main
+	// so the deferred closes run
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	server := &http.Server{Addr: ":" + port}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := server.Shutdown(shutdownCtx); err != nil {
+			log.Printf("Error shutting down server: %v", err)
+		}
+	}()
+
 	log.Printf("WebSocket Server starting on port %s", port)
-	if err := http.ListenAndServe(":"+port, nil); err != nil {
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
 		log.Fatalf("Failed to start server: %v", err)
 	}
+
+	// Save where connected users stand before exiting
+	ws.FlushPositions()
 }
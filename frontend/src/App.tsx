@@ -1,9 +1,10 @@
-import { useState } from 'react'
+import { useEffect, useState } from 'react'
 import { BrowserRouter as Router, Routes, Route, Navigate } from 'react-router-dom'
 import Landing from './pages/Landing'
 import Dashboard from './pages/Dashboard'
 import Arena from './pages/Arena'
 import OAuthCallback from './pages/OAuthCallback'
+import { SESSION_ENDED_EVENT, clearTokens, storeTokens } from './auth'
 import './index.css'
 
 function App() {
@@ -11,8 +12,8 @@ function App() {
   const [userId, setUserId] = useState<string | null>(localStorage.getItem('userId'))
   const [username, setUsername] = useState<string | null>(localStorage.getItem('username'))
 
-  const handleLogin = (newToken: string, newUserId: string, newUsername?: string) => {
-    localStorage.setItem('token', newToken)
+  const handleLogin = (newToken: string, newUserId: string, newUsername?: string, newRefreshToken?: string) => {
+    storeTokens(newToken, newRefreshToken)
     localStorage.setItem('userId', newUserId)
     if (newUsername) localStorage.setItem('username', newUsername)
     setToken(newToken)
@@ -21,7 +22,7 @@ function App() {
   }
 
   const handleLogout = () => {
-    localStorage.removeItem('token')
+    clearTokens()
     localStorage.removeItem('userId')
     localStorage.removeItem('username')
     setToken(null)
@@ -29,6 +30,12 @@ function App() {
     setUsername(null)
   }
 
+  // Sign out when the session can no longer be refreshed
+  useEffect(() => {
+    window.addEventListener(SESSION_ENDED_EVENT, handleLogout)
+    return () => window.removeEventListener(SESSION_ENDED_EVENT, handleLogout)
+  }, [])
+
   return (
     <Router>
       <Routes>
@@ -45,13 +52,13 @@ function App() {
         <Route 
           path="/dashboard" 
           element={
-            token ? <Dashboard token={token} onLogout={handleLogout} /> : <Navigate to="/" />
+            token ? <Dashboard onLogout={handleLogout} /> : <Navigate to="/" />
           } 
         />
         <Route 
           path="/arena/:spaceId" 
           element={
-            token ? <Arena token={token} userId={userId || ''} username={username || ''} /> : <Navigate to="/" />
+            token ? <Arena userId={userId || ''} username={username || ''} /> : <Navigate to="/" />
           } 
         />
       </Routes>
@@ -0,0 +1,86 @@
+const API_URL = import.meta.env.VITE_API_URL || 'http://localhost:3000'
+
+// Fired on window when the session ended and the user has to sign in again
+export const SESSION_ENDED_EVENT = 'session-ended'
+
+export function storeTokens(token: string, refreshToken?: string) {
+  localStorage.setItem('token', token)
+  if (refreshToken) localStorage.setItem('refreshToken', refreshToken)
+}
+
+export function clearTokens() {
+  localStorage.removeItem('token')
+  localStorage.removeItem('refreshToken')
+}
+
+// Refresh tokens work once, so concurrent callers share one refresh
+let refreshing: Promise<string | null> | null = null
+
+// refreshSession exchanges the refresh token for new tokens. It returns the
+// new access token, or null after ending the session when that fails.
+export function refreshSession(): Promise<string | null> {
+  if (!refreshing) {
+    refreshing = doRefresh().finally(() => {
+      refreshing = null
+    })
+  }
+  return refreshing
+}
+
+async function doRefresh(): Promise<string | null> {
+  const refreshToken = localStorage.getItem('refreshToken')
+  if (refreshToken) {
+    try {
+      const res = await fetch(`${API_URL}/api/v1/token/refresh`, {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({ refreshToken })
+      })
+      if (res.ok) {
+        const data = await res.json()
+        storeTokens(data.token, data.refreshToken)
+        return data.token
+      }
+      // Server errors keep the session so a later call can retry
+      if (res.status >= 500) return null
+    } catch (err) {
+      console.error('Failed to refresh session:', err)
+      return null
+    }
+  }
+
+  clearTokens()
+  window.dispatchEvent(new Event(SESSION_ENDED_EVENT))
+  return null
+}
+
+// freshToken returns an access token that is valid for at least another
+// 30 seconds, refreshing it first when needed
+export async function freshToken(): Promise<string | null> {
+  const token = localStorage.getItem('token')
+  if (token) {
+    try {
+      const payload = JSON.parse(atob(token.split('.')[1]))
+      if (!payload.exp || payload.exp * 1000 > Date.now() + 30_000) return token
+    } catch {
+      // Not a readable JWT, let the refresh decide
+    }
+  }
+  return refreshSession()
+}
+
+// authFetch calls the API with the access token. A 401 refreshes the
+// session and retries the request once.
+export async function authFetch(url: string, init: RequestInit = {}): Promise<Response> {
+  const send = (token: string | null) => {
+    const headers = new Headers(init.headers)
+    if (token) headers.set('Authorization', `Bearer ${token}`)
+    return fetch(url, { ...init, headers })
+  }
+
+  const res = await send(localStorage.getItem('token'))
+  if (res.status !== 401) return res
+
+  const token = await refreshSession()
+  return token ? send(token) : res
+}
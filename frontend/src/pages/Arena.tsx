@@ -1,6 +1,7 @@
 import { useEffect, useRef, useState } from 'react'
 import { useParams, useNavigate, useLocation } from 'react-router-dom'
 import '../index.css'
+import { freshToken } from '../auth'
 
 let WS_URL = import.meta.env.VITE_WS_URL || 'ws://localhost:3001'
 if (WS_URL.startsWith('http://')) {
@@ -24,12 +25,11 @@ interface ChatMessage {
 }
 
 interface ArenaProps {
-  token: string
   userId: string
   username: string
 }
 
-export default function Arena({ token, userId, username }: ArenaProps) {
+export default function Arena({ userId, username }: ArenaProps) {
   const { spaceId } = useParams<{ spaceId: string }>()
   const navigate = useNavigate()
   const location = useLocation()
@@ -48,12 +48,15 @@ export default function Arena({ token, userId, username }: ArenaProps) {
   const [copied, setCopied] = useState(false)
 
   useEffect(() => {
-    if (!spaceId || !token) return
+    if (!spaceId) return
 
     wsRef.current = new WebSocket(WS_URL)
     
-    wsRef.current.onopen = () => {
+    wsRef.current.onopen = async () => {
       setConnected(true)
+      // Join with an access token that has not expired yet
+      const token = await freshToken()
+      if (!token) return
       wsRef.current?.send(JSON.stringify({
         type: 'join',
         payload: { spaceId, token, displayName }
@@ -72,7 +75,7 @@ export default function Arena({ token, userId, username }: ArenaProps) {
     return () => {
       wsRef.current?.close()
     }
-  }, [spaceId, token])
+  }, [spaceId])
 
   const handleMessage = (msg: { type: string; payload: any }) => {
     switch (msg.type) {
@@ -3,6 +3,7 @@ import { useNavigate } from 'react-router-dom'
 import '../index.css'
 import Loader from '../components/Loader'
 import RoomEntryModal from '../components/RoomEntryModal'
+import { authFetch } from '../auth'
 
 const API_URL = import.meta.env.VITE_API_URL || 'http://localhost:3000'
 
@@ -14,11 +15,10 @@ interface Space {
 }
 
 interface DashboardProps {
-  token: string
   onLogout: () => void
 }
 
-export default function Dashboard({ token, onLogout }: DashboardProps) {
+export default function Dashboard({ onLogout }: DashboardProps) {
   const navigate = useNavigate()
   const [spaces, setSpaces] = useState<Space[]>([])
   const [showCreateModal, setShowCreateModal] = useState(false)
@@ -51,9 +51,7 @@ export default function Dashboard({ token, onLogout }: DashboardProps) {
 
   const fetchProfile = async () => {
     try {
-      const res = await fetch(`${API_URL}/api/v1/user/profile`, {
-        headers: { 'Authorization': `Bearer ${token}` }
-      })
+      const res = await authFetch(`${API_URL}/api/v1/user/profile`)
       const data = await res.json()
       if (res.ok && data.username) {
         setCurrentUsername(data.username)
@@ -65,9 +63,7 @@ export default function Dashboard({ token, onLogout }: DashboardProps) {
 
   const fetchSpaces = async () => {
     try {
-      const res = await fetch(`${API_URL}/api/v1/space/all`, {
-        headers: { 'Authorization': `Bearer ${token}` }
-      })
+      const res = await authFetch(`${API_URL}/api/v1/space/all`)
       const data = await res.json()
       setSpaces(data.spaces || [])
     } catch (err) {
@@ -83,12 +79,9 @@ export default function Dashboard({ token, onLogout }: DashboardProps) {
     setSuccessMsg('')
     
     try {
-      const res = await fetch(`${API_URL}/api/v1/user/username`, {
+      const res = await authFetch(`${API_URL}/api/v1/user/username`, {
         method: 'PUT',
-        headers: {
-          'Content-Type': 'application/json',
-          'Authorization': `Bearer ${token}`
-        },
+        headers: { 'Content-Type': 'application/json' },
         body: JSON.stringify({ username: newUsername })
       })
       const data = await res.json()
@@ -108,12 +101,9 @@ export default function Dashboard({ token, onLogout }: DashboardProps) {
     setIsSubmitting(true)
     
     try {
-      const res = await fetch(`${API_URL}/api/v1/space/`, {
+      const res = await authFetch(`${API_URL}/api/v1/space/`, {
         method: 'POST',
-        headers: {
-          'Content-Type': 'application/json',
-          'Authorization': `Bearer ${token}`
-        },
+        headers: { 'Content-Type': 'application/json' },
         body: JSON.stringify({
           name: newRoomName,
           dimensions: roomSize
@@ -158,9 +148,7 @@ export default function Dashboard({ token, onLogout }: DashboardProps) {
     
     // Validate room exists
     try {
-      const res = await fetch(`${API_URL}/api/v1/space/${joinRoomId}`, {
-        headers: { 'Authorization': `Bearer ${token}` }
-      })
+      const res = await authFetch(`${API_URL}/api/v1/space/${joinRoomId}`)
       if (!res.ok) {
         setJoinError('Room not found. Please check the ID.')
         return
@@ -181,9 +169,8 @@ export default function Dashboard({ token, onLogout }: DashboardProps) {
     if (!confirm('Are you sure you want to delete this room?')) return
     
     try {
-      await fetch(`${API_URL}/api/v1/space/${spaceId}`, {
-        method: 'DELETE',
-        headers: { 'Authorization': `Bearer ${token}` }
+      await authFetch(`${API_URL}/api/v1/space/${spaceId}`, {
+        method: 'DELETE'
       })
       fetchSpaces()
     } catch (err) {
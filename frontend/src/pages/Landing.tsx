@@ -4,7 +4,7 @@ import '../index.css'
 const API_URL = import.meta.env.VITE_API_URL || 'http://localhost:3000'
 
 interface LandingProps {
-  onLogin: (token: string, userId: string, username?: string) => void
+  onLogin: (token: string, userId: string, username?: string, refreshToken?: string) => void
 }
 
 export default function Landing({ onLogin }: LandingProps) {
@@ -32,7 +32,7 @@ export default function Landing({ onLogin }: LandingProps) {
         
         // Decode token to get userId
         const payload = JSON.parse(atob(data.token.split('.')[1]))
-        onLogin(data.token, payload.userId, username)
+        onLogin(data.token, payload.userId, username, data.refreshToken)
       } else {
         // Sign up
         const res = await fetch(`${API_URL}/api/v1/signup`, {
@@ -53,7 +53,7 @@ export default function Landing({ onLogin }: LandingProps) {
         if (!loginRes.ok) throw new Error(loginData.message || 'Auto-login failed')
         
         const payload = JSON.parse(atob(loginData.token.split('.')[1]))
-        onLogin(loginData.token, payload.userId, username)
+        onLogin(loginData.token, payload.userId, username, loginData.refreshToken)
       }
     } catch (err: any) {
       setError(err.message)
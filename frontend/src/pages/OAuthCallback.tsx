@@ -1,31 +1,30 @@
-import { useEffect } from 'react'
-import { useNavigate, useSearchParams } from 'react-router-dom'
+import { useEffect, useState } from 'react'
+import { useNavigate } from 'react-router-dom'
 
 interface OAuthCallbackProps {
-  onLogin: (token: string, userId: string) => void
+  onLogin: (token: string, userId: string, username?: string, refreshToken?: string) => void
 }
 
 export default function OAuthCallback({ onLogin }: OAuthCallbackProps) {
   const navigate = useNavigate()
-  const [searchParams] = useSearchParams()
+  // The tokens come in the fragment so they never reach a server
+  const [params] = useState(() => new URLSearchParams(window.location.hash.slice(1)))
 
   useEffect(() => {
-    const token = searchParams.get('token')
-    const userId = searchParams.get('userId')
-    const error = searchParams.get('error')
+    // Drop the tokens from the address bar and history once read
+    window.history.replaceState(null, '', window.location.pathname + window.location.search)
 
-    if (error) {
-      navigate('/?error=' + error)
-      return
-    }
+    const token = params.get('token')
+    const refreshToken = params.get('refreshToken')
+    const userId = params.get('userId')
 
     if (token && userId) {
-      onLogin(token, userId)
-      navigate('/dashboard')
+      onLogin(token, userId, undefined, refreshToken ?? undefined)
+      navigate('/dashboard', { replace: true })
     } else {
-      navigate('/?error=oauth_failed')
+      navigate('/?error=oauth_failed', { replace: true })
     }
-  }, [searchParams, onLogin, navigate])
+  }, [params, onLogin, navigate])
 
   return (
     <div style={{
@@ -0,0 +1,50 @@
+package database
+
+import (
+	"time"
+
+	"github.com/genosis18m/Metaverse_go/internal/models"
+)
+
+// SpaceRole returns the role of a user in a space. The creator of a space is
+// its owner.
+func SpaceRole(space models.Space, userID string) (models.SpaceRole, bool) {
+	if userID == "" {
+		return "", false
+	}
+	if space.CreatorID == userID {
+		return models.SpaceRoleOwner, true
+	}
+
+	var member models.SpaceMember
+	if err := DB.First(&member, "space_id = ? AND user_id = ?", space.ID, userID).Error; err != nil {
+		return "", false
+	}
+	return member.Role, true
+}
+
+// HasSpaceRole reports whether a user has at least the given role in a space
+func HasSpaceRole(space models.Space, userID string, role models.SpaceRole) bool {
+	current, ok := SpaceRole(space, userID)
+	return ok && current.AtLeast(role)
+}
+
+// CanAccessSpace reports whether a user may view and join a space. Public and
+// unlisted spaces are open to everyone, private ones only to their members.
+// An empty userID stands for an anonymous visitor.
+func CanAccessSpace(space models.Space, userID string) bool {
+	if space.Visibility != models.SpaceVisibilityPrivate {
+		return true
+	}
+	_, ok := SpaceRole(space, userID)
+	return ok
+}
+
+// IsKicked reports whether a user was kicked from a space and may not rejoin yet
+func IsKicked(spaceID, userID string) (bool, error) {
+	var count int64
+	err := DB.Model(&models.SpaceKick{}).
+		Where("space_id = ? AND user_id = ? AND until > ?", spaceID, userID, time.Now()).
+		Count(&count).Error
+	return count > 0, err
+}
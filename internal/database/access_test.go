@@ -0,0 +1,99 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/genosis18m/Metaverse_go/internal/models"
+)
+
+// addTestMember gives a user a role in a space
+func addTestMember(t *testing.T, spaceID, userID string, role models.SpaceRole) {
+	t.Helper()
+	member := models.SpaceMember{SpaceID: spaceID, UserID: userID, Role: role, CreatedAt: time.Now()}
+	if err := DB.Create(&member).Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSpaceRole(t *testing.T) {
+	withTestDB(t)
+	creator, editor, stranger := createTestUser(t), createTestUser(t), createTestUser(t)
+	space := createTestSpace(t, creator.ID)
+	addTestMember(t, space.ID, editor.ID, models.SpaceRoleEditor)
+
+	cases := []struct {
+		name   string
+		userID string
+		role   models.SpaceRole
+		member bool
+	}{
+		{"creator", creator.ID, models.SpaceRoleOwner, true},
+		{"editor", editor.ID, models.SpaceRoleEditor, true},
+		{"stranger", stranger.ID, "", false},
+		{"anonymous", "", "", false},
+	}
+	for _, c := range cases {
+		role, member := SpaceRole(space, c.userID)
+		if role != c.role || member != c.member {
+			t.Errorf("%s: role %q member %t, want %q %t", c.name, role, member, c.role, c.member)
+		}
+	}
+
+	if !HasSpaceRole(space, editor.ID, models.SpaceRoleMember) || HasSpaceRole(space, editor.ID, models.SpaceRoleOwner) {
+		t.Error("an editor should rank above members and below owners")
+	}
+	if !HasSpaceRole(space, creator.ID, models.SpaceRoleOwner) {
+		t.Error("the creator does not own the space")
+	}
+	if HasSpaceRole(space, stranger.ID, models.SpaceRoleGuest) {
+		t.Error("a stranger has a role in the space")
+	}
+}
+
+func TestCanAccessSpace(t *testing.T) {
+	withTestDB(t)
+	creator, guest, stranger := createTestUser(t), createTestUser(t), createTestUser(t)
+	space := createTestSpace(t, creator.ID)
+	addTestMember(t, space.ID, guest.ID, models.SpaceRoleGuest)
+
+	for _, visibility := range []models.SpaceVisibility{models.SpaceVisibilityPublic, models.SpaceVisibilityUnlisted, models.SpaceVisibilityPrivate} {
+		space.Visibility = visibility
+		private := visibility == models.SpaceVisibilityPrivate
+		for _, c := range []struct {
+			name   string
+			userID string
+			want   bool
+		}{
+			{"creator", creator.ID, true},
+			{"guest", guest.ID, true},
+			{"stranger", stranger.ID, !private},
+			{"anonymous", "", !private},
+		} {
+			if got := CanAccessSpace(space, c.userID); got != c.want {
+				t.Errorf("%s space, %s: access %t, want %t", visibility, c.name, got, c.want)
+			}
+		}
+	}
+}
+
+func TestIsKickedUntilExpiry(t *testing.T) {
+	withTestDB(t)
+	creator, user := createTestUser(t), createTestUser(t)
+	space := createTestSpace(t, creator.ID)
+
+	kick := models.SpaceKick{SpaceID: space.ID, UserID: user.ID, KickedByID: creator.ID, Until: time.Now().Add(time.Hour)}
+	if err := DB.Create(&kick).Error; err != nil {
+		t.Fatal(err)
+	}
+	if kicked, err := IsKicked(space.ID, user.ID); err != nil || !kicked {
+		t.Fatalf("kicked = %t (err %v), want true", kicked, err)
+	}
+
+	if err := DB.Model(&kick).Update("until", time.Now().Add(-time.Second)).Error; err != nil {
+		t.Fatal(err)
+	}
+	if kicked, err := IsKicked(space.ID, user.ID); err != nil || kicked {
+		t.Fatalf("kicked = %t (err %v) after the kick expired", kicked, err)
+	}
+}
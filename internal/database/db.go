@@ -35,16 +35,35 @@ func Connect() error {
 // Note: Since we're using existing Prisma schema, we typically don't need this
 // But it's useful for development
 func AutoMigrate() error {
-	return DB.AutoMigrate(
+	err := DB.AutoMigrate(
 		&models.User{},
+		&models.UserIdentity{},
+		&models.UserSession{},
+		&models.RefreshToken{},
+		&models.RevokedToken{},
 		&models.Avatar{},
 		&models.Space{},
 		&models.SpaceElement{},
+		&models.SpaceMute{},
+		&models.SpaceKick{},
+		&models.SpaceZone{},
+		&models.SpacePortal{},
+		&models.UserSpacePosition{},
+		&models.SpaceMember{},
+		&models.SpaceInvite{},
 		&models.Element{},
 		&models.Map{},
 		&models.MapElement{},
 		&models.Message{},
+		&models.MessageRecipient{},
+		&models.DirectMessage{},
 	)
+	if err != nil {
+		return err
+	}
+
+	// Full-text index for chat history search
+	return DB.Exec("CREATE INDEX IF NOT EXISTS idx_messages_text_search ON messages USING GIN (to_tsvector('simple', text))").Error
 }
 
 // GetDB returns the database instance
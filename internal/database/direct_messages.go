@@ -0,0 +1,162 @@
+package database
+
+import (
+	"sort"
+	"time"
+
+	"github.com/genosis18m/Metaverse_go/internal/models"
+)
+
+// Conversation summarises the direct messages a user exchanged with one peer
+type Conversation struct {
+	Peer        models.User
+	LastMessage models.DirectMessage
+	Unread      int64
+}
+
+// ListDirectMessages returns a page of the direct messages between two users,
+// oldest first, and whether more messages exist beyond the page in the paging
+// direction. Search is ignored.
+func ListDirectMessages(userID, peerID string, q MessageQuery) ([]models.DirectMessage, bool, error) {
+	limit := q.Limit
+	if limit <= 0 {
+		limit = DefaultMessageLimit
+	}
+	if limit > MaxMessageLimit {
+		limit = MaxMessageLimit
+	}
+
+	pair := "((sender_id = ? AND recipient_id = ?) OR (sender_id = ? AND recipient_id = ?))"
+	query := DB.Where(pair, userID, peerID, peerID, userID)
+
+	ascending := false
+	cursorID := q.Before
+	if q.After != "" {
+		ascending = true
+		cursorID = q.After
+	}
+	if cursorID != "" {
+		var cursor models.DirectMessage
+		if err := DB.Where(pair, userID, peerID, peerID, userID).First(&cursor, "id = ?", cursorID).Error; err != nil {
+			return nil, false, ErrCursorNotFound
+		}
+		if ascending {
+			query = query.Where("(created_at, id) > (?, ?)", cursor.CreatedAt, cursor.ID)
+		} else {
+			query = query.Where("(created_at, id) < (?, ?)", cursor.CreatedAt, cursor.ID)
+		}
+	}
+	if ascending {
+		query = query.Order("created_at asc, id asc")
+	} else {
+		query = query.Order("created_at desc, id desc")
+	}
+
+	// Fetch one extra row to know whether another page exists
+	var messages []models.DirectMessage
+	if err := query.Limit(limit + 1).Find(&messages).Error; err != nil {
+		return nil, false, err
+	}
+	hasMore := len(messages) > limit
+	if hasMore {
+		messages = messages[:limit]
+	}
+
+	if !ascending {
+		for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+			messages[i], messages[j] = messages[j], messages[i]
+		}
+	}
+	return messages, hasMore, nil
+}
+
+// MarkDirectMessagesRead marks the unread messages senderID sent to readerID,
+// up to and including the message upToID, as read. It returns the read time
+// and how many messages were marked.
+func MarkDirectMessagesRead(readerID, senderID, upToID string) (time.Time, int64, error) {
+	var upTo models.DirectMessage
+	if err := DB.First(&upTo, "id = ? AND sender_id = ? AND recipient_id = ?", upToID, senderID, readerID).Error; err != nil {
+		return time.Time{}, 0, ErrCursorNotFound
+	}
+
+	readAt := time.Now()
+	result := DB.Model(&models.DirectMessage{}).
+		Where("sender_id = ? AND recipient_id = ? AND read_at IS NULL", senderID, readerID).
+		Where("(created_at, id) <= (?, ?)", upTo.CreatedAt, upTo.ID).
+		Update("read_at", readAt)
+	return readAt, result.RowsAffected, result.Error
+}
+
+// ListConversations returns the conversations of a user, most recent first
+func ListConversations(userID string) ([]Conversation, error) {
+	// Latest message per peer
+	var latest []models.DirectMessage
+	err := DB.Raw(`SELECT DISTINCT ON (peer_id) m.*
+		FROM (SELECT *, CASE WHEN sender_id = ? THEN recipient_id ELSE sender_id END AS peer_id
+			FROM "directMessages" WHERE sender_id = ? OR recipient_id = ?) m
+		ORDER BY peer_id, created_at DESC, id DESC`, userID, userID, userID).
+		Scan(&latest).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(latest) == 0 {
+		return []Conversation{}, nil
+	}
+
+	// Unread counts per sender
+	var counts []struct {
+		SenderID string
+		Unread   int64
+	}
+	err = DB.Model(&models.DirectMessage{}).
+		Select("sender_id, COUNT(*) AS unread").
+		Where("recipient_id = ? AND read_at IS NULL", userID).
+		Group("sender_id").
+		Scan(&counts).Error
+	if err != nil {
+		return nil, err
+	}
+	unread := make(map[string]int64, len(counts))
+	for _, count := range counts {
+		unread[count.SenderID] = count.Unread
+	}
+
+	peerIDs := make([]string, len(latest))
+	for i, msg := range latest {
+		peerIDs[i] = peerOf(msg, userID)
+	}
+	var peers []models.User
+	if err := DB.Where("id IN ?", peerIDs).Find(&peers).Error; err != nil {
+		return nil, err
+	}
+	byID := make(map[string]models.User, len(peers))
+	for _, peer := range peers {
+		byID[peer.ID] = peer
+	}
+
+	conversations := make([]Conversation, 0, len(latest))
+	for _, msg := range latest {
+		peerID := peerOf(msg, userID)
+		peer, exists := byID[peerID]
+		if !exists {
+			peer = models.User{ID: peerID}
+		}
+		conversations = append(conversations, Conversation{
+			Peer:        peer,
+			LastMessage: msg,
+			Unread:      unread[peerID],
+		})
+	}
+	sort.Slice(conversations, func(i, j int) bool {
+		return conversations[i].LastMessage.CreatedAt.After(conversations[j].LastMessage.CreatedAt)
+	})
+	return conversations, nil
+}
+
+// peerOf returns the other participant of a direct message
+func peerOf(msg models.DirectMessage, userID string) string {
+	if msg.SenderID == userID {
+		return msg.RecipientID
+	}
+	return msg.SenderID
+}
@@ -0,0 +1,139 @@
+package database
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/genosis18m/Metaverse_go/internal/models"
+	"github.com/genosis18m/Metaverse_go/internal/utils"
+)
+
+// createTestDirectMessage stores a direct message sent at a given time
+func createTestDirectMessage(t *testing.T, senderID, recipientID string, at time.Time) models.DirectMessage {
+	t.Helper()
+	msg := models.DirectMessage{ID: utils.GenerateCUID(), Text: "hi", SenderID: senderID, RecipientID: recipientID, CreatedAt: at}
+	if err := DB.Create(&msg).Error; err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
+
+// unreadFrom counts the messages from sender that recipient has not read
+func unreadFrom(t *testing.T, senderID, recipientID string) int64 {
+	t.Helper()
+	var count int64
+	err := DB.Model(&models.DirectMessage{}).
+		Where("sender_id = ? AND recipient_id = ? AND read_at IS NULL", senderID, recipientID).
+		Count(&count).Error
+	if err != nil {
+		t.Fatal(err)
+	}
+	return count
+}
+
+func TestMarkDirectMessagesReadUpToCursor(t *testing.T) {
+	withTestDB(t)
+	alice := createTestUser(t)
+	bob := createTestUser(t)
+
+	start := time.Now().Add(-time.Hour)
+	msgs := make([]models.DirectMessage, 0, 4)
+	for i := 0; i < 4; i++ {
+		msgs = append(msgs, createTestDirectMessage(t, alice.ID, bob.ID, start.Add(time.Duration(i)*time.Second)))
+	}
+	createTestDirectMessage(t, bob.ID, alice.ID, start.Add(time.Second))
+
+	readAt, marked, err := MarkDirectMessagesRead(bob.ID, alice.ID, msgs[2].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if marked != 3 || readAt.IsZero() {
+		t.Fatalf("marked %d at %v, want 3", marked, readAt)
+	}
+	if got := unreadFrom(t, alice.ID, bob.ID); got != 1 {
+		t.Fatalf("%d messages from alice are unread, want only the newest", got)
+	}
+	if got := unreadFrom(t, bob.ID, alice.ID); got != 1 {
+		t.Fatal("reading alice's messages also marked bob's reply read")
+	}
+
+	// Marking again only touches messages that are still unread
+	if _, marked, err := MarkDirectMessagesRead(bob.ID, alice.ID, msgs[3].ID); err != nil || marked != 1 {
+		t.Fatalf("second read marked %d (err %v), want 1", marked, err)
+	}
+	if _, marked, err := MarkDirectMessagesRead(bob.ID, alice.ID, msgs[3].ID); err != nil || marked != 0 {
+		t.Fatalf("repeated read marked %d (err %v), want 0", marked, err)
+	}
+
+	var first models.DirectMessage
+	if err := DB.First(&first, "id = ?", msgs[0].ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if first.ReadAt == nil || first.ReadAt.Sub(readAt).Abs() > time.Millisecond {
+		t.Fatalf("read time of the first message = %v, want the first receipt at %v", first.ReadAt, readAt)
+	}
+}
+
+func TestMarkDirectMessagesReadChecksParticipants(t *testing.T) {
+	withTestDB(t)
+	alice := createTestUser(t)
+	bob := createTestUser(t)
+	carol := createTestUser(t)
+	msg := createTestDirectMessage(t, alice.ID, bob.ID, time.Now())
+
+	// Neither a third user, the sender itself nor a wrong sender can mark it
+	for _, c := range []struct{ reader, sender string }{
+		{carol.ID, alice.ID},
+		{alice.ID, bob.ID},
+		{bob.ID, carol.ID},
+	} {
+		if _, _, err := MarkDirectMessagesRead(c.reader, c.sender, msg.ID); !errors.Is(err, ErrCursorNotFound) {
+			t.Fatalf("reader %s, sender %s: err = %v, want ErrCursorNotFound", c.reader, c.sender, err)
+		}
+	}
+	if got := unreadFrom(t, alice.ID, bob.ID); got != 1 {
+		t.Fatal("a rejected receipt marked the message read")
+	}
+}
+
+func TestListConversationsCountsUnread(t *testing.T) {
+	withTestDB(t)
+	alice := createTestUser(t)
+	bob := createTestUser(t)
+	carol := createTestUser(t)
+
+	start := time.Now().Add(-time.Hour)
+	fromBob := createTestDirectMessage(t, bob.ID, alice.ID, start)
+	createTestDirectMessage(t, bob.ID, alice.ID, start.Add(time.Second))
+	createTestDirectMessage(t, alice.ID, carol.ID, start.Add(2*time.Second))
+	latest := createTestDirectMessage(t, carol.ID, alice.ID, start.Add(3*time.Second))
+
+	if _, _, err := MarkDirectMessagesRead(alice.ID, bob.ID, fromBob.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	conversations, err := ListConversations(alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(conversations) != 2 {
+		t.Fatalf("got %d conversations, want 2", len(conversations))
+	}
+	withCarol, withBob := conversations[0], conversations[1]
+	if withCarol.Peer.ID != carol.ID || withCarol.LastMessage.ID != latest.ID || withCarol.Unread != 1 {
+		t.Fatalf("first conversation = peer %s, last %s, unread %d", withCarol.Peer.ID, withCarol.LastMessage.ID, withCarol.Unread)
+	}
+	if withBob.Peer.Username != bob.Username || withBob.Unread != 1 {
+		t.Fatalf("conversation with bob = peer %q, unread %d", withBob.Peer.Username, withBob.Unread)
+	}
+
+	// Messages alice sent are never unread for her
+	conversations, err = ListConversations(bob.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(conversations) != 1 || conversations[0].Unread != 0 {
+		t.Fatalf("bob's conversations = %+v, want one with nothing unread", conversations)
+	}
+}
@@ -0,0 +1,176 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/genosis18m/Metaverse_go/internal/models"
+	"github.com/genosis18m/Metaverse_go/internal/utils"
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+)
+
+const (
+	// legacyGoogleProvider is the provider of the users created by the old
+	// Google login, before identities were stored
+	legacyGoogleProvider = "google"
+	// legacySubjectPrefix marks identities created by LinkLegacyGoogleUsers,
+	// whose subject is not known until the user signs in again
+	legacySubjectPrefix = "legacy:"
+)
+
+// UserForIdentity returns the user linked to an external identity, creating
+// one on the first sign-in. Accounts are never matched by the current email
+// or username, which users can change; a user of the old Google login is
+// only found through the email recorded by LinkLegacyGoogleUsers. New users
+// get the first free variant of username.
+func UserForIdentity(identity models.UserIdentity, username string) (models.User, error) {
+	var user models.User
+	now := time.Now()
+
+	var linked models.UserIdentity
+	err := DB.Where("provider = ? AND subject = ?", identity.Provider, identity.Subject).First(&linked).Error
+	if err == nil {
+		DB.Model(&linked).Updates(map[string]interface{}{
+			"email":          identity.Email,
+			"email_verified": identity.EmailVerified,
+			"last_login_at":  now,
+		})
+		err = DB.First(&user, "id = ?", linked.UserID).Error
+		return user, err
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return user, err
+	}
+
+	if user, err = claimLegacyIdentity(identity, now); err == nil {
+		return user, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return user, err
+	}
+
+	// The user and the identity are created together, so a failure leaves
+	// no user that nothing can sign in to
+	err = DB.Transaction(func(tx *gorm.DB) error {
+		created, err := createIdentityUser(tx, username)
+		if err != nil {
+			return err
+		}
+		user = created
+
+		identity.ID = utils.GenerateCUID()
+		identity.UserID = user.ID
+		identity.CreatedAt = now
+		identity.LastLoginAt = now
+		return tx.Create(&identity).Error
+	})
+	if isUniqueViolation(err) {
+		// A concurrent first sign-in with the same identity created the user
+		if DB.Where("provider = ? AND subject = ?", identity.Provider, identity.Subject).First(&linked).Error == nil {
+			user = models.User{}
+			err = DB.First(&user, "id = ?", linked.UserID).Error
+		}
+	}
+	return user, err
+}
+
+// isUniqueViolation reports whether an error is a Postgres unique constraint violation
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
+
+// claimLegacyIdentity links a Google sign-in with a verified email to the
+// placeholder identity of a user of the old Google login. It returns
+// gorm.ErrRecordNotFound when there is none.
+func claimLegacyIdentity(identity models.UserIdentity, now time.Time) (models.User, error) {
+	var user models.User
+	if identity.Provider != legacyGoogleProvider || !identity.EmailVerified || identity.Email == "" {
+		return user, gorm.ErrRecordNotFound
+	}
+
+	var legacy models.UserIdentity
+	err := DB.Where("provider = ? AND subject LIKE ? AND email = ?", legacyGoogleProvider, legacySubjectPrefix+"%", identity.Email).
+		First(&legacy).Error
+	if err != nil {
+		return user, err
+	}
+
+	// Only one sign-in can claim the placeholder
+	result := DB.Model(&models.UserIdentity{}).Where("id = ? AND subject = ?", legacy.ID, legacy.Subject).Updates(map[string]interface{}{
+		"subject":        identity.Subject,
+		"email_verified": true,
+		"last_login_at":  now,
+	})
+	if result.Error != nil {
+		return user, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return user, gorm.ErrRecordNotFound
+	}
+	err = DB.First(&user, "id = ?", legacy.UserID).Error
+	return user, err
+}
+
+// LinkLegacyGoogleUsers records the email of every user created by the old
+// Google login, whose username is that email and who has no password or
+// identity, so the next Google sign-in with that verified email links to the
+// user. It returns the number of users linked and can be run again.
+func LinkLegacyGoogleUsers() (int, error) {
+	var users []models.User
+	linked := DB.Model(&models.UserIdentity{}).Select("user_id")
+	err := DB.Where("password = '' AND username LIKE ? AND id NOT IN (?)", "%@%", linked).Find(&users).Error
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	for i, user := range users {
+		identity := models.UserIdentity{
+			ID:          utils.GenerateCUID(),
+			UserID:      user.ID,
+			Provider:    legacyGoogleProvider,
+			Subject:     legacySubjectPrefix + user.ID,
+			Email:       user.Username,
+			CreatedAt:   now,
+			LastLoginAt: now,
+		}
+		if err := DB.Create(&identity).Error; err != nil {
+			return i, err
+		}
+	}
+	return len(users), nil
+}
+
+// createIdentityUser creates a user without a password in a transaction,
+// adding a number to the username until it is free
+func createIdentityUser(tx *gorm.DB, username string) (models.User, error) {
+	for i := 0; i < 20; i++ {
+		candidate := username
+		if i > 0 {
+			candidate = fmt.Sprintf("%s%d", username, i+1)
+		}
+
+		var count int64
+		if err := tx.Model(&models.User{}).Where("username = ?", candidate).Count(&count).Error; err != nil {
+			return models.User{}, err
+		}
+		if count > 0 {
+			continue
+		}
+
+		user := models.User{
+			ID:       utils.GenerateCUID(),
+			Username: candidate,
+			Password: "", // Signs in through the identity provider only
+			Role:     models.RoleUser,
+		}
+		if err := createUser(tx, &user); err != nil {
+			return models.User{}, err
+		}
+		return user, nil
+	}
+	return models.User{}, fmt.Errorf("no free username for %q", username)
+}
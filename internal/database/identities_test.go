@@ -0,0 +1,164 @@
+package database
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/genosis18m/Metaverse_go/internal/models"
+	"github.com/genosis18m/Metaverse_go/internal/utils"
+	"gorm.io/gorm"
+)
+
+func TestUserForIdentityLinksBySubject(t *testing.T) {
+	withTestDB(t)
+	identity := models.UserIdentity{Provider: "okta", Subject: utils.GenerateCUID(), Email: "bob@example.com", EmailVerified: true}
+
+	first, err := UserForIdentity(identity, "bob"+utils.GenerateRandomString(6))
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := UserForIdentity(identity, "someone-else")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.ID != first.ID {
+		t.Fatalf("second sign-in gave user %s, want %s", again.ID, first.ID)
+	}
+}
+
+func TestUserForIdentityCreatesNoUserWithoutIdentity(t *testing.T) {
+	withTestDB(t)
+	username := "carol" + utils.GenerateRandomString(6)
+	// Too long for the provider column, so storing the identity fails
+	identity := models.UserIdentity{Provider: strings.Repeat("p", 65), Subject: utils.GenerateCUID()}
+
+	if _, err := UserForIdentity(identity, username); err == nil {
+		t.Fatal("an identity that cannot be stored was accepted")
+	}
+	var count int64
+	DB.Model(&models.User{}).Where("username = ?", username).Count(&count)
+	if count != 0 {
+		t.Fatal("the user was kept without its identity")
+	}
+}
+
+func TestUserForIdentityReturnsTheUserOfAConcurrentSignIn(t *testing.T) {
+	withTestDB(t)
+	identity := models.UserIdentity{Provider: "okta", Subject: utils.GenerateCUID()}
+
+	// Another sign-in with the same identity commits while this one is
+	// about to store the identity
+	raced := false
+	var winner models.User
+	err := DB.Callback().Create().Before("gorm:create").Register("test:concurrent_sign_in", func(tx *gorm.DB) {
+		if raced || tx.Statement.Table != (models.UserIdentity{}).TableName() {
+			return
+		}
+		raced = true
+		winner = createTestUser(t)
+		now := time.Now()
+		other := identity
+		other.ID, other.UserID, other.CreatedAt, other.LastLoginAt = utils.GenerateCUID(), winner.ID, now, now
+		if err := DB.Create(&other).Error; err != nil {
+			t.Error(err)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	username := "dave" + utils.GenerateRandomString(6)
+	user, err := UserForIdentity(identity, username)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.ID != winner.ID {
+		t.Fatalf("got user %s, want %s of the sign-in that won", user.ID, winner.ID)
+	}
+	var count int64
+	DB.Model(&models.User{}).Where("username = ?", username).Count(&count)
+	if count != 0 {
+		t.Fatal("the losing sign-in left a user behind")
+	}
+}
+
+func TestUserForIdentityIgnoresRenamedAccounts(t *testing.T) {
+	withTestDB(t)
+	email := utils.GenerateRandomString(10) + "@example.com"
+
+	// A password-less account renames itself to the email of someone who
+	// has not signed in yet
+	squatter := models.User{ID: utils.GenerateCUID(), Username: "squatter" + utils.GenerateRandomString(6), Role: models.RoleUser}
+	if err := CreateUser(&squatter); err != nil {
+		t.Fatal(err)
+	}
+	if err := DB.Model(&squatter).Update("username", email).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	identity := models.UserIdentity{Provider: "google", Subject: utils.GenerateCUID(), Email: email, EmailVerified: true}
+	user, err := UserForIdentity(identity, "victim"+utils.GenerateRandomString(6))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.ID == squatter.ID {
+		t.Fatal("the sign-in was linked to the account named after its email")
+	}
+
+	var linked int64
+	DB.Model(&models.UserIdentity{}).Where("user_id = ?", squatter.ID).Count(&linked)
+	if linked != 0 {
+		t.Fatalf("%d identities linked to the renamed account", linked)
+	}
+}
+
+func TestLegacyGoogleUsersAreLinkedByRecordedEmail(t *testing.T) {
+	withTestDB(t)
+	email := utils.GenerateRandomString(10) + "@example.com"
+	legacy := models.User{ID: utils.GenerateCUID(), Username: email, Role: models.RoleUser}
+	if err := CreateUser(&legacy); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LinkLegacyGoogleUsers(); err != nil {
+		t.Fatal(err)
+	}
+	// Running it again does not add a second placeholder
+	if _, err := LinkLegacyGoogleUsers(); err != nil {
+		t.Fatal(err)
+	}
+	var placeholders int64
+	DB.Model(&models.UserIdentity{}).Where("user_id = ?", legacy.ID).Count(&placeholders)
+	if placeholders != 1 {
+		t.Fatalf("%d identities for the legacy user, want 1", placeholders)
+	}
+
+	cases := []struct {
+		name     string
+		identity models.UserIdentity
+		linked   bool
+	}{
+		{"unverified email", models.UserIdentity{Provider: "google", Subject: utils.GenerateCUID(), Email: email}, false},
+		{"other provider", models.UserIdentity{Provider: "okta", Subject: utils.GenerateCUID(), Email: email, EmailVerified: true}, false},
+		{"verified email", models.UserIdentity{Provider: "google", Subject: utils.GenerateCUID(), Email: email, EmailVerified: true}, true},
+		{"another account with the email", models.UserIdentity{Provider: "google", Subject: utils.GenerateCUID(), Email: email, EmailVerified: true}, false},
+	}
+	for _, c := range cases {
+		user, err := UserForIdentity(c.identity, "user"+utils.GenerateRandomString(6))
+		if err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if (user.ID == legacy.ID) != c.linked {
+			t.Errorf("%s: linked to the legacy user %t, want %t", c.name, user.ID == legacy.ID, c.linked)
+		}
+	}
+
+	// The claimed identity now carries the real subject
+	again, err := UserForIdentity(cases[2].identity, "someone-else")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.ID != legacy.ID {
+		t.Fatalf("second sign-in gave user %s, want the legacy user", again.ID)
+	}
+}
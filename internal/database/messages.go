@@ -0,0 +1,119 @@
+package database
+
+import (
+	"errors"
+	"time"
+
+	"github.com/genosis18m/Metaverse_go/internal/models"
+)
+
+const (
+	// DefaultMessageLimit is the page size when none is requested
+	DefaultMessageLimit = 50
+	// MaxMessageLimit caps the page size of a chat history request
+	MaxMessageLimit = 100
+)
+
+// ErrCursorNotFound is returned when a pagination cursor does not name a message of the space
+var ErrCursorNotFound = errors.New("cursor message not found")
+
+// MessageQuery describes a page of chat history
+type MessageQuery struct {
+	// Before and After are message IDs; at most one should be set
+	Before string
+	After  string
+	// Search matches messages using Postgres full-text search
+	Search string
+	Limit  int
+	// ViewerID limits scoped messages to those the user sent or received
+	ViewerID string
+}
+
+// ListMessages returns a page of the chat history of a space, oldest first,
+// and whether more messages exist beyond the page in the paging direction
+func ListMessages(spaceID string, q MessageQuery) ([]models.Message, bool, error) {
+	limit := q.Limit
+	if limit <= 0 {
+		limit = DefaultMessageLimit
+	}
+	if limit > MaxMessageLimit {
+		limit = MaxMessageLimit
+	}
+
+	query := DB.Preload("User").Where("space_id = ?", spaceID)
+	if q.ViewerID != "" {
+		query = query.Where("scope = ? OR user_id = ? OR EXISTS (SELECT 1 FROM message_recipients r WHERE r.message_id = messages.id AND r.user_id = ?)",
+			models.ChatScopeRoom, q.ViewerID, q.ViewerID)
+	}
+	if q.Search != "" {
+		query = query.Where("to_tsvector('simple', text) @@ plainto_tsquery('simple', ?)", q.Search)
+	}
+
+	// Messages are ordered by creation time, with the ID breaking ties
+	ascending := false
+	cursorID := q.Before
+	if q.After != "" {
+		ascending = true
+		cursorID = q.After
+	}
+	if cursorID != "" {
+		var cursor models.Message
+		if err := DB.First(&cursor, "id = ? AND space_id = ?", cursorID, spaceID).Error; err != nil {
+			return nil, false, ErrCursorNotFound
+		}
+		if ascending {
+			query = query.Where("(created_at, id) > (?, ?)", cursor.CreatedAt, cursor.ID)
+		} else {
+			query = query.Where("(created_at, id) < (?, ?)", cursor.CreatedAt, cursor.ID)
+		}
+	}
+	if ascending {
+		query = query.Order("created_at asc, id asc")
+	} else {
+		query = query.Order("created_at desc, id desc")
+	}
+
+	// Fetch one extra row to know whether another page exists
+	var messages []models.Message
+	if err := query.Limit(limit + 1).Find(&messages).Error; err != nil {
+		return nil, false, err
+	}
+	hasMore := len(messages) > limit
+	if hasMore {
+		messages = messages[:limit]
+	}
+
+	if !ascending {
+		for i, j := 0, len(messages)-1; i < j; i, j = i+1, j-1 {
+			messages[i], messages[j] = messages[j], messages[i]
+		}
+	}
+	return messages, hasMore, nil
+}
+
+// IsMuted reports whether a user is muted in a space
+func IsMuted(spaceID, userID string) (bool, error) {
+	var count int64
+	err := DB.Model(&models.SpaceMute{}).
+		Where("space_id = ? AND user_id = ? AND (until IS NULL OR until > ?)", spaceID, userID, time.Now()).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// MessageAudience returns the account IDs that received a scoped message,
+// including its author. Room messages return nil as everyone received them.
+func MessageAudience(msg models.Message) ([]string, error) {
+	if msg.Scope == models.ChatScopeRoom {
+		return nil, nil
+	}
+
+	var recipients []models.MessageRecipient
+	if err := DB.Where("message_id = ?", msg.ID).Find(&recipients).Error; err != nil {
+		return nil, err
+	}
+	userIDs := []string{msg.UserID}
+	for _, r := range recipients {
+		userIDs = append(userIDs, r.UserID)
+	}
+	return userIDs, nil
+}
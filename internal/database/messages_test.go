@@ -0,0 +1,281 @@
+package database
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/genosis18m/Metaverse_go/internal/models"
+	"github.com/genosis18m/Metaverse_go/internal/utils"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// withTestDB connects to the Postgres database of TEST_DATABASE_URL and
+// migrates it. Tests are skipped when it is not set.
+func withTestDB(t *testing.T) {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	saved := DB
+	DB = db
+	t.Cleanup(func() { DB = saved })
+	if err := AutoMigrate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// createTestUser stores a user with a unique name
+func createTestUser(t *testing.T) models.User {
+	t.Helper()
+	user := models.User{ID: utils.GenerateCUID(), Username: "user-" + utils.GenerateRandomString(10), Role: models.RoleUser}
+	if err := DB.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+// createTestSpace stores a 20×20 space created by a user
+func createTestSpace(t *testing.T, creatorID string) models.Space {
+	t.Helper()
+	space := models.Space{ID: utils.GenerateCUID(), Name: "test space", Width: 20, Height: 20, CreatorID: creatorID}
+	if err := DB.Create(&space).Error; err != nil {
+		t.Fatal(err)
+	}
+	return space
+}
+
+// createTestMessage stores a chat message sent at a given time
+func createTestMessage(t *testing.T, spaceID, userID, text string, at time.Time) models.Message {
+	t.Helper()
+	msg := models.Message{ID: utils.GenerateCUID(), Text: text, UserID: userID, SpaceID: spaceID, Scope: models.ChatScopeRoom, CreatedAt: at}
+	if err := DB.Create(&msg).Error; err != nil {
+		t.Fatal(err)
+	}
+	return msg
+}
+
+func messageTexts(messages []models.Message) []string {
+	texts := make([]string, len(messages))
+	for i, msg := range messages {
+		texts[i] = msg.Text
+	}
+	return texts
+}
+
+func equalTexts(got []models.Message, want ...string) bool {
+	texts := messageTexts(got)
+	if len(texts) != len(want) {
+		return false
+	}
+	for i := range want {
+		if texts[i] != want[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestListMessagesPagesByCursor(t *testing.T) {
+	withTestDB(t)
+	user := createTestUser(t)
+	space := createTestSpace(t, user.ID)
+
+	start := time.Now().Add(-time.Hour).Truncate(time.Second)
+	msgs := make([]models.Message, 0, 5)
+	for i, text := range []string{"one", "two", "three", "four", "five"} {
+		msgs = append(msgs, createTestMessage(t, space.ID, user.ID, text, start.Add(time.Duration(i)*time.Second)))
+	}
+
+	latest, hasMore, err := ListMessages(space.ID, MessageQuery{Limit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equalTexts(latest, "four", "five") || !hasMore {
+		t.Fatalf("latest page = %v (hasMore %t), want [four five] with more", messageTexts(latest), hasMore)
+	}
+	if latest[0].User.Username != user.Username {
+		t.Fatalf("author not loaded: %+v", latest[0].User)
+	}
+
+	older, hasMore, err := ListMessages(space.ID, MessageQuery{Before: latest[0].ID, Limit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equalTexts(older, "two", "three") || !hasMore {
+		t.Fatalf("older page = %v (hasMore %t), want [two three] with more", messageTexts(older), hasMore)
+	}
+
+	oldest, hasMore, err := ListMessages(space.ID, MessageQuery{Before: older[0].ID, Limit: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equalTexts(oldest, "one") || hasMore {
+		t.Fatalf("oldest page = %v (hasMore %t), want [one] and no more", messageTexts(oldest), hasMore)
+	}
+
+	newer, hasMore, err := ListMessages(space.ID, MessageQuery{After: msgs[0].ID, Limit: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equalTexts(newer, "two", "three", "four") || !hasMore {
+		t.Fatalf("newer page = %v (hasMore %t), want [two three four] with more", messageTexts(newer), hasMore)
+	}
+}
+
+func TestListMessagesBreaksTiesByID(t *testing.T) {
+	withTestDB(t)
+	user := createTestUser(t)
+	space := createTestSpace(t, user.ID)
+
+	// Messages sent within the same instant still page without gaps or repeats
+	at := time.Now().Add(-time.Hour).Truncate(time.Second)
+	for i := 0; i < 5; i++ {
+		createTestMessage(t, space.ID, user.ID, utils.GenerateRandomString(6), at)
+	}
+
+	seen := make(map[string]bool)
+	cursor := ""
+	for pages := 0; ; pages++ {
+		if pages > 5 {
+			t.Fatal("paging did not end")
+		}
+		page, hasMore, err := ListMessages(space.ID, MessageQuery{Before: cursor, Limit: 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, msg := range page {
+			if seen[msg.ID] {
+				t.Fatalf("message %s returned twice", msg.ID)
+			}
+			seen[msg.ID] = true
+		}
+		if !hasMore {
+			break
+		}
+		cursor = page[0].ID
+	}
+	if len(seen) != 5 {
+		t.Fatalf("paging returned %d of 5 messages", len(seen))
+	}
+}
+
+func TestListMessagesSearch(t *testing.T) {
+	withTestDB(t)
+	user := createTestUser(t)
+	space := createTestSpace(t, user.ID)
+	other := createTestSpace(t, user.ID)
+
+	start := time.Now().Add(-time.Hour)
+	createTestMessage(t, space.ID, user.ID, "Deploy the release tonight", start)
+	createTestMessage(t, space.ID, user.ID, "lunch anyone?", start.Add(time.Second))
+	createTestMessage(t, space.ID, user.ID, "the release went fine", start.Add(2*time.Second))
+	createTestMessage(t, other.ID, user.ID, "release notes for another space", start)
+
+	found, hasMore, err := ListMessages(space.ID, MessageQuery{Search: "release"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equalTexts(found, "Deploy the release tonight", "the release went fine") || hasMore {
+		t.Fatalf("search found %v (hasMore %t)", messageTexts(found), hasMore)
+	}
+
+	// Search combines with the cursor
+	found, _, err = ListMessages(space.ID, MessageQuery{Search: "release", Before: found[1].ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equalTexts(found, "Deploy the release tonight") {
+		t.Fatalf("search before the latest match found %v", messageTexts(found))
+	}
+}
+
+func TestListMessagesRejectsForeignCursor(t *testing.T) {
+	withTestDB(t)
+	user := createTestUser(t)
+	space := createTestSpace(t, user.ID)
+	other := createTestSpace(t, user.ID)
+	foreign := createTestMessage(t, other.ID, user.ID, "elsewhere", time.Now())
+
+	for _, q := range []MessageQuery{{Before: "missing"}, {After: foreign.ID}} {
+		if _, _, err := ListMessages(space.ID, q); !errors.Is(err, ErrCursorNotFound) {
+			t.Fatalf("query %+v: err = %v, want ErrCursorNotFound", q, err)
+		}
+	}
+}
+
+func TestListMessagesCapsLimit(t *testing.T) {
+	withTestDB(t)
+	user := createTestUser(t)
+	space := createTestSpace(t, user.ID)
+
+	start := time.Now().Add(-time.Hour)
+	for i := 0; i < MaxMessageLimit+1; i++ {
+		createTestMessage(t, space.ID, user.ID, "spam", start.Add(time.Duration(i)*time.Millisecond))
+	}
+
+	page, hasMore, err := ListMessages(space.ID, MessageQuery{Limit: MaxMessageLimit * 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(page) != MaxMessageLimit || !hasMore {
+		t.Fatalf("got %d messages (hasMore %t), want %d with more", len(page), hasMore, MaxMessageLimit)
+	}
+}
+
+func TestScopedMessagesAreOnlyListedForTheirAudience(t *testing.T) {
+	withTestDB(t)
+	author := createTestUser(t)
+	recipient := createTestUser(t)
+	outsider := createTestUser(t)
+	space := createTestSpace(t, author.ID)
+
+	start := time.Now().Add(-time.Hour)
+	room := createTestMessage(t, space.ID, author.ID, "hello everyone", start)
+	nearby := models.Message{
+		ID: utils.GenerateCUID(), Text: "psst", UserID: author.ID, SpaceID: space.ID,
+		Scope: models.ChatScopeNearby, CreatedAt: start.Add(time.Second),
+		Recipients: []models.MessageRecipient{{UserID: recipient.ID}},
+	}
+	if err := DB.Create(&nearby).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range []struct {
+		name   string
+		viewer string
+		want   []string
+	}{
+		{"author", author.ID, []string{"hello everyone", "psst"}},
+		{"recipient", recipient.ID, []string{"hello everyone", "psst"}},
+		{"outsider", outsider.ID, []string{"hello everyone"}},
+	} {
+		got, _, err := ListMessages(space.ID, MessageQuery{ViewerID: c.viewer})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !equalTexts(got, c.want...) {
+			t.Fatalf("%s sees %v, want %v", c.name, messageTexts(got), c.want)
+		}
+	}
+
+	if audience, err := MessageAudience(room); err != nil || audience != nil {
+		t.Fatalf("room message audience = %v (err %v), want everyone", audience, err)
+	}
+	audience, err := MessageAudience(nearby)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(audience) != 2 || audience[0] != author.ID || audience[1] != recipient.ID {
+		t.Fatalf("nearby message audience = %v, want the author and the recipient", audience)
+	}
+}
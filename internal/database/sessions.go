@@ -0,0 +1,134 @@
+package database
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/genosis18m/Metaverse_go/internal/models"
+	"github.com/genosis18m/Metaverse_go/internal/utils"
+)
+
+// ErrInvalidRefreshToken is returned for refresh tokens that are unknown,
+// expired, already used or belong to a revoked session
+var ErrInvalidRefreshToken = errors.New("invalid refresh token")
+
+// CreateSession starts a session for a user and returns it with its first refresh token
+func CreateSession(userID, userAgent string) (models.UserSession, string, error) {
+	now := time.Now()
+	session := models.UserSession{
+		ID:         utils.GenerateCUID(),
+		UserID:     userID,
+		UserAgent:  userAgent,
+		CreatedAt:  now,
+		LastUsedAt: now,
+	}
+	if err := DB.Create(&session).Error; err != nil {
+		return session, "", err
+	}
+
+	token, err := issueRefreshToken(session.ID)
+	return session, token, err
+}
+
+// RotateRefreshToken exchanges a refresh token for a new one in the same
+// session. Presenting a token that was already used revokes the session,
+// since it means the token was copied.
+func RotateRefreshToken(token string) (models.UserSession, string, error) {
+	var session models.UserSession
+
+	var current models.RefreshToken
+	if err := DB.First(&current, "token_hash = ?", utils.HashToken(token)).Error; err != nil {
+		return session, "", ErrInvalidRefreshToken
+	}
+	if err := DB.First(&session, "id = ?", current.SessionID).Error; err != nil || session.RevokedAt != nil {
+		return session, "", ErrInvalidRefreshToken
+	}
+	if time.Now().After(current.ExpiresAt) {
+		return session, "", ErrInvalidRefreshToken
+	}
+
+	// Mark the token used only if nobody else did first
+	used := DB.Model(&models.RefreshToken{}).
+		Where("id = ? AND used_at IS NULL", current.ID).
+		Update("used_at", time.Now())
+	if used.Error != nil {
+		return session, "", used.Error
+	}
+	if used.RowsAffected == 0 {
+		log.Printf("Refresh token reused in session %s, revoking it", session.ID)
+		if err := RevokeSession(session.ID); err != nil {
+			log.Printf("Error revoking session %s: %v", session.ID, err)
+		}
+		return session, "", ErrInvalidRefreshToken
+	}
+
+	session.LastUsedAt = time.Now()
+	DB.Model(&session).Update("last_used_at", session.LastUsedAt)
+
+	next, err := issueRefreshToken(session.ID)
+	return session, next, err
+}
+
+func issueRefreshToken(sessionID string) (string, error) {
+	token, hash := utils.GenerateRefreshToken()
+	refresh := models.RefreshToken{
+		ID:        utils.GenerateCUID(),
+		SessionID: sessionID,
+		TokenHash: hash,
+		ExpiresAt: time.Now().Add(utils.RefreshTokenTTL()),
+		CreatedAt: time.Now(),
+	}
+	if err := DB.Create(&refresh).Error; err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// RevokeSession ends a session: its refresh tokens stop working and so do the
+// access tokens issued for it
+func RevokeSession(sessionID string) error {
+	return DB.Model(&models.UserSession{}).
+		Where("id = ? AND revoked_at IS NULL", sessionID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// RevokeUserSessions ends every session of a user
+func RevokeUserSessions(userID string) error {
+	return DB.Model(&models.UserSession{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// RevokeToken denies a single access token until it expires, and drops
+// denylist entries that have expired
+func RevokeToken(claims *utils.Claims) error {
+	if claims.ID == "" || claims.ExpiresAt == nil {
+		return nil
+	}
+	DB.Where("expires_at < ?", time.Now()).Delete(&models.RevokedToken{})
+	return DB.Save(&models.RevokedToken{JTI: claims.ID, ExpiresAt: claims.ExpiresAt.Time}).Error
+}
+
+// IsTokenRevoked reports whether an access token was revoked, by its own ID
+// or through its session. Lookup failures count as revoked.
+func IsTokenRevoked(claims *utils.Claims) bool {
+	if claims.ID != "" {
+		var count int64
+		if err := DB.Model(&models.RevokedToken{}).Where("jti = ?", claims.ID).Count(&count).Error; err != nil {
+			log.Printf("Error checking token revocation: %v", err)
+			return true
+		} else if count > 0 {
+			return true
+		}
+	}
+
+	if claims.SessionID != "" {
+		var session models.UserSession
+		if err := DB.Select("revoked_at").First(&session, "id = ?", claims.SessionID).Error; err != nil {
+			return true
+		}
+		return session.RevokedAt != nil
+	}
+	return false
+}
@@ -0,0 +1,124 @@
+package database
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/genosis18m/Metaverse_go/internal/models"
+	"github.com/genosis18m/Metaverse_go/internal/utils"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestRotateRefreshToken(t *testing.T) {
+	withTestDB(t)
+
+	session, first, err := CreateSession(utils.GenerateCUID(), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rotated, second, err := RotateRefreshToken(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rotated.ID != session.ID || second == "" || second == first {
+		t.Fatalf("rotation gave session %s and token %q", rotated.ID, second)
+	}
+	if _, third, err := RotateRefreshToken(second); err != nil || third == "" {
+		t.Fatalf("rotating the new token: %v", err)
+	}
+
+	if _, _, err := RotateRefreshToken("unknown"); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Fatalf("unknown token: err = %v", err)
+	}
+}
+
+func TestReusedRefreshTokenRevokesSession(t *testing.T) {
+	withTestDB(t)
+
+	session, first, err := CreateSession(utils.GenerateCUID(), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, second, err := RotateRefreshToken(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A copy of the first token is presented again
+	if _, _, err := RotateRefreshToken(first); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Fatalf("reused token: err = %v", err)
+	}
+	if _, _, err := RotateRefreshToken(second); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Fatalf("the legitimate token still works after the reuse: err = %v", err)
+	}
+	if !IsTokenRevoked(&utils.Claims{SessionID: session.ID}) {
+		t.Fatal("access tokens of the session are still accepted")
+	}
+}
+
+func TestExpiredRefreshToken(t *testing.T) {
+	withTestDB(t)
+
+	_, token, err := CreateSession(utils.GenerateCUID(), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	DB.Model(&models.RefreshToken{}).Where("token_hash = ?", utils.HashToken(token)).
+		Update("expires_at", time.Now().Add(-time.Minute))
+
+	if _, _, err := RotateRefreshToken(token); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Fatalf("expired token: err = %v", err)
+	}
+}
+
+func TestRevokeToken(t *testing.T) {
+	withTestDB(t)
+
+	session, _, err := CreateSession(utils.GenerateCUID(), "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims := func() *utils.Claims {
+		return &utils.Claims{SessionID: session.ID, RegisteredClaims: jwt.RegisteredClaims{
+			ID:        utils.GenerateCUID(),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+		}}
+	}
+	revoked, other := claims(), claims()
+
+	if IsTokenRevoked(revoked) {
+		t.Fatal("a fresh token is revoked")
+	}
+	if err := RevokeToken(revoked); err != nil {
+		t.Fatal(err)
+	}
+	if !IsTokenRevoked(revoked) {
+		t.Fatal("the denied jti is still accepted")
+	}
+	if IsTokenRevoked(other) {
+		t.Fatal("denying one token denied the rest of its session")
+	}
+
+	// Entries are dropped once the token they deny has expired
+	stale := &utils.Claims{RegisteredClaims: jwt.RegisteredClaims{
+		ID:        utils.GenerateCUID(),
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(-time.Minute)),
+	}}
+	DB.Create(&models.RevokedToken{JTI: stale.ID, ExpiresAt: stale.ExpiresAt.Time})
+	if err := RevokeToken(other); err != nil {
+		t.Fatal(err)
+	}
+	var count int64
+	DB.Model(&models.RevokedToken{}).Where("jti = ?", stale.ID).Count(&count)
+	if count != 0 {
+		t.Fatal("expired denylist entry was kept")
+	}
+
+	if err := RevokeSession(session.ID); err != nil {
+		t.Fatal(err)
+	}
+	if !IsTokenRevoked(claims()) {
+		t.Fatal("tokens of a revoked session are accepted")
+	}
+}
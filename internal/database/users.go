@@ -0,0 +1,162 @@
+package database
+
+import (
+	"time"
+
+	"github.com/genosis18m/Metaverse_go/internal/models"
+	"gorm.io/gorm"
+)
+
+// bootstrapLockID is the advisory lock serializing signups while the
+// deployment has no users
+const bootstrapLockID = 7210431
+
+// CreateUser stores a new user. The very first user of a deployment becomes
+// an admin, so a fresh install can be set up without seeding. Deployments
+// that already have users get their admins through cmd/admin.
+func CreateUser(user *models.User) error {
+	return createUser(DB, user)
+}
+
+// createUser is CreateUser on a connection or transaction
+func createUser(db *gorm.DB, user *models.User) error {
+	hasUsers, err := usersExist(db)
+	if err != nil {
+		return err
+	}
+	if hasUsers {
+		return db.Create(user).Error
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", bootstrapLockID).Error; err != nil {
+			return err
+		}
+		// Another signup may have become the first user while we waited
+		hasUsers, err := usersExist(tx)
+		if err != nil {
+			return err
+		}
+		if !hasUsers {
+			user.Role = models.RoleAdmin
+		}
+		return tx.Create(user).Error
+	})
+}
+
+func usersExist(tx *gorm.DB) (bool, error) {
+	var exists bool
+	users := tx.Model(&models.User{}).Select("1")
+	err := tx.Raw("SELECT EXISTS (?)", users).Scan(&exists).Error
+	return exists, err
+}
+
+// AccountStatus returns the current role of a user and whether they are suspended
+func AccountStatus(userID string) (models.Role, bool, error) {
+	var user models.User
+	if err := DB.Select("role", "suspended_at").First(&user, "id = ?", userID).Error; err != nil {
+		return "", false, err
+	}
+	return user.Role, user.SuspendedAt != nil, nil
+}
+
+// SuspendUser stops a user from signing in and ends their sessions
+func SuspendUser(userID, reason string) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&models.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+			"suspended_at":     time.Now(),
+			"suspended_reason": reason,
+		}).Error
+		if err != nil {
+			return err
+		}
+		return tx.Model(&models.UserSession{}).
+			Where("user_id = ? AND revoked_at IS NULL", userID).
+			Update("revoked_at", time.Now()).Error
+	})
+}
+
+// UnsuspendUser lets a suspended user sign in again
+func UnsuspendUser(userID string) error {
+	return DB.Model(&models.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+		"suspended_at":     nil,
+		"suspended_reason": "",
+	}).Error
+}
+
+// DeleteUser removes a user along with the spaces they created, their
+// messages, memberships, sessions and linked identities. It returns the IDs
+// of the deleted spaces.
+func DeleteUser(userID string) ([]string, error) {
+	var spaceIDs []string
+	err := DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Space{}).Where("creator_id = ?", userID).Pluck("id", &spaceIDs).Error; err != nil {
+			return err
+		}
+		for _, spaceID := range spaceIDs {
+			if err := DeleteSpace(tx, spaceID); err != nil {
+				return err
+			}
+		}
+
+		messages := tx.Unscoped().Model(&models.Message{}).Select("id").Where("user_id = ?", userID)
+		sessions := tx.Model(&models.UserSession{}).Select("id").Where("user_id = ?", userID)
+		steps := []deletion{
+			del(&models.MessageRecipient{}, "user_id = ? OR message_id IN (?)", userID, messages),
+			del(&models.Message{}, "user_id = ?", userID),
+			del(&models.DirectMessage{}, "sender_id = ? OR recipient_id = ?", userID, userID),
+			del(&models.SpaceMute{}, "user_id = ?", userID),
+			del(&models.SpaceKick{}, "user_id = ?", userID),
+			del(&models.SpaceMember{}, "user_id = ?", userID),
+			del(&models.UserSpacePosition{}, "user_id = ?", userID),
+			del(&models.RefreshToken{}, "session_id IN (?)", sessions),
+			del(&models.UserSession{}, "user_id = ?", userID),
+			del(&models.UserIdentity{}, "user_id = ?", userID),
+			del(&models.User{}, "id = ?", userID),
+		}
+		return deleteInOrder(tx, steps)
+	})
+	return spaceIDs, err
+}
+
+// DeleteSpace removes a space and everything that belongs to it, including
+// the portals of other spaces that lead into it
+func DeleteSpace(tx *gorm.DB, spaceID string) error {
+	messages := tx.Unscoped().Model(&models.Message{}).Select("id").Where("space_id = ?", spaceID)
+	steps := []deletion{
+		del(&models.MessageRecipient{}, "message_id IN (?)", messages),
+		del(&models.Message{}, "space_id = ?", spaceID),
+		del(&models.SpaceElement{}, "space_id = ?", spaceID),
+		del(&models.SpaceZone{}, "space_id = ?", spaceID),
+		del(&models.SpacePortal{}, "space_id = ? OR target_space_id = ?", spaceID, spaceID),
+		del(&models.UserSpacePosition{}, "space_id = ?", spaceID),
+		del(&models.SpaceMute{}, "space_id = ?", spaceID),
+		del(&models.SpaceKick{}, "space_id = ?", spaceID),
+		del(&models.SpaceMember{}, "space_id = ?", spaceID),
+		del(&models.SpaceInvite{}, "space_id = ?", spaceID),
+		del(&models.Space{}, "id = ?", spaceID),
+	}
+	return deleteInOrder(tx, steps)
+}
+
+// deletion removes the rows of a model that match a condition
+type deletion struct {
+	model interface{}
+	query string
+	args  []interface{}
+}
+
+func del(model interface{}, query string, args ...interface{}) deletion {
+	return deletion{model: model, query: query, args: args}
+}
+
+// deleteInOrder runs deletions in order and stops at the first that fails.
+// Soft-deleted rows are removed too.
+func deleteInOrder(tx *gorm.DB, deletions []deletion) error {
+	for _, d := range deletions {
+		if err := tx.Unscoped().Where(d.query, d.args...).Delete(d.model).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,101 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/genosis18m/Metaverse_go/internal/models"
+	"github.com/genosis18m/Metaverse_go/internal/utils"
+)
+
+// withoutUsers runs a test against a deployment without users, rolled back
+// afterwards
+func withoutUsers(t *testing.T) {
+	t.Helper()
+	tx := DB.Begin()
+	saved := DB
+	DB = tx
+	t.Cleanup(func() {
+		DB = saved
+		tx.Rollback()
+	})
+	if err := tx.Exec("TRUNCATE users CASCADE").Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCreateUserMakesTheFirstUserAnAdmin(t *testing.T) {
+	withTestDB(t)
+	withoutUsers(t)
+
+	for i, want := range []models.Role{models.RoleAdmin, models.RoleUser, models.RoleUser} {
+		user := models.User{ID: utils.GenerateCUID(), Username: "user-" + utils.GenerateRandomString(10), Role: models.RoleUser}
+		if err := CreateUser(&user); err != nil {
+			t.Fatal(err)
+		}
+		var stored models.User
+		if err := DB.First(&stored, "id = ?", user.ID).Error; err != nil {
+			t.Fatal(err)
+		}
+		if user.Role != want || stored.Role != want {
+			t.Fatalf("user %d: role %q (stored %q), want %q", i, user.Role, stored.Role, want)
+		}
+	}
+}
+
+func TestCreateUserWithoutAnAdminKeepsTheRole(t *testing.T) {
+	withTestDB(t)
+	withoutUsers(t)
+	// A deployment with users but no admin, who come from cmd/admin instead
+	createTestUser(t)
+
+	user := models.User{ID: utils.GenerateCUID(), Username: "user-" + utils.GenerateRandomString(10), Role: models.RoleUser}
+	if err := CreateUser(&user); err != nil {
+		t.Fatal(err)
+	}
+	var stored models.User
+	if err := DB.First(&stored, "id = ?", user.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if user.Role != models.RoleUser || stored.Role != models.RoleUser {
+		t.Fatalf("role %q (stored %q), want %q", user.Role, stored.Role, models.RoleUser)
+	}
+}
+
+func TestDeleteUser(t *testing.T) {
+	withTestDB(t)
+	user, other := createTestUser(t), createTestUser(t)
+	owned := createTestSpace(t, user.ID)
+	joined := createTestSpace(t, other.ID)
+	addTestMember(t, joined.ID, user.ID, models.SpaceRoleMember)
+	createTestMessage(t, joined.ID, user.ID, "hello", time.Now())
+
+	spaceIDs, err := DeleteUser(user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(spaceIDs) != 1 || spaceIDs[0] != owned.ID {
+		t.Fatalf("deleted spaces %v, want [%s]", spaceIDs, owned.ID)
+	}
+
+	for _, c := range []struct {
+		name  string
+		model interface{}
+		query string
+		arg   string
+	}{
+		{"user", &models.User{}, "id = ?", user.ID},
+		{"owned space", &models.Space{}, "id = ?", owned.ID},
+		{"membership", &models.SpaceMember{}, "user_id = ?", user.ID},
+		{"message", &models.Message{}, "user_id = ?", user.ID},
+	} {
+		var count int64
+		DB.Unscoped().Model(c.model).Where(c.query, c.arg).Count(&count)
+		if count != 0 {
+			t.Errorf("%s was not deleted", c.name)
+		}
+	}
+	if err := DB.First(&models.Space{}, "id = ?", joined.ID).Error; err != nil {
+		t.Errorf("the space of another user was deleted: %v", err)
+	}
+}
@@ -0,0 +1,156 @@
+// Package events carries space and user changes from the HTTP API to the
+// WebSocket servers, which run as separate processes
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"sync"
+)
+
+// Type identifies a space change
+type Type string
+
+const (
+	// ElementAdded is published when an element is placed in a space
+	ElementAdded Type = "element-added"
+	// ElementUpdated is published when an element is moved or rotated
+	ElementUpdated Type = "element-updated"
+	// ElementRemoved is published when an element is removed from a space
+	ElementRemoved Type = "element-removed"
+	// SpaceChanged is published when the zones, portals or settings of a space change
+	SpaceChanged Type = "space-changed"
+	// SpaceAccessChanged is published when the visibility of a space changes
+	// or a member is removed, which may revoke access to it
+	SpaceAccessChanged Type = "space-access-changed"
+	// SpaceDeleted is published when a space is deleted
+	SpaceDeleted Type = "space-deleted"
+	// UserSuspended is published when an admin suspends a user
+	UserSuspended Type = "user-suspended"
+	// UserDeleted is published when an admin deletes a user
+	UserDeleted Type = "user-deleted"
+)
+
+// Event is a change to a space or a user. Element carries the element as
+// returned by the HTTP API for the element events.
+type Event struct {
+	Type    Type            `json:"type"`
+	SpaceID string          `json:"spaceId,omitempty"`
+	UserID  string          `json:"userId,omitempty"`
+	By      string          `json:"by,omitempty"`
+	Element json.RawMessage `json:"element,omitempty"`
+}
+
+// Bus delivers events from publishers to every subscriber, in any process
+// connected to the same bus
+type Bus interface {
+	// Publish sends an event to every subscriber
+	Publish(event Event) error
+	// Subscribe registers a handler for every event and returns a function that removes it
+	Subscribe(handler func(Event)) (func(), error)
+	// Close releases the resources held by the bus
+	Close() error
+}
+
+// New creates a bus from a URL. An empty URL selects Postgres LISTEN/NOTIFY
+// on DATABASE_URL, which the HTTP and WebSocket servers already share;
+// postgres:// URLs select another database and "memory" an in-process bus.
+func New(rawURL string) (Bus, error) {
+	if rawURL == "" {
+		rawURL = os.Getenv("DATABASE_URL")
+	}
+	if rawURL == "memory" {
+		return NewMemoryBus(), nil
+	}
+
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	switch parsed.Scheme {
+	case "postgres", "postgresql":
+		return NewPostgresBus(rawURL)
+	default:
+		return nil, fmt.Errorf("unsupported event bus scheme %q", parsed.Scheme)
+	}
+}
+
+var (
+	defaultMu  sync.RWMutex
+	defaultBus Bus
+)
+
+// SetBus sets the bus that Publish sends events to
+func SetBus(bus Bus) {
+	defaultMu.Lock()
+	defer defaultMu.Unlock()
+	defaultBus = bus
+}
+
+// Publish sends an event on the bus set with SetBus. Failures are logged
+// rather than returned, since the change itself has already been saved.
+func Publish(event Event) {
+	defaultMu.RLock()
+	bus := defaultBus
+	defaultMu.RUnlock()
+	if bus == nil {
+		return
+	}
+
+	if err := bus.Publish(event); err != nil {
+		log.Printf("Error publishing %s event: %v", event.Type, err)
+	}
+}
+
+// MemoryBus is an in-process bus, for when the HTTP and WebSocket servers run
+// in the same process
+type MemoryBus struct {
+	mu     sync.RWMutex
+	nextID int
+	subs   map[int]func(Event)
+}
+
+// NewMemoryBus creates an empty in-memory bus
+func NewMemoryBus() *MemoryBus {
+	return &MemoryBus{subs: make(map[int]func(Event))}
+}
+
+// Publish delivers an event to every subscribed handler
+func (b *MemoryBus) Publish(event Event) error {
+	b.mu.RLock()
+	handlers := make([]func(Event), 0, len(b.subs))
+	for _, handler := range b.subs {
+		handlers = append(handlers, handler)
+	}
+	b.mu.RUnlock()
+
+	for _, handler := range handlers {
+		handler(event)
+	}
+	return nil
+}
+
+// Subscribe registers a handler for every event
+func (b *MemoryBus) Subscribe(handler func(Event)) (func(), error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	id := b.nextID
+	b.nextID++
+	b.subs[id] = handler
+
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		delete(b.subs, id)
+	}, nil
+}
+
+// Close is a no-op for the in-memory bus
+func (b *MemoryBus) Close() error {
+	return nil
+}
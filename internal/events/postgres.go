@@ -0,0 +1,173 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// postgresChannel is the NOTIFY channel events are sent on
+const postgresChannel = "space_events"
+
+// PostgresBus sends events with Postgres NOTIFY and receives them with LISTEN.
+// Events published while the listener is reconnecting are missed.
+type PostgresBus struct {
+	dsn string
+
+	pubMu sync.Mutex
+	pub   *pgx.Conn
+
+	subMu    sync.Mutex
+	handlers map[int]func(Event)
+	nextID   int
+	listener context.CancelFunc
+	done     chan struct{}
+}
+
+// NewPostgresBus connects to the database described by the DSN. The listener
+// connection is opened on the first Subscribe.
+func NewPostgresBus(dsn string) (*PostgresBus, error) {
+	pub, err := pgx.Connect(context.Background(), dsn)
+	if err != nil {
+		return nil, err
+	}
+	return &PostgresBus{
+		dsn:      dsn,
+		pub:      pub,
+		handlers: make(map[int]func(Event)),
+	}, nil
+}
+
+// Publish sends an event to every listener of the channel
+func (b *PostgresBus) Publish(event Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	b.pubMu.Lock()
+	defer b.pubMu.Unlock()
+
+	// Reconnect once if the connection was dropped since the last event
+	if b.pub == nil || b.pub.IsClosed() {
+		if b.pub, err = pgx.Connect(ctx, b.dsn); err != nil {
+			return err
+		}
+	}
+	_, err = b.pub.Exec(ctx, "SELECT pg_notify($1, $2)", postgresChannel, string(data))
+	return err
+}
+
+// Subscribe registers a handler for every event
+func (b *PostgresBus) Subscribe(handler func(Event)) (func(), error) {
+	b.subMu.Lock()
+	defer b.subMu.Unlock()
+
+	if b.listener == nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		b.listener = cancel
+		b.done = make(chan struct{})
+		go b.listen(ctx)
+	}
+
+	id := b.nextID
+	b.nextID++
+	b.handlers[id] = handler
+
+	return func() {
+		b.subMu.Lock()
+		defer b.subMu.Unlock()
+		delete(b.handlers, id)
+	}, nil
+}
+
+// listen waits for notifications and reconnects when the connection drops
+func (b *PostgresBus) listen(ctx context.Context) {
+	defer close(b.done)
+
+	backoff := 100 * time.Millisecond
+	for ctx.Err() == nil {
+		err := b.listenOnce(ctx, func() { backoff = 100 * time.Millisecond })
+		if ctx.Err() != nil {
+			return
+		}
+
+		log.Printf("Event bus connection lost: %v", err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		if backoff < 5*time.Second {
+			backoff *= 2
+		}
+	}
+}
+
+// listenOnce opens a listener connection and dispatches notifications until
+// it fails. connected is called once the channel is being listened on.
+func (b *PostgresBus) listenOnce(ctx context.Context, connected func()) error {
+	conn, err := pgx.Connect(ctx, b.dsn)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, "LISTEN "+pgx.Identifier{postgresChannel}.Sanitize()); err != nil {
+		return err
+	}
+	connected()
+
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+
+		var event Event
+		if err := json.Unmarshal([]byte(notification.Payload), &event); err != nil {
+			log.Printf("Error decoding event: %v", err)
+			continue
+		}
+		b.dispatch(event)
+	}
+}
+
+func (b *PostgresBus) dispatch(event Event) {
+	b.subMu.Lock()
+	handlers := make([]func(Event), 0, len(b.handlers))
+	for _, handler := range b.handlers {
+		handlers = append(handlers, handler)
+	}
+	b.subMu.Unlock()
+
+	for _, handler := range handlers {
+		handler(event)
+	}
+}
+
+// Close stops the listener and closes the connections
+func (b *PostgresBus) Close() error {
+	b.subMu.Lock()
+	cancel, done := b.listener, b.done
+	b.listener = nil
+	b.subMu.Unlock()
+	if cancel != nil {
+		cancel()
+		<-done
+	}
+
+	b.pubMu.Lock()
+	defer b.pubMu.Unlock()
+	if b.pub == nil {
+		return nil
+	}
+	return b.pub.Close(context.Background())
+}
@@ -39,10 +39,12 @@ type MapElementInput struct {
 
 // CreateMapRequest represents the create map request
 type CreateMapRequest struct {
-	Thumbnail       string            `json:"thumbnail" binding:"required"`
-	Dimensions      string            `json:"dimensions" binding:"required"`
-	Name            string            `json:"name" binding:"required"`
-	DefaultElements []MapElementInput `json:"defaultElements"`
+	Thumbnail       string              `json:"thumbnail" binding:"required"`
+	Dimensions      string              `json:"dimensions" binding:"required"`
+	Name            string              `json:"name" binding:"required"`
+	DefaultElements []MapElementInput   `json:"defaultElements"`
+	SpawnPoints     []models.SpawnPoint `json:"spawnPoints"`
+	SpawnMode       models.SpawnMode    `json:"spawnMode"`
 }
 
 // CreateElement creates a new element (admin only)
@@ -119,13 +121,20 @@ func CreateMap(c *gin.Context) {
 	width, _ := strconv.Atoi(dims[0])
 	height, _ := strconv.Atoi(dims[1])
 
+	if msg := validateSpawnPoints(req.SpawnPoints, &req.SpawnMode, width, height); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"message": msg})
+		return
+	}
+
 	// Create map with elements
 	mapModel := models.Map{
-		ID:        utils.GenerateCUID(),
-		Name:      req.Name,
-		Width:     width,
-		Height:    height,
-		Thumbnail: req.Thumbnail,
+		ID:          utils.GenerateCUID(),
+		Name:        req.Name,
+		Width:       width,
+		Height:      height,
+		Thumbnail:   req.Thumbnail,
+		SpawnPoints: req.SpawnPoints,
+		SpawnMode:   req.SpawnMode,
 	}
 
 	database.GetDB().Create(&mapModel)
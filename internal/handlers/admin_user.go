@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/genosis18m/Metaverse_go/internal/database"
+	"github.com/genosis18m/Metaverse_go/internal/events"
+	"github.com/genosis18m/Metaverse_go/internal/middleware"
+	"github.com/genosis18m/Metaverse_go/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+// UserRoleRequest represents the change user role request
+type UserRoleRequest struct {
+	Role models.Role `json:"role" binding:"required"`
+}
+
+// SuspendUserRequest represents the suspend user request
+type SuspendUserRequest struct {
+	Reason string `json:"reason"`
+}
+
+// ListUsers lists users, optionally filtered by a username search, role or
+// suspension, with limit and offset paging (admin only)
+func ListUsers(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if limit < 1 || limit > 200 {
+		limit = 50
+	}
+	offset, _ := strconv.Atoi(c.Query("offset"))
+	if offset < 0 {
+		offset = 0
+	}
+
+	query := database.GetDB().Model(&models.User{})
+	if search := strings.TrimSpace(c.Query("q")); search != "" {
+		escaped := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(search)
+		query = query.Where("username ILIKE ?", "%"+escaped+"%")
+	}
+	if role := c.Query("role"); role != "" {
+		query = query.Where("role = ?", role)
+	}
+	switch c.Query("suspended") {
+	case "true":
+		query = query.Where("suspended_at IS NOT NULL")
+	case "false":
+		query = query.Where("suspended_at IS NULL")
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error listing users"})
+		return
+	}
+
+	var users []models.User
+	query.Order("username asc").Limit(limit).Offset(offset).Find(&users)
+
+	c.JSON(http.StatusOK, gin.H{"users": users, "total": total})
+}
+
+// GetUser gets a single user (admin only)
+func GetUser(c *gin.Context) {
+	var user models.User
+	if err := database.GetDB().First(&user, "id = ?", c.Param("userId")).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "User not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+// UpdateUserRole promotes a user to admin or demotes them (admin only).
+// Admins cannot change their own role, so there is always one admin left.
+func UpdateUserRole(c *gin.Context) {
+	var req UserRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil || !req.Role.Valid() {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Role must be Admin or User"})
+		return
+	}
+
+	user, ok := targetUser(c, "change your own role")
+	if !ok {
+		return
+	}
+
+	if err := database.GetDB().Model(&user).Update("role", req.Role).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error updating user"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Role updated"})
+}
+
+// SuspendUser stops a user from signing in, ends their sessions and
+// disconnects them from every space (admin only)
+func SuspendUser(c *gin.Context) {
+	var req SuspendUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil && c.Request.ContentLength > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Validation failed"})
+		return
+	}
+
+	user, ok := targetUser(c, "suspend yourself")
+	if !ok {
+		return
+	}
+
+	if err := database.SuspendUser(user.ID, req.Reason); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error suspending user"})
+		return
+	}
+	events.Publish(events.Event{Type: events.UserSuspended, UserID: user.ID, By: middleware.GetUserID(c)})
+
+	c.JSON(http.StatusOK, gin.H{"message": "User suspended"})
+}
+
+// UnsuspendUser lifts the suspension of a user (admin only)
+func UnsuspendUser(c *gin.Context) {
+	user, ok := targetUser(c, "unsuspend yourself")
+	if !ok {
+		return
+	}
+
+	if err := database.UnsuspendUser(user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error unsuspending user"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "User unsuspended"})
+}
+
+// DeleteUser deletes a user with the spaces they created (admin only)
+func DeleteUser(c *gin.Context) {
+	user, ok := targetUser(c, "delete yourself")
+	if !ok {
+		return
+	}
+
+	adminID := middleware.GetUserID(c)
+	spaceIDs, err := database.DeleteUser(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error deleting user"})
+		return
+	}
+
+	events.Publish(events.Event{Type: events.UserDeleted, UserID: user.ID, By: adminID})
+	for _, spaceID := range spaceIDs {
+		notifySpaceDeleted(spaceID, adminID)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "User deleted"})
+}
+
+// targetUser loads the user named in the URL, refusing actions admins would
+// take on their own account
+func targetUser(c *gin.Context, selfAction string) (models.User, bool) {
+	var user models.User
+	if err := database.GetDB().First(&user, "id = ?", c.Param("userId")).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "User not found"})
+		return user, false
+	}
+	if user.ID == middleware.GetUserID(c) {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "You cannot " + selfAction})
+		return user, false
+	}
+	return user, true
+}
@@ -4,6 +4,7 @@ import (
 	"net/http"
 
 	"github.com/genosis18m/Metaverse_go/internal/database"
+	"github.com/genosis18m/Metaverse_go/internal/middleware"
 	"github.com/genosis18m/Metaverse_go/internal/models"
 	"github.com/genosis18m/Metaverse_go/internal/utils"
 	"github.com/gin-gonic/gin"
@@ -13,7 +14,7 @@ import (
 type SignupRequest struct {
 	Username string `json:"username" binding:"required"`
 	Password string `json:"password" binding:"required"`
-	Type     string `json:"type" binding:"required,oneof=user admin"`
+	Type     string `json:"type" binding:"omitempty,oneof=user admin"`
 }
 
 // SigninRequest represents the signin request body
@@ -37,27 +38,20 @@ func Signup(c *gin.Context) {
 		return
 	}
 
-	// Determine role
-	role := models.RoleUser
-	if req.Type == "admin" {
-		role = models.RoleAdmin
-	}
-
-	// Create user
+	// Create user as a regular user; database.CreateUser decides the final role
 	user := models.User{
 		ID:       utils.GenerateCUID(),
 		Username: req.Username,
 		Password: hashedPassword,
-		Role:     role,
+		Role:     models.RoleUser,
 	}
 
-	result := database.GetDB().Create(&user)
-	if result.Error != nil {
+	if err := database.CreateUser(&user); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"message": "User already exists"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"userId": user.ID})
+	c.JSON(http.StatusOK, gin.H{"userId": user.ID, "role": user.Role})
 }
 
 // Signin handles user login
@@ -82,12 +76,123 @@ func Signin(c *gin.Context) {
 		return
 	}
 
-	// Generate token
-	token, err := utils.GenerateToken(user.ID, string(user.Role))
+	if user.SuspendedAt != nil {
+		c.JSON(http.StatusForbidden, gin.H{"message": "Account suspended"})
+		return
+	}
+
+	// Start a session with an access and a refresh token
+	tokens, err := startSession(c, user)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error generating token"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"token": token})
+	c.JSON(http.StatusOK, tokens)
+}
+
+// RefreshTokenRequest represents the refresh token request body
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refreshToken" binding:"required"`
+}
+
+// TokenResponse carries the tokens of a session. ExpiresIn is the lifetime
+// of the access token in seconds.
+type TokenResponse struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refreshToken"`
+	ExpiresIn    int    `json:"expiresIn"`
+}
+
+// RefreshToken exchanges a refresh token for a new access token and refresh
+// token. Each refresh token works once.
+func RefreshToken(c *gin.Context) {
+	var req RefreshTokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Validation failed"})
+		return
+	}
+
+	session, refreshToken, err := database.RotateRefreshToken(req.RefreshToken)
+	if err == database.ErrInvalidRefreshToken {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "Invalid refresh token"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error refreshing token"})
+		return
+	}
+
+	// The role may have changed since the session started
+	var user models.User
+	if err := database.GetDB().First(&user, "id = ?", session.UserID).Error; err != nil {
+		c.JSON(http.StatusUnauthorized, gin.H{"message": "User not found"})
+		return
+	}
+	if user.SuspendedAt != nil {
+		c.JSON(http.StatusForbidden, gin.H{"message": "Account suspended"})
+		return
+	}
+
+	token, err := utils.GenerateToken(user.ID, string(user.Role), session.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error generating token"})
+		return
+	}
+
+	c.JSON(http.StatusOK, TokenResponse{
+		Token:        token,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(utils.AccessTokenTTL().Seconds()),
+	})
+}
+
+// Logout revokes the access token the request was made with and ends its session
+func Logout(c *gin.Context) {
+	claims := middleware.GetClaims(c)
+	if err := database.RevokeToken(claims); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error logging out"})
+		return
+	}
+	if claims.SessionID != "" {
+		if err := database.RevokeSession(claims.SessionID); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"message": "Error logging out"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out"})
+}
+
+// LogoutAll ends every session of the current user, on every device
+func LogoutAll(c *gin.Context) {
+	if err := database.RevokeToken(middleware.GetClaims(c)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error logging out"})
+		return
+	}
+	if err := database.RevokeUserSessions(middleware.GetUserID(c)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error logging out"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out of all sessions"})
+}
+
+// startSession creates a session for a user who just signed in and issues its tokens
+func startSession(c *gin.Context, user models.User) (TokenResponse, error) {
+	session, refreshToken, err := database.CreateSession(user.ID, c.Request.UserAgent())
+	if err != nil {
+		return TokenResponse{}, err
+	}
+
+	token, err := utils.GenerateToken(user.ID, string(user.Role), session.ID)
+	if err != nil {
+		return TokenResponse{}, err
+	}
+
+	return TokenResponse{
+		Token:        token,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(utils.AccessTokenTTL().Seconds()),
+	}, nil
 }
@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/genosis18m/Metaverse_go/internal/database"
+	"github.com/genosis18m/Metaverse_go/internal/middleware"
+	"github.com/genosis18m/Metaverse_go/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+// DirectMessageResponse represents a private message in the API
+type DirectMessageResponse struct {
+	ID          string  `json:"id"`
+	SenderID    string  `json:"senderId"`
+	RecipientID string  `json:"recipientId"`
+	SpaceID     *string `json:"spaceId"`
+	Message     string  `json:"message"`
+	Timestamp   string  `json:"timestamp"`
+	ReadAt      *string `json:"readAt"`
+}
+
+// ConversationResponse represents a conversation in the conversation list
+type ConversationResponse struct {
+	UserID      string                `json:"userId"`
+	Username    string                `json:"username"`
+	LastMessage DirectMessageResponse `json:"lastMessage"`
+	Unread      int64                 `json:"unread"`
+}
+
+// GetConversations lists the direct message conversations of the current user
+func GetConversations(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+
+	conversations, err := database.ListConversations(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error fetching conversations"})
+		return
+	}
+
+	response := make([]ConversationResponse, len(conversations))
+	for i, conv := range conversations {
+		response[i] = ConversationResponse{
+			UserID:      conv.Peer.ID,
+			Username:    conv.Peer.Username,
+			LastMessage: toDirectMessageResponse(conv.LastMessage),
+			Unread:      conv.Unread,
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"conversations": response})
+}
+
+// GetDirectMessages returns a page of the direct messages with another user.
+// Query parameters: before or after (message ID cursor) and limit.
+func GetDirectMessages(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+	peerID := c.Param("userId")
+
+	query := database.MessageQuery{
+		Before: c.Query("before"),
+		After:  c.Query("after"),
+	}
+	if query.Before != "" && query.After != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Use either before or after"})
+		return
+	}
+	if limit := c.Query("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 || n > database.MaxMessageLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Limit must be between 1 and " + strconv.Itoa(database.MaxMessageLimit)})
+			return
+		}
+		query.Limit = n
+	}
+
+	messages, hasMore, err := database.ListDirectMessages(userID, peerID, query)
+	if errors.Is(err, database.ErrCursorNotFound) {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Cursor message not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error fetching messages"})
+		return
+	}
+
+	response := make([]DirectMessageResponse, len(messages))
+	for i, m := range messages {
+		response[i] = toDirectMessageResponse(m)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"messages": response, "hasMore": hasMore})
+}
+
+// MarkDirectMessagesRead marks the messages from another user up to messageId as read
+func MarkDirectMessagesRead(c *gin.Context) {
+	var req struct {
+		MessageID string `json:"messageId" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invalid request"})
+		return
+	}
+
+	_, marked, err := database.MarkDirectMessagesRead(middleware.GetUserID(c), c.Param("userId"), req.MessageID)
+	if errors.Is(err, database.ErrCursorNotFound) {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Message not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error marking messages read"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"marked": marked})
+}
+
+func toDirectMessageResponse(m models.DirectMessage) DirectMessageResponse {
+	response := DirectMessageResponse{
+		ID:          m.ID,
+		SenderID:    m.SenderID,
+		RecipientID: m.RecipientID,
+		SpaceID:     m.SpaceID,
+		Message:     m.Text,
+		Timestamp:   m.CreatedAt.Format(time.RFC3339),
+	}
+	if m.ReadAt != nil {
+		readAt := m.ReadAt.Format(time.RFC3339)
+		response.ReadAt = &readAt
+	}
+	return response
+}
@@ -0,0 +1,14 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/genosis18m/Metaverse_go/internal/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// GetJWKS publishes the public keys access tokens are signed with
+func GetJWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, utils.PublicJWKS())
+}
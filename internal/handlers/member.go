@@ -0,0 +1,274 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/genosis18m/Metaverse_go/internal/database"
+	"github.com/genosis18m/Metaverse_go/internal/middleware"
+	"github.com/genosis18m/Metaverse_go/internal/models"
+	"github.com/genosis18m/Metaverse_go/internal/utils"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// errInviteInvalid is returned when an invite is unknown, expired or used up
+var errInviteInvalid = errors.New("invite is invalid")
+
+// MemberRoleRequest represents the change member role request body
+type MemberRoleRequest struct {
+	Role models.SpaceRole `json:"role" binding:"required"`
+}
+
+// CreateInviteRequest represents the create invite request body. ExpiresIn is
+// in seconds; zero means the invite does not expire. MaxUses of zero is unlimited.
+type CreateInviteRequest struct {
+	Role      models.SpaceRole `json:"role"`
+	ExpiresIn int              `json:"expiresIn"`
+	MaxUses   int              `json:"maxUses"`
+}
+
+// MemberResponse represents a member of a space
+type MemberResponse struct {
+	UserID   string           `json:"userId"`
+	Username string           `json:"username"`
+	Role     models.SpaceRole `json:"role"`
+}
+
+// GetMembers lists the members of a space, owner first
+func GetMembers(c *gin.Context) {
+	space, ok := memberSpace(c, models.SpaceRoleGuest)
+	if !ok {
+		return
+	}
+
+	var owner models.User
+	database.GetDB().First(&owner, "id = ?", space.CreatorID)
+
+	var members []models.SpaceMember
+	database.GetDB().Preload("User").Where("space_id = ?", space.ID).Order("created_at asc").Find(&members)
+
+	response := []MemberResponse{{UserID: space.CreatorID, Username: owner.Username, Role: models.SpaceRoleOwner}}
+	for _, m := range members {
+		username := ""
+		if m.User != nil {
+			username = m.User.Username
+		}
+		response = append(response, MemberResponse{UserID: m.UserID, Username: username, Role: m.Role})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"members": response})
+}
+
+// UpdateMemberRole changes the role of a member or adds a user as a member
+func UpdateMemberRole(c *gin.Context) {
+	space, ok := ownedSpace(c)
+	if !ok {
+		return
+	}
+
+	var req MemberRoleRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Validation failed"})
+		return
+	}
+	if !req.Role.Valid() || req.Role == models.SpaceRoleOwner {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Role must be editor, member or guest"})
+		return
+	}
+
+	userID := c.Param("userId")
+	if userID == space.CreatorID {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "The owner's role cannot be changed"})
+		return
+	}
+	var user models.User
+	if err := database.GetDB().First(&user, "id = ?", userID).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "User not found"})
+		return
+	}
+
+	member := models.SpaceMember{SpaceID: space.ID, UserID: userID, Role: req.Role, CreatedAt: time.Now()}
+	err := database.GetDB().
+		Where(models.SpaceMember{SpaceID: space.ID, UserID: userID}).
+		Assign(models.SpaceMember{Role: req.Role}).
+		FirstOrCreate(&member).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error updating member"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Member updated"})
+}
+
+// RemoveMember removes a member from a space. Members can remove themselves.
+func RemoveMember(c *gin.Context) {
+	spaceID := c.Param("spaceId")
+	userID := c.Param("userId")
+	currentUserID := middleware.GetUserID(c)
+
+	var space models.Space
+	if err := database.GetDB().First(&space, "id = ?", spaceID).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Space not found"})
+		return
+	}
+	if userID != currentUserID && !database.HasSpaceRole(space, currentUserID, models.SpaceRoleOwner) {
+		c.JSON(http.StatusForbidden, gin.H{"message": "Unauthorized"})
+		return
+	}
+
+	result := database.GetDB().Delete(&models.SpaceMember{}, "space_id = ? AND user_id = ?", spaceID, userID)
+	if result.Error != nil || result.RowsAffected == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Member not found"})
+		return
+	}
+	notifySpaceAccessChanged(spaceID, currentUserID)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Member removed"})
+}
+
+// GetInvites lists the invites of a space
+func GetInvites(c *gin.Context) {
+	space, ok := ownedSpace(c)
+	if !ok {
+		return
+	}
+
+	var invites []models.SpaceInvite
+	database.GetDB().Where("space_id = ?", space.ID).Order("created_at desc").Find(&invites)
+
+	c.JSON(http.StatusOK, gin.H{"invites": invites})
+}
+
+// CreateInvite creates an invite link to a space
+func CreateInvite(c *gin.Context) {
+	space, ok := ownedSpace(c)
+	if !ok {
+		return
+	}
+
+	var req CreateInviteRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Validation failed"})
+		return
+	}
+	if req.Role == "" {
+		req.Role = models.SpaceRoleMember
+	}
+	if !req.Role.Valid() || req.Role == models.SpaceRoleOwner {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Role must be editor, member or guest"})
+		return
+	}
+	if req.ExpiresIn < 0 || req.MaxUses < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Expiry and max uses must not be negative"})
+		return
+	}
+
+	invite := models.SpaceInvite{
+		ID:          utils.GenerateCUID(),
+		SpaceID:     space.ID,
+		Token:       utils.GenerateRandomString(32),
+		Role:        req.Role,
+		CreatedByID: middleware.GetUserID(c),
+		MaxUses:     req.MaxUses,
+	}
+	if req.ExpiresIn > 0 {
+		expiresAt := time.Now().Add(time.Duration(req.ExpiresIn) * time.Second)
+		invite.ExpiresAt = &expiresAt
+	}
+	if err := database.GetDB().Create(&invite).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error creating invite"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"id": invite.ID, "token": invite.Token, "expiresAt": invite.ExpiresAt})
+}
+
+// DeleteInvite revokes an invite
+func DeleteInvite(c *gin.Context) {
+	space, ok := ownedSpace(c)
+	if !ok {
+		return
+	}
+
+	result := database.GetDB().Delete(&models.SpaceInvite{}, "id = ? AND space_id = ?", c.Param("inviteId"), space.ID)
+	if result.Error != nil || result.RowsAffected == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invite not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Invite deleted"})
+}
+
+// AcceptInvite makes the current user a member of the space an invite is for.
+// Users who already have a higher role keep it.
+func AcceptInvite(c *gin.Context) {
+	userID := middleware.GetUserID(c)
+	var spaceID string
+	var role models.SpaceRole
+
+	err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		var invite models.SpaceInvite
+		if err := tx.First(&invite, "token = ?", c.Param("token")).Error; err != nil {
+			return errInviteInvalid
+		}
+		if invite.ExpiresAt != nil && time.Now().After(*invite.ExpiresAt) {
+			return errInviteInvalid
+		}
+
+		var space models.Space
+		if err := tx.First(&space, "id = ?", invite.SpaceID).Error; err != nil {
+			return errInviteInvalid
+		}
+		spaceID = space.ID
+
+		current, isMember := database.SpaceRole(space, userID)
+		if isMember && current.AtLeast(invite.Role) {
+			role = current
+			return nil
+		}
+
+		// Count the use atomically so MaxUses holds under concurrent accepts
+		used := tx.Model(&models.SpaceInvite{}).
+			Where("id = ? AND (max_uses = 0 OR uses < max_uses)", invite.ID).
+			Update("uses", gorm.Expr("uses + 1"))
+		if used.Error != nil {
+			return used.Error
+		}
+		if used.RowsAffected == 0 {
+			return errInviteInvalid
+		}
+
+		role = invite.Role
+		member := models.SpaceMember{SpaceID: space.ID, UserID: userID, Role: role, CreatedAt: time.Now()}
+		return tx.Where(models.SpaceMember{SpaceID: space.ID, UserID: userID}).
+			Assign(models.SpaceMember{Role: role}).
+			FirstOrCreate(&member).Error
+	})
+	if err == errInviteInvalid {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Invite is invalid or expired"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error accepting invite"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"spaceId": spaceID, "role": role})
+}
+
+// memberSpace loads the space named in the URL and checks that the current
+// user has at least the given role in it
+func memberSpace(c *gin.Context, role models.SpaceRole) (models.Space, bool) {
+	var space models.Space
+	if err := database.GetDB().First(&space, "id = ?", c.Param("spaceId")).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Space not found"})
+		return space, false
+	}
+	if !database.HasSpaceRole(space, middleware.GetUserID(c), role) {
+		c.JSON(http.StatusForbidden, gin.H{"message": "Unauthorized"})
+		return space, false
+	}
+	return space, true
+}
@@ -0,0 +1,232 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/genosis18m/Metaverse_go/internal/database"
+	"github.com/genosis18m/Metaverse_go/internal/models"
+	"github.com/genosis18m/Metaverse_go/internal/utils"
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// withTestDB points the database package at the Postgres database of
+// TEST_DATABASE_URL and migrates it. Tests are skipped when it is not set.
+func withTestDB(t *testing.T) {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	saved := database.DB
+	database.DB = db
+	t.Cleanup(func() { database.DB = saved })
+	if err := database.AutoMigrate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// createTestUser stores a user with a unique name
+func createTestUser(t *testing.T) models.User {
+	t.Helper()
+	user := models.User{ID: utils.GenerateCUID(), Username: "user-" + utils.GenerateRandomString(10), Role: models.RoleUser}
+	if err := database.DB.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+// createTestSpace stores a 20×20 space created by a user
+func createTestSpace(t *testing.T, creatorID string) models.Space {
+	t.Helper()
+	space := models.Space{ID: utils.GenerateCUID(), Name: "test space", Width: 20, Height: 20, CreatorID: creatorID}
+	if err := database.DB.Create(&space).Error; err != nil {
+		t.Fatal(err)
+	}
+	return space
+}
+
+// addTestMember gives a user a role in a space
+func addTestMember(t *testing.T, spaceID, userID string, role models.SpaceRole) {
+	t.Helper()
+	member := models.SpaceMember{SpaceID: spaceID, UserID: userID, Role: role, CreatedAt: time.Now()}
+	if err := database.DB.Create(&member).Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+// newMemberRouter returns a router with the member and invite routes that
+// takes the current user from the X-User-Id header
+func newMemberRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("userId", c.GetHeader("X-User-Id"))
+	})
+	router.PUT("/space/:spaceId/members/:userId", UpdateMemberRole)
+	router.DELETE("/space/:spaceId/members/:userId", RemoveMember)
+	router.POST("/space/:spaceId/invites", CreateInvite)
+	router.POST("/space/invites/:token/accept", AcceptInvite)
+	return router
+}
+
+// serveAs sends a request to the router as a user
+func serveAs(router *gin.Engine, userID, method, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-User-Id", userID)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+// createTestInvite stores an invite to a space
+func createTestInvite(t *testing.T, spaceID, createdByID string, role models.SpaceRole, maxUses int, expiresAt *time.Time) models.SpaceInvite {
+	t.Helper()
+	invite := models.SpaceInvite{
+		ID:          utils.GenerateCUID(),
+		SpaceID:     spaceID,
+		Token:       utils.GenerateRandomString(32),
+		Role:        role,
+		CreatedByID: createdByID,
+		MaxUses:     maxUses,
+		ExpiresAt:   expiresAt,
+	}
+	if err := database.DB.Create(&invite).Error; err != nil {
+		t.Fatal(err)
+	}
+	return invite
+}
+
+func TestAcceptInvite(t *testing.T) {
+	withTestDB(t)
+	router := newMemberRouter()
+	creator, first, second := createTestUser(t), createTestUser(t), createTestUser(t)
+	space := createTestSpace(t, creator.ID)
+	invite := createTestInvite(t, space.ID, creator.ID, models.SpaceRoleEditor, 1, nil)
+
+	w := serveAs(router, first.ID, http.MethodPost, "/space/invites/"+invite.Token+"/accept", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("accept status = %d: %s", w.Code, w.Body)
+	}
+	var accepted struct {
+		SpaceID string           `json:"spaceId"`
+		Role    models.SpaceRole `json:"role"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &accepted)
+	if accepted.SpaceID != space.ID || accepted.Role != models.SpaceRoleEditor {
+		t.Fatalf("accepted = %+v, want editor of the space", accepted)
+	}
+	if role, _ := database.SpaceRole(space, first.ID); role != models.SpaceRoleEditor {
+		t.Fatalf("role after accepting = %q, want editor", role)
+	}
+
+	// The single use is spent
+	if w := serveAs(router, second.ID, http.MethodPost, "/space/invites/"+invite.Token+"/accept", ""); w.Code != http.StatusBadRequest {
+		t.Fatalf("second accept status = %d, want 400", w.Code)
+	}
+	if _, member := database.SpaceRole(space, second.ID); member {
+		t.Fatal("a used-up invite still added a member")
+	}
+}
+
+func TestAcceptInviteKeepsHigherRole(t *testing.T) {
+	withTestDB(t)
+	router := newMemberRouter()
+	creator, editor := createTestUser(t), createTestUser(t)
+	space := createTestSpace(t, creator.ID)
+	addTestMember(t, space.ID, editor.ID, models.SpaceRoleEditor)
+	invite := createTestInvite(t, space.ID, creator.ID, models.SpaceRoleGuest, 1, nil)
+
+	for _, userID := range []string{editor.ID, creator.ID} {
+		if w := serveAs(router, userID, http.MethodPost, "/space/invites/"+invite.Token+"/accept", ""); w.Code != http.StatusOK {
+			t.Fatalf("accept status = %d: %s", w.Code, w.Body)
+		}
+	}
+	if role, _ := database.SpaceRole(space, editor.ID); role != models.SpaceRoleEditor {
+		t.Fatalf("editor was demoted to %q", role)
+	}
+
+	var stored models.SpaceInvite
+	if err := database.DB.First(&stored, "id = ?", invite.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if stored.Uses != 0 {
+		t.Fatalf("invite uses = %d, want none spent on users who already had a higher role", stored.Uses)
+	}
+}
+
+func TestAcceptExpiredOrUnknownInvite(t *testing.T) {
+	withTestDB(t)
+	router := newMemberRouter()
+	creator, user := createTestUser(t), createTestUser(t)
+	space := createTestSpace(t, creator.ID)
+	expired := time.Now().Add(-time.Minute)
+	invite := createTestInvite(t, space.ID, creator.ID, models.SpaceRoleMember, 0, &expired)
+
+	for _, token := range []string{invite.Token, "unknown"} {
+		if w := serveAs(router, user.ID, http.MethodPost, "/space/invites/"+token+"/accept", ""); w.Code != http.StatusBadRequest {
+			t.Fatalf("accepting %q: status = %d, want 400", token, w.Code)
+		}
+	}
+	if _, member := database.SpaceRole(space, user.ID); member {
+		t.Fatal("an expired invite added a member")
+	}
+}
+
+func TestOwnerMembersManageTheSpace(t *testing.T) {
+	withTestDB(t)
+	router := newMemberRouter()
+	creator, owner, editor, guest := createTestUser(t), createTestUser(t), createTestUser(t), createTestUser(t)
+	space := createTestSpace(t, creator.ID)
+	addTestMember(t, space.ID, owner.ID, models.SpaceRoleOwner)
+	addTestMember(t, space.ID, editor.ID, models.SpaceRoleEditor)
+	addTestMember(t, space.ID, guest.ID, models.SpaceRoleGuest)
+
+	for _, c := range []struct {
+		name   string
+		userID string
+		want   int
+	}{
+		{"creator", creator.ID, http.StatusOK},
+		{"owner", owner.ID, http.StatusOK},
+		{"editor", editor.ID, http.StatusForbidden},
+	} {
+		if w := serveAs(router, c.userID, http.MethodPost, "/space/"+space.ID+"/invites", `{"role":"guest"}`); w.Code != c.want {
+			t.Errorf("%s creating an invite: status = %d, want %d", c.name, w.Code, c.want)
+		}
+	}
+
+	if w := serveAs(router, editor.ID, http.MethodPut, "/space/"+space.ID+"/members/"+guest.ID, `{"role":"member"}`); w.Code != http.StatusForbidden {
+		t.Fatalf("editor changing a role: status = %d, want 403", w.Code)
+	}
+	if w := serveAs(router, owner.ID, http.MethodPut, "/space/"+space.ID+"/members/"+guest.ID, `{"role":"member"}`); w.Code != http.StatusOK {
+		t.Fatalf("owner changing a role: status = %d: %s", w.Code, w.Body)
+	}
+	if role, _ := database.SpaceRole(space, guest.ID); role != models.SpaceRoleMember {
+		t.Fatalf("role = %q, want member", role)
+	}
+
+	if w := serveAs(router, editor.ID, http.MethodDelete, "/space/"+space.ID+"/members/"+guest.ID, ""); w.Code != http.StatusForbidden {
+		t.Fatalf("editor removing a member: status = %d, want 403", w.Code)
+	}
+	if w := serveAs(router, owner.ID, http.MethodDelete, "/space/"+space.ID+"/members/"+guest.ID, ""); w.Code != http.StatusOK {
+		t.Fatalf("owner removing a member: status = %d: %s", w.Code, w.Body)
+	}
+	if w := serveAs(router, editor.ID, http.MethodDelete, "/space/"+space.ID+"/members/"+editor.ID, ""); w.Code != http.StatusOK {
+		t.Fatalf("editor leaving: status = %d: %s", w.Code, w.Body)
+	}
+}
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/genosis18m/Metaverse_go/internal/database"
+	"github.com/genosis18m/Metaverse_go/internal/middleware"
+	"github.com/genosis18m/Metaverse_go/internal/models"
+	"github.com/gin-gonic/gin"
+)
+
+// MessageResponse represents a chat message in the history API
+type MessageResponse struct {
+	ID        string           `json:"id"`
+	UserID    string           `json:"userId"`
+	Username  string           `json:"username"`
+	Message   string           `json:"message"`
+	Scope     models.ChatScope `json:"scope"`
+	Timestamp string           `json:"timestamp"`
+	EditedAt  *string          `json:"editedAt,omitempty"`
+}
+
+// GetMessages returns a page of the chat history of a space, leaving out
+// nearby and zone messages the current user did not receive.
+// Query parameters: before or after (message ID cursor), limit, and q to search.
+func GetMessages(c *gin.Context) {
+	spaceID := c.Param("spaceId")
+
+	var space models.Space
+	if err := database.GetDB().First(&space, "id = ?", spaceID).Error; err != nil || !database.CanAccessSpace(space, middleware.GetUserID(c)) {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Space not found"})
+		return
+	}
+
+	query := database.MessageQuery{
+		Before:   c.Query("before"),
+		After:    c.Query("after"),
+		Search:   c.Query("q"),
+		ViewerID: middleware.GetUserID(c),
+	}
+	if query.Before != "" && query.After != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Use either before or after"})
+		return
+	}
+	if limit := c.Query("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 || n > database.MaxMessageLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Limit must be between 1 and " + strconv.Itoa(database.MaxMessageLimit)})
+			return
+		}
+		query.Limit = n
+	}
+
+	messages, hasMore, err := database.ListMessages(spaceID, query)
+	if errors.Is(err, database.ErrCursorNotFound) {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Cursor message not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error fetching messages"})
+		return
+	}
+
+	response := make([]MessageResponse, len(messages))
+	for i, m := range messages {
+		username := m.User.Username
+		if username == "" {
+			username = m.UserID // fallback to ID
+		}
+		response[i] = MessageResponse{
+			ID:        m.ID,
+			UserID:    m.UserID,
+			Username:  username,
+			Message:   m.Text,
+			Scope:     m.Scope,
+			Timestamp: m.CreatedAt.Format(time.RFC3339),
+		}
+		if m.EditedAt != nil {
+			editedAt := m.EditedAt.Format(time.RFC3339)
+			response[i].EditedAt = &editedAt
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"messages": response, "hasMore": hasMore})
+}
@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+
+	"github.com/genosis18m/Metaverse_go/internal/events"
+	"github.com/genosis18m/Metaverse_go/internal/models"
+)
+
+// notifySpaceChanged tells the WebSocket servers that the layout of a space
+// changed so they can refresh the occupancy grid and zones of the room
+func notifySpaceChanged(spaceID string) {
+	events.Publish(events.Event{Type: events.SpaceChanged, SpaceID: spaceID})
+}
+
+// notifySpaceAccessChanged tells the WebSocket servers that who may access a
+// space changed so they can disconnect the users who lost access
+func notifySpaceAccessChanged(spaceID, userID string) {
+	events.Publish(events.Event{Type: events.SpaceAccessChanged, SpaceID: spaceID, By: userID})
+}
+
+// notifyElementChanged tells the WebSocket servers that an element of a space
+// was added, updated or removed, so they can push the change to the room
+func notifyElementChanged(eventType events.Type, element models.SpaceElement, userID string) {
+	data, err := json.Marshal(elementResponse(element))
+	if err != nil {
+		log.Printf("Error encoding element event: %v", err)
+		return
+	}
+	events.Publish(events.Event{Type: eventType, SpaceID: element.SpaceID, By: userID, Element: data})
+}
+
+// notifySpaceDeleted tells the WebSocket servers to close the room of a deleted space
+func notifySpaceDeleted(spaceID, userID string) {
+	events.Publish(events.Event{Type: events.SpaceDeleted, SpaceID: spaceID, By: userID})
+}
@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/genosis18m/Metaverse_go/internal/database"
+	"github.com/genosis18m/Metaverse_go/internal/models"
+	"github.com/genosis18m/Metaverse_go/internal/oidc"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// oidcCookiePath limits the login state cookie to the auth routes
+	oidcCookiePath = "/api/v1/auth"
+	// oidcCookieMaxAge is how long a login at the provider may take, in seconds
+	oidcCookieMaxAge = 600
+)
+
+// GetOIDCProviders lists the providers users can sign in with
+func GetOIDCProviders(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"providers": oidc.Names()})
+}
+
+// OIDCLogin redirects to the login page of the provider in the URL. The
+// state, nonce and PKCE verifier are kept in a short-lived cookie, which ties
+// the callback to the browser that started the login.
+func OIDCLogin(c *gin.Context) {
+	provider, err := oidc.Get(c.Param("provider"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Unknown login provider"})
+		return
+	}
+
+	req, err := oidc.NewAuthRequest()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error starting login"})
+		return
+	}
+	authURL, err := provider.AuthURL(req)
+	if err != nil {
+		log.Printf("Error discovering OIDC provider %s: %v", provider.Name, err)
+		c.JSON(http.StatusBadGateway, gin.H{"message": "Login provider unavailable"})
+		return
+	}
+
+	value, _ := json.Marshal(req)
+	setOIDCCookie(c, provider.Name, base64.RawURLEncoding.EncodeToString(value), oidcCookieMaxAge)
+	c.Redirect(http.StatusTemporaryRedirect, authURL)
+}
+
+// OIDCCallback handles the redirect back from a provider: it checks the
+// state, redeems the code, verifies the ID token and signs the linked user in
+func OIDCCallback(c *gin.Context) {
+	frontendURL := os.Getenv("FRONTEND_URL")
+	if frontendURL == "" {
+		frontendURL = "http://localhost:5173" // fallback for local development
+	}
+	fail := func(reason string) {
+		c.Redirect(http.StatusTemporaryRedirect, frontendURL+"?error="+reason)
+	}
+
+	provider, err := oidc.Get(c.Param("provider"))
+	if err != nil {
+		fail("unknown_provider")
+		return
+	}
+
+	// The login state is single use
+	req, stateErr := oidcAuthRequest(c, provider.Name)
+	setOIDCCookie(c, provider.Name, "", -1)
+
+	if c.Query("error") != "" {
+		fail("provider_error")
+		return
+	}
+	if stateErr != nil || subtle.ConstantTimeCompare([]byte(c.Query("state")), []byte(req.State)) != 1 {
+		fail("invalid_state")
+		return
+	}
+	code := c.Query("code")
+	if code == "" {
+		fail("no_code")
+		return
+	}
+
+	claims, err := provider.Exchange(c.Request.Context(), code, req)
+	if err != nil {
+		log.Printf("Error signing in with %s: %v", provider.Name, err)
+		fail("token_exchange_failed")
+		return
+	}
+
+	identity := models.UserIdentity{
+		Provider:      provider.Name,
+		Subject:       claims.Subject,
+		Email:         claims.Email,
+		EmailVerified: bool(claims.EmailVerified),
+	}
+	user, err := database.UserForIdentity(identity, oidcUsername(claims))
+	if err != nil {
+		fail("user_creation_failed")
+		return
+	}
+
+	if user.SuspendedAt != nil {
+		fail("account_suspended")
+		return
+	}
+
+	// Start a session with an access and a refresh token
+	tokens, err := startSession(c, user)
+	if err != nil {
+		fail("jwt_generation_failed")
+		return
+	}
+
+	// Redirect to frontend with tokens in the fragment, which browsers never
+	// send to servers, so they stay out of access logs and Referer headers
+	fragment := url.Values{
+		"token":        {tokens.Token},
+		"refreshToken": {tokens.RefreshToken},
+		"userId":       {user.ID},
+	}
+	c.Header("Cache-Control", "no-store")
+	c.Redirect(http.StatusTemporaryRedirect, frontendURL+"/oauth-callback#"+fragment.Encode())
+}
+
+// GoogleLogin and GoogleCallback keep the original Google routes working,
+// since their redirect URL is registered with Google
+func GoogleLogin(c *gin.Context) {
+	c.Params = append(c.Params, gin.Param{Key: "provider", Value: "google"})
+	OIDCLogin(c)
+}
+
+// GoogleCallback handles the redirect back from Google on the original route
+func GoogleCallback(c *gin.Context) {
+	c.Params = append(c.Params, gin.Param{Key: "provider", Value: "google"})
+	OIDCCallback(c)
+}
+
+func setOIDCCookie(c *gin.Context, provider, value string, maxAge int) {
+	// Lax, since the callback is a top-level navigation from the provider
+	c.SetSameSite(http.SameSiteLaxMode)
+	secure := c.Request.TLS != nil || c.GetHeader("X-Forwarded-Proto") == "https"
+	c.SetCookie("oidc_"+provider, value, maxAge, oidcCookiePath, "", secure, true)
+}
+
+func oidcAuthRequest(c *gin.Context, provider string) (oidc.AuthRequest, error) {
+	var req oidc.AuthRequest
+	value, err := c.Cookie("oidc_" + provider)
+	if err != nil {
+		return req, err
+	}
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return req, err
+	}
+	if err := json.Unmarshal(data, &req); err != nil {
+		return req, err
+	}
+	if req.State == "" || req.Nonce == "" || req.Verifier == "" {
+		return req, errors.New("incomplete login state")
+	}
+	return req, nil
+}
+
+// oidcUsername picks the username a new user is created with: the preferred
+// username, or the part of the email before the @
+func oidcUsername(claims *oidc.Claims) string {
+	username := claims.PreferredUsername
+	if username == "" {
+		username, _, _ = strings.Cut(claims.Email, "@")
+	}
+	username = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '_', r == '-':
+			return r
+		}
+		return -1
+	}, username)
+	if username == "" {
+		username = "user"
+	}
+	if len(username) > 32 {
+		username = username[:32]
+	}
+	return username
+}
@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/genosis18m/Metaverse_go/internal/oidc"
+	"github.com/gin-gonic/gin"
+)
+
+// newOIDCRouter registers a provider whose discovery document is served
+// locally and returns a router with the login routes
+func newOIDCRouter(t *testing.T) *gin.Engine {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	t.Setenv("FRONTEND_URL", "http://frontend.test")
+
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(oidc.Discovery{
+			Issuer:                srv.URL,
+			AuthorizationEndpoint: srv.URL + "/authorize",
+			TokenEndpoint:         srv.URL + "/token",
+			JWKSURI:               srv.URL + "/jwks",
+		})
+	}))
+	t.Cleanup(srv.Close)
+	oidc.Register(oidc.NewProvider(oidc.Config{
+		Name:        "handlertest",
+		Issuer:      srv.URL,
+		ClientID:    "client-id",
+		RedirectURL: "http://app.test/api/v1/auth/oidc/handlertest/callback",
+	}, srv.Client()))
+
+	router := gin.New()
+	router.GET("/api/v1/auth/oidc/:provider", OIDCLogin)
+	router.GET("/api/v1/auth/oidc/:provider/callback", OIDCCallback)
+	return router
+}
+
+// startLogin follows the login route and returns the state sent to the
+// provider and the cookie that keeps the login secrets
+func startLogin(t *testing.T, router *gin.Engine) (string, *http.Cookie) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/auth/oidc/handlertest", nil))
+	if w.Code != http.StatusTemporaryRedirect {
+		t.Fatalf("login status = %d: %s", w.Code, w.Body)
+	}
+
+	location, _ := url.Parse(w.Header().Get("Location"))
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || !cookies[0].HttpOnly || cookies[0].Path != "/api/v1/auth" {
+		t.Fatalf("login cookies = %+v", cookies)
+	}
+	return location.Query().Get("state"), cookies[0]
+}
+
+func callback(router *gin.Engine, query string, cookie *http.Cookie) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/auth/oidc/handlertest/callback?"+query, nil)
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestOIDCCallbackChecksState(t *testing.T) {
+	router := newOIDCRouter(t)
+	state, cookie := startLogin(t, router)
+
+	for name, tc := range map[string]struct {
+		query  string
+		cookie *http.Cookie
+		want   string
+	}{
+		"state mismatch":    {"state=forged&code=abc", cookie, "http://frontend.test?error=invalid_state"},
+		"no login cookie":   {"state=" + url.QueryEscape(state) + "&code=abc", nil, "http://frontend.test?error=invalid_state"},
+		"provider error":    {"error=access_denied&state=" + url.QueryEscape(state), cookie, "http://frontend.test?error=provider_error"},
+		"state but no code": {"state=" + url.QueryEscape(state), cookie, "http://frontend.test?error=no_code"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			w := callback(router, tc.query, tc.cookie)
+			if location := w.Header().Get("Location"); location != tc.want {
+				t.Fatalf("redirected to %q, want %q", location, tc.want)
+			}
+		})
+	}
+}
+
+func TestOIDCCallbackClearsLoginCookie(t *testing.T) {
+	router := newOIDCRouter(t)
+	_, cookie := startLogin(t, router)
+
+	w := callback(router, "state=forged", cookie)
+	cleared := w.Result().Cookies()
+	if len(cleared) != 1 || cleared[0].Name != cookie.Name || cleared[0].MaxAge >= 0 {
+		t.Fatalf("callback cookies = %+v, want the login cookie removed", cleared)
+	}
+}
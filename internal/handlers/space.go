@@ -6,6 +6,7 @@ import (
 	"strings"
 
 	"github.com/genosis18m/Metaverse_go/internal/database"
+	"github.com/genosis18m/Metaverse_go/internal/events"
 	"github.com/genosis18m/Metaverse_go/internal/middleware"
 	"github.com/genosis18m/Metaverse_go/internal/models"
 	"github.com/genosis18m/Metaverse_go/internal/utils"
@@ -15,9 +16,18 @@ import (
 
 // CreateSpaceRequest represents the create space request body
 type CreateSpaceRequest struct {
-	Name       string  `json:"name" binding:"required"`
-	Dimensions string  `json:"dimensions" binding:"required"`
-	MapID      *string `json:"mapId"`
+	Name            string                 `json:"name" binding:"required"`
+	Dimensions      string                 `json:"dimensions" binding:"required"`
+	MapID           *string                `json:"mapId"`
+	ForgetPositions bool                   `json:"forgetPositions"`
+	Visibility      models.SpaceVisibility `json:"visibility"`
+}
+
+// SpaceSettingsRequest represents the update space settings request body.
+// Settings left out are unchanged.
+type SpaceSettingsRequest struct {
+	ForgetPositions *bool                   `json:"forgetPositions"`
+	Visibility      *models.SpaceVisibility `json:"visibility"`
 }
 
 // AddElementRequest represents the add element to space request
@@ -26,6 +36,7 @@ type AddElementRequest struct {
 	ElementID string `json:"elementId" binding:"required"`
 	X         int    `json:"x" binding:"required"`
 	Y         int    `json:"y" binding:"required"`
+	Rotation  int    `json:"rotation"`
 }
 
 // DeleteElementRequest represents the delete element request
@@ -33,6 +44,75 @@ type DeleteElementRequest struct {
 	ID string `json:"id" binding:"required"`
 }
 
+// MoveElementRequest represents the move and rotate element request.
+// Fields left out keep their current value.
+type MoveElementRequest struct {
+	X        *int `json:"x"`
+	Y        *int `json:"y"`
+	Rotation *int `json:"rotation"`
+}
+
+// ElementDetail describes the element placed in a space
+type ElementDetail struct {
+	ID       string `json:"id"`
+	ImageURL string `json:"imageUrl"`
+	Width    int    `json:"width"`
+	Height   int    `json:"height"`
+	Static   bool   `json:"static"`
+}
+
+// ElementResponse represents an element placed in a space
+type ElementResponse struct {
+	ID       string        `json:"id"`
+	Element  ElementDetail `json:"element"`
+	X        int           `json:"x"`
+	Y        int           `json:"y"`
+	Rotation int           `json:"rotation"`
+}
+
+func elementResponse(e models.SpaceElement) ElementResponse {
+	response := ElementResponse{ID: e.ID, X: e.X, Y: e.Y, Rotation: e.Rotation}
+	if e.Element != nil {
+		response.Element = ElementDetail{
+			ID:       e.Element.ID,
+			ImageURL: e.Element.ImageURL,
+			Width:    e.Element.Width,
+			Height:   e.Element.Height,
+			Static:   e.Element.Static,
+		}
+	}
+	return response
+}
+
+// ZoneRequest represents the create and update zone request body
+type ZoneRequest struct {
+	Name         string             `json:"name" binding:"required"`
+	Shape        models.ZoneShape   `json:"shape"`
+	X            int                `json:"x"`
+	Y            int                `json:"y"`
+	Width        int                `json:"width"`
+	Height       int                `json:"height"`
+	Points       []models.ZonePoint `json:"points"`
+	PrivateChat  bool               `json:"privateChat"`
+	MaxOccupancy int                `json:"maxOccupancy"`
+	Muted        bool               `json:"muted"`
+}
+
+// PortalRequest represents the create portal request body
+type PortalRequest struct {
+	X             *int   `json:"x" binding:"required"`
+	Y             *int   `json:"y" binding:"required"`
+	TargetSpaceID string `json:"targetSpaceId" binding:"required"`
+	TargetX       *int   `json:"targetX" binding:"required"`
+	TargetY       *int   `json:"targetY" binding:"required"`
+}
+
+// SpawnPointsRequest represents the update spawn points request body
+type SpawnPointsRequest struct {
+	SpawnPoints []models.SpawnPoint `json:"spawnPoints"`
+	SpawnMode   models.SpawnMode    `json:"spawnMode"`
+}
+
 // CreateSpace creates a new space
 func CreateSpace(c *gin.Context) {
 	var req CreateSpaceRequest
@@ -56,6 +136,14 @@ func CreateSpace(c *gin.Context) {
 	width, _ := strconv.Atoi(dims[0])
 	height, _ := strconv.Atoi(dims[1])
 
+	if req.Visibility == "" {
+		req.Visibility = models.SpaceVisibilityPublic
+	}
+	if !validVisibility(req.Visibility) {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Visibility must be public, unlisted or private"})
+		return
+	}
+
 	// If no mapId provided, create empty space
 	if req.MapID == nil || *req.MapID == "" {
 		space := models.Space{
@@ -64,6 +152,10 @@ func CreateSpace(c *gin.Context) {
 			Width:     width,
 			Height:    height,
 			CreatorID: userID,
+			SpawnMode: models.SpawnModeWeighted,
+
+			ForgetPositions: req.ForgetPositions,
+			Visibility:      req.Visibility,
 		}
 		database.GetDB().Create(&space)
 		c.JSON(http.StatusOK, gin.H{"spaceId": space.ID})
@@ -82,11 +174,16 @@ func CreateSpace(c *gin.Context) {
 	var space models.Space
 	err := database.GetDB().Transaction(func(tx *gorm.DB) error {
 		space = models.Space{
-			ID:        utils.GenerateCUID(),
-			Name:      req.Name,
-			Width:     mapTemplate.Width,
-			Height:    mapTemplate.Height,
-			CreatorID: userID,
+			ID:          utils.GenerateCUID(),
+			Name:        req.Name,
+			Width:       mapTemplate.Width,
+			Height:      mapTemplate.Height,
+			CreatorID:   userID,
+			SpawnPoints: mapTemplate.SpawnPoints,
+			SpawnMode:   mapTemplate.SpawnMode,
+
+			ForgetPositions: req.ForgetPositions,
+			Visibility:      req.Visibility,
 		}
 		if err := tx.Create(&space).Error; err != nil {
 			return err
@@ -135,38 +232,90 @@ func DeleteSpace(c *gin.Context) {
 		return
 	}
 
-	// Delete space elements first, then space
-	database.GetDB().Where("space_id = ?", spaceID).Delete(&models.SpaceElement{})
-	database.GetDB().Delete(&space)
+	// Spaces with portals into this one lose them too
+	var linkedSpaceIDs []string
+	database.GetDB().Model(&models.SpacePortal{}).
+		Where("target_space_id = ? AND space_id <> ?", spaceID, spaceID).
+		Distinct().Pluck("space_id", &linkedSpaceIDs)
+
+	err := database.GetDB().Transaction(func(tx *gorm.DB) error {
+		return database.DeleteSpace(tx, spaceID)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error deleting space"})
+		return
+	}
+
+	notifySpaceDeleted(spaceID, userID)
+	for _, linkedID := range linkedSpaceIDs {
+		notifySpaceChanged(linkedID)
+	}
 
 	c.JSON(http.StatusOK, gin.H{"message": "Space deleted"})
 }
 
-// GetAllSpaces gets all spaces for the current user
+// GetAllSpaces gets all spaces the current user created or is a member of
 func GetAllSpaces(c *gin.Context) {
 	userID := middleware.GetUserID(c)
 
 	var spaces []models.Space
-	database.GetDB().Where("creator_id = ?", userID).Find(&spaces)
+	database.GetDB().
+		Where("creator_id = ? OR id IN (?)", userID,
+			database.GetDB().Model(&models.SpaceMember{}).Select("space_id").Where("user_id = ?", userID)).
+		Find(&spaces)
+
+	c.JSON(http.StatusOK, gin.H{"spaces": spaceResponses(spaces, userID)})
+}
+
+// GetPublicSpaces lists the public spaces
+func GetPublicSpaces(c *gin.Context) {
+	var spaces []models.Space
+	database.GetDB().Where("visibility = ?", models.SpaceVisibilityPublic).Order("name asc").Find(&spaces)
+
+	c.JSON(http.StatusOK, gin.H{"spaces": spaceResponses(spaces, middleware.GetUserID(c))})
+}
+
+// SpaceResponse represents a space in space lists
+type SpaceResponse struct {
+	ID         string                 `json:"id"`
+	Name       string                 `json:"name"`
+	Thumbnail  *string                `json:"thumbnail"`
+	Dimensions string                 `json:"dimensions"`
+	Visibility models.SpaceVisibility `json:"visibility"`
+	Role       models.SpaceRole       `json:"role,omitempty"`
+}
 
-	type SpaceResponse struct {
-		ID         string  `json:"id"`
-		Name       string  `json:"name"`
-		Thumbnail  *string `json:"thumbnail"`
-		Dimensions string  `json:"dimensions"`
+func spaceResponses(spaces []models.Space, userID string) []SpaceResponse {
+	// Look up the user's memberships once for the whole list
+	roles := make(map[string]models.SpaceRole)
+	if userID != "" && len(spaces) > 0 {
+		ids := make([]string, len(spaces))
+		for i, s := range spaces {
+			ids[i] = s.ID
+		}
+		var members []models.SpaceMember
+		database.GetDB().Where("user_id = ? AND space_id IN ?", userID, ids).Find(&members)
+		for _, m := range members {
+			roles[m.SpaceID] = m.Role
+		}
 	}
 
 	response := make([]SpaceResponse, len(spaces))
 	for i, s := range spaces {
+		role := roles[s.ID]
+		if s.CreatorID == userID {
+			role = models.SpaceRoleOwner
+		}
 		response[i] = SpaceResponse{
 			ID:         s.ID,
 			Name:       s.Name,
 			Thumbnail:  s.Thumbnail,
 			Dimensions: strconv.Itoa(s.Width) + "x" + strconv.Itoa(s.Height),
+			Visibility: s.Visibility,
+			Role:       role,
 		}
 	}
-
-	c.JSON(http.StatusOK, gin.H{"spaces": response})
+	return response
 }
 
 // GetSpace gets a specific space with its elements
@@ -180,40 +329,23 @@ func GetSpace(c *gin.Context) {
 		return
 	}
 
-	type ElementDetail struct {
-		ID       string `json:"id"`
-		ImageURL string `json:"imageUrl"`
-		Width    int    `json:"width"`
-		Height   int    `json:"height"`
-		Static   bool   `json:"static"`
-	}
-
-	type ElementResponse struct {
-		ID      string        `json:"id"`
-		Element ElementDetail `json:"element"`
-		X       int           `json:"x"`
-		Y       int           `json:"y"`
+	// Private spaces look missing to everyone but their members
+	if !database.CanAccessSpace(space, middleware.GetUserID(c)) {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Space not found"})
+		return
 	}
 
 	elements := make([]ElementResponse, len(space.Elements))
 	for i, e := range space.Elements {
-		elements[i] = ElementResponse{
-			ID: e.ID,
-			Element: ElementDetail{
-				ID:       e.Element.ID,
-				ImageURL: e.Element.ImageURL,
-				Width:    e.Element.Width,
-				Height:   e.Element.Height,
-				Static:   e.Element.Static,
-			},
-			X: e.X,
-			Y: e.Y,
-		}
+		elements[i] = elementResponse(*e)
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"dimensions": strconv.Itoa(space.Width) + "x" + strconv.Itoa(space.Height),
-		"elements":   elements,
+		"dimensions":  strconv.Itoa(space.Width) + "x" + strconv.Itoa(space.Height),
+		"elements":    elements,
+		"spawnPoints": space.SpawnPoints,
+		"spawnMode":   space.SpawnMode,
+		"visibility":  space.Visibility,
 	})
 }
 
@@ -227,10 +359,10 @@ func AddElement(c *gin.Context) {
 
 	userID := middleware.GetUserID(c)
 
-	// Verify space ownership
+	// Owners and editors can change the layout
 	var space models.Space
-	result := database.GetDB().First(&space, "id = ? AND creator_id = ?", req.SpaceID, userID)
-	if result.Error != nil {
+	result := database.GetDB().First(&space, "id = ?", req.SpaceID)
+	if result.Error != nil || !database.HasSpaceRole(space, userID, models.SpaceRoleEditor) {
 		c.JSON(http.StatusBadRequest, gin.H{"message": "Space not found"})
 		return
 	}
@@ -240,6 +372,16 @@ func AddElement(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"message": "Point is outside of the boundary"})
 		return
 	}
+	if !models.ValidRotation(req.Rotation) {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Rotation must be 0, 90, 180 or 270"})
+		return
+	}
+
+	var element models.Element
+	if err := database.GetDB().First(&element, "id = ?", req.ElementID).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Element not found"})
+		return
+	}
 
 	spaceElement := models.SpaceElement{
 		ID:        utils.GenerateCUID(),
@@ -247,10 +389,63 @@ func AddElement(c *gin.Context) {
 		ElementID: req.ElementID,
 		X:         req.X,
 		Y:         req.Y,
+		Rotation:  req.Rotation,
+	}
+	if err := database.GetDB().Create(&spaceElement).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error adding element"})
+		return
+	}
+	spaceElement.Element = &element
+	notifyElementChanged(events.ElementAdded, spaceElement, userID)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Element added", "id": spaceElement.ID})
+}
+
+// MoveElement moves or rotates an element placed in a space
+func MoveElement(c *gin.Context) {
+	var req MoveElementRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Validation failed"})
+		return
+	}
+
+	spaceElement, ok := editableElement(c, c.Param("id"))
+	if !ok {
+		return
 	}
-	database.GetDB().Create(&spaceElement)
 
-	c.JSON(http.StatusOK, gin.H{"message": "Element added"})
+	if req.X != nil {
+		spaceElement.X = *req.X
+	}
+	if req.Y != nil {
+		spaceElement.Y = *req.Y
+	}
+	if req.Rotation != nil {
+		spaceElement.Rotation = *req.Rotation
+	}
+
+	space := spaceElement.Space
+	if spaceElement.X < 0 || spaceElement.Y < 0 || spaceElement.X > space.Width || spaceElement.Y > space.Height {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Point is outside of the boundary"})
+		return
+	}
+	if !models.ValidRotation(spaceElement.Rotation) {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Rotation must be 0, 90, 180 or 270"})
+		return
+	}
+
+	err := database.GetDB().Model(&models.SpaceElement{}).Where("id = ?", spaceElement.ID).Updates(map[string]interface{}{
+		"x":        spaceElement.X,
+		"y":        spaceElement.Y,
+		"rotation": spaceElement.Rotation,
+	}).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error updating element"})
+		return
+	}
+	notifyElementChanged(events.ElementUpdated, spaceElement, middleware.GetUserID(c))
+
+	c.JSON(http.StatusOK, gin.H{"message": "Element updated"})
 }
 
 // DeleteElement removes an element from a space
@@ -261,22 +456,366 @@ func DeleteElement(c *gin.Context) {
 		return
 	}
 
-	userID := middleware.GetUserID(c)
+	spaceElement, ok := editableElement(c, req.ID)
+	if !ok {
+		return
+	}
+
+	database.GetDB().Delete(&models.SpaceElement{}, "id = ?", spaceElement.ID)
+	notifyElementChanged(events.ElementRemoved, spaceElement, middleware.GetUserID(c))
+	c.JSON(http.StatusOK, gin.H{"message": "Element deleted"})
+}
 
-	// Find space element with space info
+// editableElement loads an element placed in a space, checking that the
+// current user can edit the space's layout
+func editableElement(c *gin.Context, id string) (models.SpaceElement, bool) {
 	var spaceElement models.SpaceElement
-	result := database.GetDB().Preload("Space").First(&spaceElement, "id = ?", req.ID)
-	if result.Error != nil {
+	result := database.GetDB().Preload("Space").Preload("Element").First(&spaceElement, "id = ?", id)
+	if result.Error != nil || spaceElement.Space == nil {
 		c.JSON(http.StatusBadRequest, gin.H{"message": "Element not found"})
-		return
+		return spaceElement, false
 	}
 
-	// Check ownership
-	if spaceElement.Space.CreatorID != userID {
+	if !database.HasSpaceRole(*spaceElement.Space, middleware.GetUserID(c), models.SpaceRoleEditor) {
 		c.JSON(http.StatusForbidden, gin.H{"message": "Unauthorized"})
+		return spaceElement, false
+	}
+	return spaceElement, true
+}
+
+// GetZones lists the zones of a space
+func GetZones(c *gin.Context) {
+	spaceID := c.Param("spaceId")
+
+	var space models.Space
+	if err := database.GetDB().First(&space, "id = ?", spaceID).Error; err != nil || !database.CanAccessSpace(space, middleware.GetUserID(c)) {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Space not found"})
 		return
 	}
 
-	database.GetDB().Delete(&spaceElement)
-	c.JSON(http.StatusOK, gin.H{"message": "Element deleted"})
+	var zones []models.SpaceZone
+	database.GetDB().Where("space_id = ?", spaceID).Order("created_at asc").Find(&zones)
+
+	c.JSON(http.StatusOK, gin.H{"zones": zones})
+}
+
+// CreateZone adds a zone to a space
+func CreateZone(c *gin.Context) {
+	space, ok := ownedSpace(c)
+	if !ok {
+		return
+	}
+
+	var req ZoneRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Validation failed"})
+		return
+	}
+
+	zone := models.SpaceZone{
+		ID:      utils.GenerateCUID(),
+		SpaceID: space.ID,
+	}
+	if msg := applyZoneRequest(&zone, req, space); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"message": msg})
+		return
+	}
+
+	if err := database.GetDB().Create(&zone).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error creating zone"})
+		return
+	}
+	notifySpaceChanged(space.ID)
+
+	c.JSON(http.StatusOK, gin.H{"id": zone.ID})
+}
+
+// UpdateZone replaces the geometry and rules of a zone
+func UpdateZone(c *gin.Context) {
+	space, ok := ownedSpace(c)
+	if !ok {
+		return
+	}
+
+	var zone models.SpaceZone
+	if err := database.GetDB().First(&zone, "id = ? AND space_id = ?", c.Param("zoneId"), space.ID).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Zone not found"})
+		return
+	}
+
+	var req ZoneRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Validation failed"})
+		return
+	}
+	if msg := applyZoneRequest(&zone, req, space); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"message": msg})
+		return
+	}
+
+	if err := database.GetDB().Save(&zone).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error updating zone"})
+		return
+	}
+	notifySpaceChanged(space.ID)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Zone updated"})
+}
+
+// DeleteZone removes a zone from a space
+func DeleteZone(c *gin.Context) {
+	space, ok := ownedSpace(c)
+	if !ok {
+		return
+	}
+
+	result := database.GetDB().Delete(&models.SpaceZone{}, "id = ? AND space_id = ?", c.Param("zoneId"), space.ID)
+	if result.Error != nil || result.RowsAffected == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Zone not found"})
+		return
+	}
+	notifySpaceChanged(space.ID)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Zone deleted"})
+}
+
+// GetPortals lists the portals of a space
+func GetPortals(c *gin.Context) {
+	spaceID := c.Param("spaceId")
+
+	var space models.Space
+	if err := database.GetDB().First(&space, "id = ?", spaceID).Error; err != nil || !database.CanAccessSpace(space, middleware.GetUserID(c)) {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Space not found"})
+		return
+	}
+
+	var portals []models.SpacePortal
+	database.GetDB().Where("space_id = ?", spaceID).Find(&portals)
+
+	c.JSON(http.StatusOK, gin.H{"portals": portals})
+}
+
+// CreatePortal places a portal to another space on a tile of a space
+func CreatePortal(c *gin.Context) {
+	space, ok := ownedSpace(c)
+	if !ok {
+		return
+	}
+
+	var req PortalRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Validation failed"})
+		return
+	}
+
+	if *req.X < 0 || *req.Y < 0 || *req.X >= space.Width || *req.Y >= space.Height {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Point is outside of the boundary"})
+		return
+	}
+
+	// Spaces the owner cannot join look missing, and so does any point in
+	// them, so portals do not reveal private spaces or their size
+	var target models.Space
+	err := database.GetDB().First(&target, "id = ?", req.TargetSpaceID).Error
+	if err != nil || !database.CanAccessSpace(target, middleware.GetUserID(c)) ||
+		*req.TargetX < 0 || *req.TargetY < 0 || *req.TargetX >= target.Width || *req.TargetY >= target.Height {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Target space not found"})
+		return
+	}
+
+	var existing int64
+	database.GetDB().Model(&models.SpacePortal{}).Where("space_id = ? AND x = ? AND y = ?", space.ID, *req.X, *req.Y).Count(&existing)
+	if existing > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Tile already has a portal"})
+		return
+	}
+
+	portal := models.SpacePortal{
+		ID:            utils.GenerateCUID(),
+		SpaceID:       space.ID,
+		X:             *req.X,
+		Y:             *req.Y,
+		TargetSpaceID: target.ID,
+		TargetX:       *req.TargetX,
+		TargetY:       *req.TargetY,
+	}
+	if err := database.GetDB().Create(&portal).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error creating portal"})
+		return
+	}
+	notifySpaceChanged(space.ID)
+
+	c.JSON(http.StatusOK, gin.H{"id": portal.ID})
+}
+
+// DeletePortal removes a portal from a space
+func DeletePortal(c *gin.Context) {
+	space, ok := ownedSpace(c)
+	if !ok {
+		return
+	}
+
+	result := database.GetDB().Delete(&models.SpacePortal{}, "id = ? AND space_id = ?", c.Param("portalId"), space.ID)
+	if result.Error != nil || result.RowsAffected == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Portal not found"})
+		return
+	}
+	notifySpaceChanged(space.ID)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Portal deleted"})
+}
+
+// UpdateSpaceSettings changes the settings of a space
+func UpdateSpaceSettings(c *gin.Context) {
+	space, ok := ownedSpace(c)
+	if !ok {
+		return
+	}
+
+	var req SpaceSettingsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Validation failed"})
+		return
+	}
+
+	visibility := space.Visibility
+	updates := map[string]interface{}{}
+	if req.ForgetPositions != nil {
+		updates["forget_positions"] = *req.ForgetPositions
+	}
+	if req.Visibility != nil {
+		if !validVisibility(*req.Visibility) {
+			c.JSON(http.StatusBadRequest, gin.H{"message": "Visibility must be public, unlisted or private"})
+			return
+		}
+		updates["visibility"] = *req.Visibility
+	}
+	if len(updates) == 0 {
+		c.JSON(http.StatusOK, gin.H{"message": "Space settings updated"})
+		return
+	}
+
+	if err := database.GetDB().Model(&space).Updates(updates).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error updating space settings"})
+		return
+	}
+
+	// Opting out also forgets the positions stored so far
+	if req.ForgetPositions != nil && *req.ForgetPositions {
+		database.GetDB().Where("space_id = ?", space.ID).Delete(&models.UserSpacePosition{})
+	}
+	if req.Visibility != nil && *req.Visibility != visibility {
+		notifySpaceAccessChanged(space.ID, middleware.GetUserID(c))
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Space settings updated"})
+}
+
+// UpdateSpawnPoints replaces the spawn points of a space
+func UpdateSpawnPoints(c *gin.Context) {
+	space, ok := ownedSpace(c)
+	if !ok {
+		return
+	}
+
+	var req SpawnPointsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"message": "Validation failed"})
+		return
+	}
+	if msg := validateSpawnPoints(req.SpawnPoints, &req.SpawnMode, space.Width, space.Height); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"message": msg})
+		return
+	}
+
+	space.SpawnPoints = req.SpawnPoints
+	space.SpawnMode = req.SpawnMode
+	err := database.GetDB().Model(&space).Select("spawn_points", "spawn_mode").Updates(&space).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "Error updating spawn points"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Spawn points updated"})
+}
+
+func validVisibility(v models.SpaceVisibility) bool {
+	switch v {
+	case models.SpaceVisibilityPublic, models.SpaceVisibilityUnlisted, models.SpaceVisibilityPrivate:
+		return true
+	}
+	return false
+}
+
+// validateSpawnPoints checks that spawn points lie inside a width×height area
+// and defaults the mode. It returns an error message when they are invalid.
+func validateSpawnPoints(points []models.SpawnPoint, mode *models.SpawnMode, width, height int) string {
+	switch *mode {
+	case "":
+		*mode = models.SpawnModeWeighted
+	case models.SpawnModeWeighted, models.SpawnModeRoundRobin:
+	default:
+		return "Spawn mode must be weighted or round-robin"
+	}
+	for _, p := range points {
+		if p.X < 0 || p.Y < 0 || p.X >= width || p.Y >= height {
+			return "Spawn point is outside of the boundary"
+		}
+		if p.Weight < 0 {
+			return "Spawn point weight must not be negative"
+		}
+	}
+	return ""
+}
+
+// ownedSpace loads the space named in the URL and checks that the current
+// user owns it, as its creator or as a member with the owner role
+func ownedSpace(c *gin.Context) (models.Space, bool) {
+	return memberSpace(c, models.SpaceRoleOwner)
+}
+
+// applyZoneRequest validates a zone request against the space and copies it
+// onto the zone. It returns an error message when the request is invalid.
+func applyZoneRequest(zone *models.SpaceZone, req ZoneRequest, space models.Space) string {
+	if req.Shape == "" {
+		req.Shape = models.ZoneShapeRect
+	}
+	if req.MaxOccupancy < 0 {
+		return "Max occupancy must not be negative"
+	}
+
+	switch req.Shape {
+	case models.ZoneShapeRect:
+		if req.Width <= 0 || req.Height <= 0 {
+			return "Width and height must be positive"
+		}
+		if req.X < 0 || req.Y < 0 || req.X+req.Width > space.Width || req.Y+req.Height > space.Height {
+			return "Zone is outside of the boundary"
+		}
+		req.Points = nil
+	case models.ZoneShapePolygon:
+		if len(req.Points) < 3 {
+			return "A polygon needs at least 3 points"
+		}
+		for _, p := range req.Points {
+			if p.X < 0 || p.Y < 0 || p.X > space.Width || p.Y > space.Height {
+				return "Zone is outside of the boundary"
+			}
+		}
+		req.X, req.Y, req.Width, req.Height = 0, 0, 0, 0
+	default:
+		return "Shape must be rect or polygon"
+	}
+
+	zone.Name = req.Name
+	zone.Shape = req.Shape
+	zone.X = req.X
+	zone.Y = req.Y
+	zone.Width = req.Width
+	zone.Height = req.Height
+	zone.Points = req.Points
+	zone.PrivateChat = req.PrivateChat
+	zone.MaxOccupancy = req.MaxOccupancy
+	zone.Muted = req.Muted
+	return ""
 }
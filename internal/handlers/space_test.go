@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"testing"
+
+	"github.com/genosis18m/Metaverse_go/internal/database"
+	"github.com/genosis18m/Metaverse_go/internal/events"
+	"github.com/genosis18m/Metaverse_go/internal/models"
+	"github.com/genosis18m/Metaverse_go/internal/utils"
+	"github.com/gin-gonic/gin"
+)
+
+// recordEvents sets an in-memory event bus and returns the events published on it
+func recordEvents(t *testing.T) func() []events.Event {
+	t.Helper()
+	var mu sync.Mutex
+	published := make([]events.Event, 0)
+
+	bus := events.NewMemoryBus()
+	bus.Subscribe(func(event events.Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		published = append(published, event)
+	})
+	events.SetBus(bus)
+	t.Cleanup(func() { events.SetBus(nil) })
+
+	return func() []events.Event {
+		mu.Lock()
+		defer mu.Unlock()
+		taken := published
+		published = make([]events.Event, 0)
+		return taken
+	}
+}
+
+// newLayoutRouter returns a router with the element routes that takes the
+// current user from the X-User-Id header
+func newLayoutRouter() *gin.Engine {
+	router := newMemberRouter()
+	router.POST("/space/element", AddElement)
+	router.PUT("/space/element/:id", MoveElement)
+	router.DELETE("/space/element", DeleteElement)
+	return router
+}
+
+func TestEditorsChangeTheLayout(t *testing.T) {
+	withTestDB(t)
+	takeEvents := recordEvents(t)
+	router := newLayoutRouter()
+	creator, editor, member, stranger := createTestUser(t), createTestUser(t), createTestUser(t), createTestUser(t)
+	space := createTestSpace(t, creator.ID)
+	addTestMember(t, space.ID, editor.ID, models.SpaceRoleEditor)
+	addTestMember(t, space.ID, member.ID, models.SpaceRoleMember)
+	element := models.Element{ID: utils.GenerateCUID(), Width: 1, Height: 1, Static: true, ImageURL: "https://example.com/desk.png"}
+	if err := database.DB.Create(&element).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	add := `{"spaceId":"` + space.ID + `","elementId":"` + element.ID + `","x":3,"y":4}`
+	if w := serveAs(router, member.ID, http.MethodPost, "/space/element", add); w.Code == http.StatusOK {
+		t.Fatal("a member added an element")
+	}
+	w := serveAs(router, editor.ID, http.MethodPost, "/space/element", add)
+	if w.Code != http.StatusOK {
+		t.Fatalf("editor adding an element: status = %d: %s", w.Code, w.Body)
+	}
+	var added struct {
+		ID string `json:"id"`
+	}
+	json.Unmarshal(w.Body.Bytes(), &added)
+
+	published := takeEvents()
+	if len(published) != 1 || published[0].Type != events.ElementAdded || published[0].SpaceID != space.ID || published[0].By != editor.ID {
+		t.Fatalf("published %+v, want one element-added by the editor", published)
+	}
+	var payload ElementResponse
+	if err := json.Unmarshal(published[0].Element, &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.ID != added.ID || payload.X != 3 || payload.Y != 4 || payload.Element.ID != element.ID {
+		t.Fatalf("element-added payload = %+v", payload)
+	}
+
+	if w := serveAs(router, member.ID, http.MethodPut, "/space/element/"+added.ID, `{"x":5}`); w.Code != http.StatusForbidden {
+		t.Fatalf("member moving an element: status = %d, want 403", w.Code)
+	}
+	if w := serveAs(router, editor.ID, http.MethodPut, "/space/element/"+added.ID, `{"x":5,"rotation":90}`); w.Code != http.StatusOK {
+		t.Fatalf("editor moving an element: status = %d: %s", w.Code, w.Body)
+	}
+	var moved models.SpaceElement
+	if err := database.DB.First(&moved, "id = ?", added.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if moved.X != 5 || moved.Y != 4 || moved.Rotation != 90 {
+		t.Fatalf("moved element = (%d,%d) rotated %d, want (5,4) rotated 90", moved.X, moved.Y, moved.Rotation)
+	}
+	if published := takeEvents(); len(published) != 1 || published[0].Type != events.ElementUpdated {
+		t.Fatalf("published %+v, want one element-updated", published)
+	}
+
+	remove := `{"id":"` + added.ID + `"}`
+	if w := serveAs(router, stranger.ID, http.MethodDelete, "/space/element", remove); w.Code != http.StatusForbidden {
+		t.Fatalf("stranger removing an element: status = %d, want 403", w.Code)
+	}
+	if w := serveAs(router, creator.ID, http.MethodDelete, "/space/element", remove); w.Code != http.StatusOK {
+		t.Fatalf("owner removing an element: status = %d: %s", w.Code, w.Body)
+	}
+	if published := takeEvents(); len(published) != 1 || published[0].Type != events.ElementRemoved || published[0].By != creator.ID {
+		t.Fatalf("published %+v, want one element-removed by the owner", published)
+	}
+}
+
+func TestInvalidLayoutChangesAreRejected(t *testing.T) {
+	withTestDB(t)
+	takeEvents := recordEvents(t)
+	router := newLayoutRouter()
+	creator := createTestUser(t)
+	space := createTestSpace(t, creator.ID)
+	element := models.Element{ID: utils.GenerateCUID(), Width: 1, Height: 1, ImageURL: "https://example.com/plant.png"}
+	if err := database.DB.Create(&element).Error; err != nil {
+		t.Fatal(err)
+	}
+	placed := models.SpaceElement{ID: utils.GenerateCUID(), SpaceID: space.ID, ElementID: element.ID, X: 1, Y: 1}
+	if err := database.DB.Create(&placed).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	for _, body := range []string{`{"x":-1}`, `{"y":21}`, `{"rotation":45}`} {
+		if w := serveAs(router, creator.ID, http.MethodPut, "/space/element/"+placed.ID, body); w.Code != http.StatusBadRequest {
+			t.Errorf("move %s: status = %d, want 400", body, w.Code)
+		}
+	}
+	if published := takeEvents(); len(published) != 0 {
+		t.Fatalf("rejected changes published %+v", published)
+	}
+}
+
+func TestAccessChangesArePublished(t *testing.T) {
+	withTestDB(t)
+	takeEvents := recordEvents(t)
+	router := newMemberRouter()
+	router.PUT("/space/:spaceId/settings", UpdateSpaceSettings)
+	creator, member := createTestUser(t), createTestUser(t)
+	space := createTestSpace(t, creator.ID)
+	addTestMember(t, space.ID, member.ID, models.SpaceRoleMember)
+
+	for _, c := range []struct {
+		name      string
+		method    string
+		path      string
+		body      string
+		published bool
+	}{
+		{"same visibility", http.MethodPut, "/space/" + space.ID + "/settings", `{"visibility":"public"}`, false},
+		{"other setting", http.MethodPut, "/space/" + space.ID + "/settings", `{"forgetPositions":true}`, false},
+		{"turning private", http.MethodPut, "/space/" + space.ID + "/settings", `{"visibility":"private"}`, true},
+		{"removing a member", http.MethodDelete, "/space/" + space.ID + "/members/" + member.ID, "", true},
+	} {
+		if w := serveAs(router, creator.ID, c.method, c.path, c.body); w.Code != http.StatusOK {
+			t.Fatalf("%s: status = %d: %s", c.name, w.Code, w.Body)
+		}
+		published := takeEvents()
+		if !c.published && len(published) != 0 {
+			t.Fatalf("%s: published %+v", c.name, published)
+		}
+		if c.published && (len(published) != 1 || published[0].Type != events.SpaceAccessChanged || published[0].SpaceID != space.ID) {
+			t.Fatalf("%s: published %+v, want one space-access-changed", c.name, published)
+		}
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"net/http"
 	"strings"
 
+	"github.com/genosis18m/Metaverse_go/internal/database"
+	"github.com/genosis18m/Metaverse_go/internal/models"
 	"github.com/genosis18m/Metaverse_go/internal/utils"
 	"github.com/gin-gonic/gin"
 )
@@ -28,15 +30,29 @@ func UserAuth() gin.HandlerFunc {
 
 		token := parts[1]
 		claims, err := utils.ValidateToken(token)
+		if err != nil || database.IsTokenRevoked(claims) {
+			c.JSON(http.StatusUnauthorized, gin.H{"message": "Invalid token"})
+			c.Abort()
+			return
+		}
+
+		// The account may have been suspended or deleted since the token was issued
+		role, suspended, err := database.AccountStatus(claims.UserID)
 		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"message": "Invalid token"})
 			c.Abort()
 			return
 		}
+		if suspended {
+			c.JSON(http.StatusForbidden, gin.H{"message": "Account suspended"})
+			c.Abort()
+			return
+		}
 
 		// Set user info in context
 		c.Set("userId", claims.UserID)
-		c.Set("role", claims.Role)
+		c.Set("role", string(role))
+		c.Set("claims", claims)
 		c.Next()
 	}
 }
@@ -61,14 +77,25 @@ func AdminAuth() gin.HandlerFunc {
 
 		token := parts[1]
 		claims, err := utils.ValidateToken(token)
-		if err != nil {
+		if err != nil || database.IsTokenRevoked(claims) {
 			c.JSON(http.StatusUnauthorized, gin.H{"message": "Invalid token"})
 			c.Abort()
 			return
 		}
 
-		// Check if user is admin
-		if claims.Role != "Admin" {
+		// Check the current role, so demoted admins lose access right away
+		role, suspended, err := database.AccountStatus(claims.UserID)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"message": "Invalid token"})
+			c.Abort()
+			return
+		}
+		if suspended {
+			c.JSON(http.StatusForbidden, gin.H{"message": "Account suspended"})
+			c.Abort()
+			return
+		}
+		if role != models.RoleAdmin {
 			c.JSON(http.StatusForbidden, gin.H{"message": "Admin access required"})
 			c.Abort()
 			return
@@ -76,7 +103,25 @@ func AdminAuth() gin.HandlerFunc {
 
 		// Set user info in context
 		c.Set("userId", claims.UserID)
-		c.Set("role", claims.Role)
+		c.Set("role", string(role))
+		c.Set("claims", claims)
+		c.Next()
+	}
+}
+
+// OptionalAuth is middleware that identifies the user when a valid JWT token
+// is sent, and lets anonymous requests through otherwise
+func OptionalAuth() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		parts := strings.Split(c.GetHeader("Authorization"), " ")
+		if len(parts) == 2 && parts[0] == "Bearer" {
+			if claims, err := utils.ValidateToken(parts[1]); err == nil && !database.IsTokenRevoked(claims) {
+				if role, suspended, err := database.AccountStatus(claims.UserID); err == nil && !suspended {
+					c.Set("userId", claims.UserID)
+					c.Set("role", string(role))
+				}
+			}
+		}
 		c.Next()
 	}
 }
@@ -90,6 +135,15 @@ func GetUserID(c *gin.Context) string {
 	return userID.(string)
 }
 
+// GetClaims retrieves the claims of the access token the request was made with
+func GetClaims(c *gin.Context) *utils.Claims {
+	claims, exists := c.Get("claims")
+	if !exists {
+		return nil
+	}
+	return claims.(*utils.Claims)
+}
+
 // GetUserRole retrieves the user role from the gin context
 func GetUserRole(c *gin.Context) string {
 	role, exists := c.Get("role")
@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// DirectMessage represents a private message between two users
+type DirectMessage struct {
+	ID          string     `gorm:"primaryKey;type:varchar(255)" json:"id"`
+	Text        string     `gorm:"type:text;not null" json:"text"`
+	SenderID    string     `gorm:"type:varchar(255);not null;index:idx_direct_messages_pair,priority:1" json:"senderId"`
+	RecipientID string     `gorm:"type:varchar(255);not null;index:idx_direct_messages_pair,priority:2;index:idx_direct_messages_unread,priority:1" json:"recipientId"`
+	SpaceID     *string    `gorm:"type:varchar(255)" json:"spaceId"`
+	CreatedAt   time.Time  `gorm:"index:idx_direct_messages_pair,priority:3" json:"createdAt"`
+	ReadAt      *time.Time `gorm:"index:idx_direct_messages_unread,priority:2" json:"readAt"`
+
+	// Relations
+	Sender    *User `gorm:"foreignKey:SenderID" json:"sender,omitempty"`
+	Recipient *User `gorm:"foreignKey:RecipientID" json:"recipient,omitempty"`
+}
+
+func (DirectMessage) TableName() string {
+	return "directMessages"
+}
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// UserIdentity links an account at an OpenID Connect provider, identified by
+// its subject, to a user
+type UserIdentity struct {
+	ID            string    `gorm:"primaryKey;type:varchar(255)" json:"id"`
+	UserID        string    `gorm:"type:varchar(255);not null;index" json:"userId"`
+	Provider      string    `gorm:"type:varchar(64);not null;uniqueIndex:idx_identity_subject" json:"provider"`
+	Subject       string    `gorm:"type:varchar(255);not null;uniqueIndex:idx_identity_subject" json:"subject"`
+	Email         string    `gorm:"type:varchar(255)" json:"email"`
+	EmailVerified bool      `gorm:"not null;default:false" json:"emailVerified"`
+	CreatedAt     time.Time `gorm:"not null" json:"createdAt"`
+	LastLoginAt   time.Time `gorm:"not null" json:"lastLoginAt"`
+}
+
+func (UserIdentity) TableName() string {
+	return "userIdentities"
+}
@@ -1,12 +1,31 @@
 package models
 
+// SpawnMode selects how a spawn point is picked when there are several
+type SpawnMode string
+
+const (
+	// SpawnModeWeighted picks points at random in proportion to their weight
+	SpawnModeWeighted SpawnMode = "weighted"
+	// SpawnModeRoundRobin picks points in turn
+	SpawnModeRoundRobin SpawnMode = "round-robin"
+)
+
+// SpawnPoint is a tile where users appear when they join. Weight defaults to 1.
+type SpawnPoint struct {
+	X      int `json:"x"`
+	Y      int `json:"y"`
+	Weight int `json:"weight,omitempty"`
+}
+
 // Map represents a template map that can be used to create spaces
 type Map struct {
-	ID        string `gorm:"primaryKey;type:varchar(255)" json:"id"`
-	Width     int    `gorm:"not null" json:"width"`
-	Height    int    `gorm:"not null" json:"height"`
-	Name      string `gorm:"type:varchar(255);not null" json:"name"`
-	Thumbnail string `gorm:"type:text;not null" json:"thumbnail"`
+	ID          string       `gorm:"primaryKey;type:varchar(255)" json:"id"`
+	Width       int          `gorm:"not null" json:"width"`
+	Height      int          `gorm:"not null" json:"height"`
+	Name        string       `gorm:"type:varchar(255);not null" json:"name"`
+	Thumbnail   string       `gorm:"type:text;not null" json:"thumbnail"`
+	SpawnPoints []SpawnPoint `gorm:"serializer:json" json:"spawnPoints,omitempty"`
+	SpawnMode   SpawnMode    `gorm:"type:varchar(20);not null;default:weighted" json:"spawnMode"`
 
 	// Relations
 	MapElements []*MapElement `gorm:"foreignKey:MapID" json:"mapElements,omitempty"`
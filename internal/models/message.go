@@ -1,14 +1,42 @@
 package models
 
-import "time"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ChatScope is the audience of a chat message
+type ChatScope string
+
+const (
+	// ChatScopeRoom messages reach everyone in the space
+	ChatScopeRoom ChatScope = "room"
+	// ChatScopeNearby messages reach the users within chat radius of the sender
+	ChatScopeNearby ChatScope = "nearby"
+	// ChatScopeZone messages reach the users in the sender's zone
+	ChatScopeZone ChatScope = "zone"
+)
 
 // Message represents a chat message in a space
 type Message struct {
-	ID        string    `gorm:"primaryKey" json:"id"`
-	Text      string    `json:"text"`
-	UserID    string    `json:"userId"`
-	SpaceID   string    `json:"spaceId"`
-	CreatedAt time.Time `json:"createdAt"`
-	User      User      `gorm:"foreignKey:UserID"`
-	Space     Space     `gorm:"foreignKey:SpaceID"`
+	ID        string         `gorm:"primaryKey" json:"id"`
+	Text      string         `json:"text"`
+	UserID    string         `json:"userId"`
+	SpaceID   string         `gorm:"index:idx_messages_space_created,priority:1" json:"spaceId"`
+	Scope     ChatScope      `gorm:"type:varchar(20);not null;default:room" json:"scope"`
+	CreatedAt time.Time      `gorm:"index:idx_messages_space_created,priority:2" json:"createdAt"`
+	EditedAt  *time.Time     `json:"editedAt"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+	User      User           `gorm:"foreignKey:UserID"`
+	Space     Space          `gorm:"foreignKey:SpaceID"`
+
+	// Recipients of messages not sent to the whole room, besides the sender
+	Recipients []MessageRecipient `gorm:"foreignKey:MessageID" json:"-"`
+}
+
+// MessageRecipient records a user who received a scoped chat message
+type MessageRecipient struct {
+	MessageID string `gorm:"primaryKey" json:"messageId"`
+	UserID    string `gorm:"primaryKey;index" json:"userId"`
 }
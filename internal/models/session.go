@@ -0,0 +1,44 @@
+package models
+
+import "time"
+
+// UserSession is a signed-in device. Access tokens carry the session ID, so
+// revoking the session ends them along with its refresh tokens.
+type UserSession struct {
+	ID         string     `gorm:"primaryKey;type:varchar(255)" json:"id"`
+	UserID     string     `gorm:"type:varchar(255);not null;index" json:"userId"`
+	UserAgent  string     `gorm:"type:text" json:"userAgent"`
+	CreatedAt  time.Time  `gorm:"not null" json:"createdAt"`
+	LastUsedAt time.Time  `gorm:"not null" json:"lastUsedAt"`
+	RevokedAt  *time.Time `json:"revokedAt"`
+}
+
+func (UserSession) TableName() string {
+	return "userSessions"
+}
+
+// RefreshToken is a single-use token that is exchanged for a new access and
+// refresh token. Only its SHA-256 hash is stored.
+type RefreshToken struct {
+	ID        string     `gorm:"primaryKey;type:varchar(255)" json:"id"`
+	SessionID string     `gorm:"type:varchar(255);not null;index" json:"sessionId"`
+	TokenHash string     `gorm:"type:varchar(64);not null;uniqueIndex" json:"-"`
+	ExpiresAt time.Time  `gorm:"not null" json:"expiresAt"`
+	UsedAt    *time.Time `json:"usedAt"`
+	CreatedAt time.Time  `gorm:"not null" json:"createdAt"`
+}
+
+func (RefreshToken) TableName() string {
+	return "refreshTokens"
+}
+
+// RevokedToken denies an access token by its ID (jti) until it would have
+// expired anyway
+type RevokedToken struct {
+	JTI       string    `gorm:"primaryKey;type:varchar(255)" json:"jti"`
+	ExpiresAt time.Time `gorm:"not null;index" json:"expiresAt"`
+}
+
+func (RevokedToken) TableName() string {
+	return "revokedTokens"
+}
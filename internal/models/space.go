@@ -1,5 +1,7 @@
 package models
 
+import "time"
+
 // Space represents a virtual space in the metaverse
 type Space struct {
 	ID        string  `gorm:"primaryKey;type:varchar(255)" json:"id"`
@@ -9,6 +11,15 @@ type Space struct {
 	Thumbnail *string `gorm:"type:text" json:"thumbnail"`
 	CreatorID string  `gorm:"type:varchar(255);not null" json:"creatorId"`
 
+	// Where users appear when they join, copied from the map the space was created from
+	SpawnPoints []SpawnPoint `gorm:"serializer:json" json:"spawnPoints,omitempty"`
+	SpawnMode   SpawnMode    `gorm:"type:varchar(20);not null;default:weighted" json:"spawnMode"`
+
+	// ForgetPositions opts the space out of returning users to their last position
+	ForgetPositions bool `gorm:"not null;default:false" json:"forgetPositions"`
+
+	Visibility SpaceVisibility `gorm:"type:varchar(20);not null;default:public" json:"visibility"`
+
 	// Relations
 	Creator  *User           `gorm:"foreignKey:CreatorID" json:"creator,omitempty"`
 	Elements []*SpaceElement `gorm:"foreignKey:SpaceID" json:"elements,omitempty"`
@@ -25,6 +36,7 @@ type SpaceElement struct {
 	SpaceID   string `gorm:"type:varchar(255);not null" json:"spaceId"`
 	X         int    `gorm:"not null" json:"x"`
 	Y         int    `gorm:"not null" json:"y"`
+	Rotation  int    `gorm:"not null;default:0" json:"rotation"`
 
 	// Relations
 	Space   *Space   `gorm:"foreignKey:SpaceID" json:"space,omitempty"`
@@ -34,3 +46,222 @@ type SpaceElement struct {
 func (SpaceElement) TableName() string {
 	return "spaceElements"
 }
+
+// ValidRotation reports whether a rotation is a quarter turn: 0, 90, 180 or 270 degrees
+func ValidRotation(rotation int) bool {
+	return rotation == 0 || rotation == 90 || rotation == 180 || rotation == 270
+}
+
+// Footprint returns the width and height of the tiles the element covers,
+// swapped when it is turned sideways. Elements without a size still cover
+// the tile they are placed on.
+func (e SpaceElement) Footprint() (int, int) {
+	w, h := 1, 1
+	if e.Element != nil {
+		w, h = max(e.Element.Width, 1), max(e.Element.Height, 1)
+	}
+	if e.Rotation == 90 || e.Rotation == 270 {
+		return h, w
+	}
+	return w, h
+}
+
+// SpaceMute stops a user from chatting in a space until it expires or is lifted
+type SpaceMute struct {
+	SpaceID   string     `gorm:"primaryKey;type:varchar(255)" json:"spaceId"`
+	UserID    string     `gorm:"primaryKey;type:varchar(255)" json:"userId"`
+	MutedByID string     `gorm:"type:varchar(255);not null" json:"mutedById"`
+	Until     *time.Time `json:"until"`
+	CreatedAt time.Time  `json:"createdAt"`
+}
+
+func (SpaceMute) TableName() string {
+	return "spaceMutes"
+}
+
+// SpaceKick keeps a kicked user out of a space until it expires
+type SpaceKick struct {
+	SpaceID    string    `gorm:"primaryKey;type:varchar(255)" json:"spaceId"`
+	UserID     string    `gorm:"primaryKey;type:varchar(255)" json:"userId"`
+	KickedByID string    `gorm:"type:varchar(255);not null" json:"kickedById"`
+	Until      time.Time `gorm:"not null" json:"until"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+func (SpaceKick) TableName() string {
+	return "spaceKicks"
+}
+
+// ZoneShape is the geometry of a zone
+type ZoneShape string
+
+const (
+	ZoneShapeRect    ZoneShape = "rect"
+	ZoneShapePolygon ZoneShape = "polygon"
+)
+
+// ZonePoint is a vertex of a polygon zone
+type ZonePoint struct {
+	X int `json:"x"`
+	Y int `json:"y"`
+}
+
+// SpaceZone is a named area of a space with its own rules. Rectangles cover
+// the tiles from (X, Y) spanning Width×Height; polygons cover the tiles whose
+// centre lies inside Points.
+type SpaceZone struct {
+	ID      string      `gorm:"primaryKey;type:varchar(255)" json:"id"`
+	SpaceID string      `gorm:"type:varchar(255);not null;index" json:"spaceId"`
+	Name    string      `gorm:"type:varchar(255);not null" json:"name"`
+	Shape   ZoneShape   `gorm:"type:varchar(20);not null" json:"shape"`
+	X       int         `json:"x"`
+	Y       int         `json:"y"`
+	Width   int         `json:"width"`
+	Height  int         `json:"height"`
+	Points  []ZonePoint `gorm:"serializer:json" json:"points,omitempty"`
+
+	// Rules: chat inside a private-chat zone stays in the zone, a muted zone
+	// allows no chat, and MaxOccupancy limits how many users fit (0 = unlimited)
+	PrivateChat  bool `gorm:"not null;default:false" json:"privateChat"`
+	MaxOccupancy int  `gorm:"not null;default:0" json:"maxOccupancy"`
+	Muted        bool `gorm:"not null;default:false" json:"muted"`
+
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+func (SpaceZone) TableName() string {
+	return "spaceZones"
+}
+
+// Contains reports whether a tile lies inside the zone
+func (z *SpaceZone) Contains(x, y int) bool {
+	if z.Shape != ZoneShapePolygon {
+		return x >= z.X && x < z.X+z.Width && y >= z.Y && y < z.Y+z.Height
+	}
+
+	// Ray casting from the centre of the tile
+	px, py := float64(x)+0.5, float64(y)+0.5
+	inside := false
+	for i, j := 0, len(z.Points)-1; i < len(z.Points); j, i = i, i+1 {
+		xi, yi := float64(z.Points[i].X), float64(z.Points[i].Y)
+		xj, yj := float64(z.Points[j].X), float64(z.Points[j].Y)
+		if (yi > py) != (yj > py) && px < (xj-xi)*(py-yi)/(yj-yi)+xi {
+			inside = !inside
+		}
+	}
+	return inside
+}
+
+// SpacePortal is a tile of a space that teleports users who step on it to a
+// position in another space
+type SpacePortal struct {
+	ID            string `gorm:"primaryKey;type:varchar(255)" json:"id"`
+	SpaceID       string `gorm:"type:varchar(255);not null;index" json:"spaceId"`
+	X             int    `gorm:"not null" json:"x"`
+	Y             int    `gorm:"not null" json:"y"`
+	TargetSpaceID string `gorm:"type:varchar(255);not null" json:"targetSpaceId"`
+	TargetX       int    `gorm:"not null" json:"targetX"`
+	TargetY       int    `gorm:"not null" json:"targetY"`
+
+	// Relations
+	Space       *Space `gorm:"foreignKey:SpaceID" json:"space,omitempty"`
+	TargetSpace *Space `gorm:"foreignKey:TargetSpaceID" json:"targetSpace,omitempty"`
+}
+
+func (SpacePortal) TableName() string {
+	return "spacePortals"
+}
+
+// UserSpacePosition is where a user last stood in a space
+type UserSpacePosition struct {
+	UserID    string    `gorm:"primaryKey;type:varchar(255)" json:"userId"`
+	SpaceID   string    `gorm:"primaryKey;type:varchar(255)" json:"spaceId"`
+	X         int       `gorm:"not null" json:"x"`
+	Y         int       `gorm:"not null" json:"y"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+func (UserSpacePosition) TableName() string {
+	return "userSpacePositions"
+}
+
+// SpaceVisibility controls who can find and join a space
+type SpaceVisibility string
+
+const (
+	// SpaceVisibilityPublic spaces are listed and anyone can join
+	SpaceVisibilityPublic SpaceVisibility = "public"
+	// SpaceVisibilityUnlisted spaces are not listed but anyone with the ID can join
+	SpaceVisibilityUnlisted SpaceVisibility = "unlisted"
+	// SpaceVisibilityPrivate spaces can only be joined by members
+	SpaceVisibilityPrivate SpaceVisibility = "private"
+)
+
+// SpaceRole is the role of a member of a space
+type SpaceRole string
+
+const (
+	SpaceRoleOwner  SpaceRole = "owner"
+	SpaceRoleEditor SpaceRole = "editor"
+	SpaceRoleMember SpaceRole = "member"
+	SpaceRoleGuest  SpaceRole = "guest"
+)
+
+// rank orders roles from least to most privileged
+func (r SpaceRole) rank() int {
+	switch r {
+	case SpaceRoleOwner:
+		return 4
+	case SpaceRoleEditor:
+		return 3
+	case SpaceRoleMember:
+		return 2
+	case SpaceRoleGuest:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// Valid reports whether r is a known role
+func (r SpaceRole) Valid() bool {
+	return r.rank() > 0
+}
+
+// AtLeast reports whether r grants everything other grants
+func (r SpaceRole) AtLeast(other SpaceRole) bool {
+	return r.rank() >= other.rank()
+}
+
+// SpaceMember gives a user a role in a space. The creator of a space is its
+// owner without needing a member row.
+type SpaceMember struct {
+	SpaceID   string    `gorm:"primaryKey;type:varchar(255)" json:"spaceId"`
+	UserID    string    `gorm:"primaryKey;type:varchar(255);index" json:"userId"`
+	Role      SpaceRole `gorm:"type:varchar(20);not null" json:"role"`
+	CreatedAt time.Time `json:"createdAt"`
+
+	// Relations
+	User *User `gorm:"foreignKey:UserID" json:"user,omitempty"`
+}
+
+func (SpaceMember) TableName() string {
+	return "spaceMembers"
+}
+
+// SpaceInvite is a link that makes whoever accepts it a member of a space
+type SpaceInvite struct {
+	ID          string     `gorm:"primaryKey;type:varchar(255)" json:"id"`
+	SpaceID     string     `gorm:"type:varchar(255);not null;index" json:"spaceId"`
+	Token       string     `gorm:"type:varchar(255);not null;uniqueIndex" json:"token"`
+	Role        SpaceRole  `gorm:"type:varchar(20);not null" json:"role"`
+	CreatedByID string     `gorm:"type:varchar(255);not null" json:"createdById"`
+	ExpiresAt   *time.Time `json:"expiresAt"`
+	MaxUses     int        `gorm:"not null;default:0" json:"maxUses"`
+	Uses        int        `gorm:"not null;default:0" json:"uses"`
+	CreatedAt   time.Time  `json:"createdAt"`
+}
+
+func (SpaceInvite) TableName() string {
+	return "spaceInvites"
+}
@@ -1,5 +1,7 @@
 package models
 
+import "time"
+
 // Role represents user role type
 type Role string
 
@@ -16,11 +18,20 @@ type User struct {
 	AvatarID *string `gorm:"type:varchar(255)" json:"avatarId"`
 	Role     Role    `gorm:"type:varchar(50);not null" json:"role"`
 
+	// Suspended users cannot sign in or connect
+	SuspendedAt     *time.Time `json:"suspendedAt,omitempty"`
+	SuspendedReason string     `gorm:"type:text" json:"suspendedReason,omitempty"`
+
 	// Relations
 	Avatar *Avatar  `gorm:"foreignKey:AvatarID" json:"avatar,omitempty"`
 	Spaces []*Space `gorm:"foreignKey:CreatorID" json:"spaces,omitempty"`
 }
 
+// Valid reports whether the role is one of the known roles
+func (r Role) Valid() bool {
+	return r == RoleAdmin || r == RoleUser
+}
+
 func (User) TableName() string {
 	return "User"
 }
@@ -0,0 +1,303 @@
+package oidc
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/genosis18m/Metaverse_go/internal/utils"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// fakeProvider is a minimal OpenID Connect provider: discovery, a JWKS with
+// one Ed25519 key, and a token endpoint that checks PKCE and client secrets
+type fakeProvider struct {
+	srv *httptest.Server
+	key ed25519.PrivateKey
+
+	mu sync.Mutex
+	// logins maps the codes handed out by login to their challenge and nonce
+	logins map[string]fakeLogin
+	// issuer overrides the issuer of the discovery document
+	issuer string
+	// claims changes the ID token before it is signed
+	claims func(jwt.MapClaims)
+	// signer overrides the key ID tokens are signed with
+	signer            ed25519.PrivateKey
+	discoveryRequests int
+}
+
+type fakeLogin struct {
+	challenge string
+	nonce     string
+}
+
+func newFakeProvider(t *testing.T) *fakeProvider {
+	t.Helper()
+	f := &fakeProvider{key: newKey(t), logins: make(map[string]fakeLogin)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		f.discoveryRequests++
+		issuer := f.issuer
+		f.mu.Unlock()
+		if issuer == "" {
+			issuer = f.srv.URL
+		}
+		json.NewEncoder(w).Encode(Discovery{
+			Issuer:                issuer,
+			AuthorizationEndpoint: f.srv.URL + "/authorize",
+			TokenEndpoint:         f.srv.URL + "/token",
+			JWKSURI:               f.srv.URL + "/jwks",
+			TokenAuthMethods:      []string{"client_secret_basic"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(utils.JWKS{Keys: []utils.JWK{{
+			Kty: "OKP", Crv: "Ed25519", Kid: "key-1", Use: "sig", Alg: "EdDSA",
+			X: base64.RawURLEncoding.EncodeToString(f.key.Public().(ed25519.PublicKey)),
+		}}})
+	})
+	mux.HandleFunc("/token", f.token)
+	f.srv = httptest.NewServer(mux)
+	t.Cleanup(f.srv.Close)
+	return f
+}
+
+func newKey(t *testing.T) ed25519.PrivateKey {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func (f *fakeProvider) token(w http.ResponseWriter, r *http.Request) {
+	fail := func(code string) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": code})
+	}
+	if id, secret, ok := r.BasicAuth(); !ok || id != "client-id" || secret != "client-secret" {
+		fail("invalid_client")
+		return
+	}
+
+	f.mu.Lock()
+	login, ok := f.logins[r.FormValue("code")]
+	delete(f.logins, r.FormValue("code"))
+	customize, signer := f.claims, f.signer
+	f.mu.Unlock()
+	if !ok || r.FormValue("grant_type") != "authorization_code" {
+		fail("invalid_grant")
+		return
+	}
+	sum := sha256.Sum256([]byte(r.FormValue("code_verifier")))
+	if base64.RawURLEncoding.EncodeToString(sum[:]) != login.challenge {
+		fail("invalid_grant")
+		return
+	}
+
+	claims := jwt.MapClaims{
+		"iss":            f.srv.URL,
+		"aud":            "client-id",
+		"sub":            "subject-1",
+		"nonce":          login.nonce,
+		"email":          "alice@example.com",
+		"email_verified": "true",
+		"iat":            time.Now().Unix(),
+		"exp":            time.Now().Add(5 * time.Minute).Unix(),
+	}
+	if customize != nil {
+		customize(claims)
+	}
+	if signer == nil {
+		signer = f.key
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+	token.Header["kid"] = "key-1"
+	raw, err := token.SignedString(signer)
+	if err != nil {
+		fail("server_error")
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"id_token": raw, "token_type": "Bearer"})
+}
+
+func (f *fakeProvider) provider() *Provider {
+	return NewProvider(Config{
+		Name:         "fake",
+		Issuer:       f.srv.URL,
+		ClientID:     "client-id",
+		ClientSecret: "client-secret",
+		RedirectURL:  "http://app.test/api/v1/auth/oidc/fake/callback",
+	}, f.srv.Client())
+}
+
+// login follows the provider's login page as a user who signs in, and
+// returns the code the provider redirects back with
+func (f *fakeProvider) login(t *testing.T, p *Provider, req AuthRequest) string {
+	t.Helper()
+	authURL, err := p.AuthURL(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := parsed.Query()
+	if query.Get("code_challenge_method") != "S256" || query.Get("state") != req.State {
+		t.Fatalf("authorization URL %s", authURL)
+	}
+
+	code := utils.GenerateRandomString(16)
+	f.mu.Lock()
+	f.logins[code] = fakeLogin{challenge: query.Get("code_challenge"), nonce: query.Get("nonce")}
+	f.mu.Unlock()
+	return code
+}
+
+func newAuthRequest(t *testing.T) AuthRequest {
+	t.Helper()
+	req, err := NewAuthRequest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return req
+}
+
+func TestAuthURL(t *testing.T) {
+	f := newFakeProvider(t)
+	req := newAuthRequest(t)
+
+	authURL, err := f.provider().AuthURL(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parsed, _ := url.Parse(authURL)
+	if !strings.HasPrefix(authURL, f.srv.URL+"/authorize?") {
+		t.Fatalf("authorization URL %s", authURL)
+	}
+
+	sum := sha256.Sum256([]byte(req.Verifier))
+	for name, want := range map[string]string{
+		"response_type":         "code",
+		"client_id":             "client-id",
+		"redirect_uri":          "http://app.test/api/v1/auth/oidc/fake/callback",
+		"scope":                 "openid email profile",
+		"state":                 req.State,
+		"nonce":                 req.Nonce,
+		"code_challenge":        base64.RawURLEncoding.EncodeToString(sum[:]),
+		"code_challenge_method": "S256",
+	} {
+		if got := parsed.Query().Get(name); got != want {
+			t.Errorf("%s = %q, want %q", name, got, want)
+		}
+	}
+	if parsed.Query().Has("code_verifier") {
+		t.Error("the code verifier was sent to the login page")
+	}
+
+	other := newAuthRequest(t)
+	if other.State == req.State || other.Nonce == req.Nonce || other.Verifier == req.Verifier {
+		t.Fatal("login requests share secrets")
+	}
+}
+
+func TestExchange(t *testing.T) {
+	f := newFakeProvider(t)
+	p := f.provider()
+	req := newAuthRequest(t)
+
+	claims, err := p.Exchange(context.Background(), f.login(t, p, req), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Subject != "subject-1" || claims.Email != "alice@example.com" || !bool(claims.EmailVerified) {
+		t.Fatalf("claims = %+v", claims)
+	}
+}
+
+func TestExchangeRejectsWrongVerifier(t *testing.T) {
+	f := newFakeProvider(t)
+	p := f.provider()
+	req := newAuthRequest(t)
+	code := f.login(t, p, req)
+
+	// A code intercepted on the redirect is useless without the verifier
+	stolen := newAuthRequest(t)
+	stolen.Nonce = req.Nonce
+	if _, err := p.Exchange(context.Background(), code, stolen); err == nil {
+		t.Fatal("code redeemed with another verifier")
+	}
+}
+
+func TestExchangeRejectsNonceMismatch(t *testing.T) {
+	f := newFakeProvider(t)
+	p := f.provider()
+	req := newAuthRequest(t)
+	code := f.login(t, p, req)
+
+	// The ID token belongs to a different login of the same browser
+	other := req
+	other.Nonce = newAuthRequest(t).Nonce
+	if _, err := p.Exchange(context.Background(), code, other); err == nil || !strings.Contains(err.Error(), "nonce") {
+		t.Fatalf("err = %v, want a nonce mismatch", err)
+	}
+}
+
+func TestExchangeRejectsBadIDTokens(t *testing.T) {
+	for name, tc := range map[string]struct {
+		claims   func(jwt.MapClaims)
+		wrongKey bool
+	}{
+		"bad issuer":    {claims: func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" }},
+		"bad audience":  {claims: func(c jwt.MapClaims) { c["aud"] = "another-client" }},
+		"expired":       {claims: func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() }},
+		"no expiry":     {claims: func(c jwt.MapClaims) { delete(c, "exp") }},
+		"no subject":    {claims: func(c jwt.MapClaims) { delete(c, "sub") }},
+		"no nonce":      {claims: func(c jwt.MapClaims) { delete(c, "nonce") }},
+		"other azp":     {claims: func(c jwt.MapClaims) { c["aud"] = []string{"client-id", "other"}; c["azp"] = "other" }},
+		"bad signature": {wrongKey: true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			f := newFakeProvider(t)
+			f.claims = tc.claims
+			if tc.wrongKey {
+				f.signer = newKey(t)
+			}
+			p := f.provider()
+			req := newAuthRequest(t)
+
+			if claims, err := p.Exchange(context.Background(), f.login(t, p, req), req); err == nil {
+				t.Fatalf("ID token accepted: %+v", claims)
+			}
+		})
+	}
+}
+
+func TestVerifyIDTokenRejectsHS256(t *testing.T) {
+	f := newFakeProvider(t)
+	p := f.provider()
+
+	// Signed with the client secret, which an attacker might know
+	raw, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"iss": f.srv.URL, "aud": "client-id", "sub": "subject-1", "nonce": "n",
+		"exp": time.Now().Add(time.Minute).Unix(),
+	}).SignedString([]byte("client-secret"))
+	if _, err := p.VerifyIDToken(raw, "n"); err == nil {
+		t.Fatal("HS256 ID token accepted")
+	}
+}
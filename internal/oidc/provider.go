@@ -0,0 +1,207 @@
+// Package oidc signs users in with OpenID Connect providers using the
+// authorization code flow with PKCE
+package oidc
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/genosis18m/Metaverse_go/internal/utils"
+)
+
+// discoveryTTL is how long a provider's discovery document is used before
+// fetching it again
+const discoveryTTL = time.Hour
+
+// googleIssuer is used for the "google" provider when no issuer is configured
+const googleIssuer = "https://accounts.google.com"
+
+// ErrUnknownProvider is returned for a provider that is not configured
+var ErrUnknownProvider = errors.New("unknown OIDC provider")
+
+// Config configures a provider
+type Config struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+}
+
+// Discovery is the part of a provider's discovery document the login flow uses
+type Discovery struct {
+	Issuer                string   `json:"issuer"`
+	AuthorizationEndpoint string   `json:"authorization_endpoint"`
+	TokenEndpoint         string   `json:"token_endpoint"`
+	JWKSURI               string   `json:"jwks_uri"`
+	TokenAuthMethods      []string `json:"token_endpoint_auth_methods_supported"`
+}
+
+// Provider is a configured OpenID Connect provider
+type Provider struct {
+	Config
+	client *http.Client
+
+	mu           sync.Mutex
+	discovery    *Discovery
+	discoveredAt time.Time
+	keys         *utils.RemoteKeySet
+}
+
+// NewProvider creates a provider. A nil client uses a default one with a
+// short timeout.
+func NewProvider(config Config, client *http.Client) *Provider {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	if len(config.Scopes) == 0 {
+		config.Scopes = []string{"openid", "email", "profile"}
+	}
+	return &Provider{Config: config, client: client}
+}
+
+// Discover returns the provider's discovery document, fetching it from
+// <issuer>/.well-known/openid-configuration when it is missing or stale
+func (p *Provider) Discover() (*Discovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.discovery != nil && time.Since(p.discoveredAt) < discoveryTTL {
+		return p.discovery, nil
+	}
+
+	resp, err := p.client.Get(strings.TrimSuffix(p.Issuer, "/") + "/.well-known/openid-configuration")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("discovery: unexpected status %d", resp.StatusCode)
+	}
+
+	var discovery Discovery
+	if err := json.NewDecoder(resp.Body).Decode(&discovery); err != nil {
+		return nil, err
+	}
+	if discovery.Issuer != p.Issuer {
+		return nil, fmt.Errorf("discovery: issuer %q does not match %q", discovery.Issuer, p.Issuer)
+	}
+	if discovery.AuthorizationEndpoint == "" || discovery.TokenEndpoint == "" || discovery.JWKSURI == "" {
+		return nil, errors.New("discovery: missing endpoints")
+	}
+
+	if p.keys == nil || p.discovery == nil || p.discovery.JWKSURI != discovery.JWKSURI {
+		p.keys = utils.NewRemoteKeySet(discovery.JWKSURI, p.client)
+	}
+	p.discovery = &discovery
+	p.discoveredAt = time.Now()
+	return p.discovery, nil
+}
+
+func (p *Provider) keySet() *utils.RemoteKeySet {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.keys
+}
+
+var (
+	registryMu sync.RWMutex
+	registry   map[string]*Provider
+)
+
+// Register makes a provider available to Get, replacing one of the same name
+func Register(provider *Provider) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if registry == nil {
+		registry = make(map[string]*Provider)
+	}
+	registry[provider.Name] = provider
+}
+
+// Get returns a registered provider
+func Get(name string) (*Provider, error) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	if provider, ok := registry[name]; ok {
+		return provider, nil
+	}
+	return nil, ErrUnknownProvider
+}
+
+// Names returns the names of the registered providers
+func Names() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LoadFromEnv registers the providers listed in OIDC_PROVIDERS. Each one is
+// configured with OIDC_<NAME>_ISSUER, _CLIENT_ID, _CLIENT_SECRET,
+// _REDIRECT_URL and _SCOPES. The "google" provider defaults to Google's
+// issuer and falls back to the GOOGLE_* variables, and is enabled on its own
+// once it has a client ID.
+func LoadFromEnv() error {
+	names := strings.FieldsFunc(os.Getenv("OIDC_PROVIDERS"), func(r rune) bool { return r == ',' || r == ' ' })
+	if providerEnv("google", "CLIENT_ID") != "" && !contains(names, "google") {
+		names = append(names, "google")
+	}
+
+	for _, name := range names {
+		name = strings.ToLower(name)
+		config := Config{
+			Name:         name,
+			Issuer:       providerEnv(name, "ISSUER"),
+			ClientID:     providerEnv(name, "CLIENT_ID"),
+			ClientSecret: providerEnv(name, "CLIENT_SECRET"),
+			RedirectURL:  providerEnv(name, "REDIRECT_URL"),
+			Scopes:       strings.Fields(providerEnv(name, "SCOPES")),
+		}
+		if config.Issuer == "" && name == "google" {
+			config.Issuer = googleIssuer
+		}
+		if config.Issuer == "" || config.ClientID == "" || config.RedirectURL == "" {
+			return fmt.Errorf("OIDC provider %q needs an issuer, client ID and redirect URL", name)
+		}
+		Register(NewProvider(config, nil))
+	}
+	return nil
+}
+
+func providerEnv(name, key string) string {
+	prefix := strings.ToUpper(strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '_'
+	}, name))
+	if value := os.Getenv("OIDC_" + prefix + "_" + key); value != "" {
+		return value
+	}
+	if name == "google" {
+		return os.Getenv("GOOGLE_" + key)
+	}
+	return ""
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
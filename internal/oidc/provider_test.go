@@ -0,0 +1,90 @@
+package oidc
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestDiscover(t *testing.T) {
+	f := newFakeProvider(t)
+	p := f.provider()
+
+	discovery, err := p.Discover()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if discovery.TokenEndpoint != f.srv.URL+"/token" || discovery.JWKSURI != f.srv.URL+"/jwks" {
+		t.Fatalf("discovery = %+v", discovery)
+	}
+
+	// The document is cached
+	if _, err := p.Discover(); err != nil {
+		t.Fatal(err)
+	}
+	if f.discoveryRequests != 1 {
+		t.Fatalf("fetched discovery %d times, want 1", f.discoveryRequests)
+	}
+}
+
+func TestDiscoverRejectsOtherIssuer(t *testing.T) {
+	f := newFakeProvider(t)
+	f.issuer = "https://evil.example.com"
+
+	if _, err := f.provider().Discover(); err == nil {
+		t.Fatal("discovery document of another issuer accepted")
+	}
+}
+
+func TestDiscoverFailsForMissingDocument(t *testing.T) {
+	f := newFakeProvider(t)
+	p := NewProvider(Config{Name: "fake", Issuer: f.srv.URL + "/missing", ClientID: "client-id"}, f.srv.Client())
+
+	if _, err := p.Discover(); err == nil {
+		t.Fatal("expected an error")
+	}
+}
+
+func TestLoadFromEnv(t *testing.T) {
+	registryMu.Lock()
+	saved := registry
+	registry = nil
+	registryMu.Unlock()
+	t.Cleanup(func() {
+		registryMu.Lock()
+		registry = saved
+		registryMu.Unlock()
+	})
+
+	t.Setenv("OIDC_PROVIDERS", "okta")
+	t.Setenv("OIDC_OKTA_ISSUER", "https://example.okta.com")
+	t.Setenv("OIDC_OKTA_CLIENT_ID", "okta-client")
+	t.Setenv("OIDC_OKTA_REDIRECT_URL", "http://app.test/api/v1/auth/oidc/okta/callback")
+	t.Setenv("OIDC_OKTA_SCOPES", "openid email")
+	t.Setenv("GOOGLE_CLIENT_ID", "google-client")
+	t.Setenv("GOOGLE_REDIRECT_URL", "http://app.test/api/v1/auth/google/callback")
+
+	if err := LoadFromEnv(); err != nil {
+		t.Fatal(err)
+	}
+	if names := Names(); !reflect.DeepEqual(names, []string{"google", "okta"}) {
+		t.Fatalf("providers = %v", names)
+	}
+
+	google, _ := Get("google")
+	if google.Issuer != googleIssuer || google.ClientID != "google-client" {
+		t.Fatalf("google = %+v", google.Config)
+	}
+	okta, _ := Get("okta")
+	if !reflect.DeepEqual(okta.Scopes, []string{"openid", "email"}) {
+		t.Fatalf("okta scopes = %v", okta.Scopes)
+	}
+	if _, err := Get("github"); !errors.Is(err, ErrUnknownProvider) {
+		t.Fatalf("err = %v", err)
+	}
+
+	t.Setenv("OIDC_OKTA_ISSUER", "")
+	if err := LoadFromEnv(); err == nil {
+		t.Fatal("provider without an issuer accepted")
+	}
+}
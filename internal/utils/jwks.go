@@ -0,0 +1,227 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	// jwksRefreshInterval is how long fetched keys are used before fetching again
+	jwksRefreshInterval = 10 * time.Minute
+	// jwksMinFetchInterval limits fetches triggered by tokens with an unknown kid
+	jwksMinFetchInterval = 30 * time.Second
+)
+
+var jwksClient = &http.Client{Timeout: 5 * time.Second}
+
+// JWK is a public key in JSON Web Key format
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+// JWKS is a JSON Web Key Set
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// PublicJWKS returns the public parts of the keys in JWT_KEYS_DIR
+func PublicJWKS() JWKS {
+	set := JWKS{Keys: make([]JWK, 0)}
+	for _, key := range PublishedKeys() {
+		jwk := JWK{Kid: key.ID, Use: "sig", Alg: key.Algorithm}
+		switch pub := key.Public.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
+
+// publicKey decodes the key a JWK describes
+func (k JWK) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		key := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		if key.N.BitLen() < 2048 {
+			return nil, errors.New("RSA keys must be at least 2048 bits")
+		}
+		return key, nil
+	case "OKP":
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		if k.Crv != "Ed25519" || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		key := &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !curve.IsOnCurve(key.X, key.Y) {
+			return nil, errors.New("invalid EC key")
+		}
+		return key, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+// RemoteKeySet caches the keys published at a JWKS URL
+type RemoteKeySet struct {
+	url    string
+	client *http.Client
+
+	// fetchMu lets a single caller fetch at a time. The others wait for it
+	// and then use its result.
+	fetchMu sync.Mutex
+
+	mu        sync.RWMutex
+	keys      map[string]crypto.PublicKey
+	fetchedAt time.Time
+}
+
+// NewRemoteKeySet creates a cache for the keys at a JWKS URL. A nil client
+// uses a default one with a short timeout.
+func NewRemoteKeySet(url string, client *http.Client) *RemoteKeySet {
+	if client == nil {
+		client = jwksClient
+	}
+	return &RemoteKeySet{url: url, client: client}
+}
+
+// Key returns a published key, fetching the set again when it is stale or
+// does not have the kid yet. An empty kid matches a set of a single key.
+// Lookups are not blocked by a fetch, and a stale key is used while another
+// caller refreshes the set.
+func (r *RemoteKeySet) Key(kid string) (crypto.PublicKey, error) {
+	key, ok, fetchedAt := r.lookup(kid)
+	if !ok && time.Since(fetchedAt) > jwksMinFetchInterval {
+		r.fetchMu.Lock()
+		r.refresh()
+		r.fetchMu.Unlock()
+		key, ok, _ = r.lookup(kid)
+	} else if ok && time.Since(fetchedAt) > jwksRefreshInterval && r.fetchMu.TryLock() {
+		r.refresh()
+		r.fetchMu.Unlock()
+		key, ok, _ = r.lookup(kid)
+	}
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	return key, nil
+}
+
+// lookup finds a key in the cached set and returns when the set was fetched
+func (r *RemoteKeySet) lookup(kid string) (crypto.PublicKey, bool, time.Time) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if kid == "" && len(r.keys) == 1 {
+		for _, key := range r.keys {
+			return key, true, r.fetchedAt
+		}
+	}
+	key, ok := r.keys[kid]
+	return key, ok, r.fetchedAt
+}
+
+// refresh fetches the set unless a caller it waited for just did. The caller
+// must hold fetchMu.
+func (r *RemoteKeySet) refresh() {
+	r.mu.RLock()
+	recent := time.Since(r.fetchedAt) <= jwksMinFetchInterval
+	r.mu.RUnlock()
+	if recent {
+		return
+	}
+
+	keys, err := r.fetch()
+	r.mu.Lock()
+	r.fetchedAt = time.Now()
+	if err == nil {
+		r.keys = keys
+	}
+	r.mu.Unlock()
+	if err != nil {
+		log.Printf("Error fetching JWKS from %s: %v", r.url, err)
+	}
+}
+
+// fetch downloads the key set
+func (r *RemoteKeySet) fetch() (map[string]crypto.PublicKey, error) {
+	resp, err := r.client.Get(r.url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+
+	var set JWKS
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		key, err := jwk.publicKey()
+		if err != nil {
+			log.Printf("Skipping JWKS key %q: %v", jwk.Kid, err)
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+	return keys, nil
+}
@@ -1,6 +1,8 @@
 package utils
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"os"
 	"time"
@@ -8,46 +10,78 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 )
 
-// Claims represents JWT claims
+// Claims represents JWT claims. The token ID (jti) and the session ID let
+// tokens be revoked before they expire.
 type Claims struct {
-	UserID string `json:"userId"`
-	Role   string `json:"role"`
+	UserID    string `json:"userId"`
+	Role      string `json:"role"`
+	SessionID string `json:"sid,omitempty"`
 	jwt.RegisteredClaims
 }
 
-// GenerateToken creates a new JWT token for a user
-func GenerateToken(userID, role string) (string, error) {
-	secret := os.Getenv("JWT_SECRET")
-	if secret == "" {
-		return "", errors.New("JWT_SECRET not configured")
-	}
+// AccessTokenTTL is how long access tokens are valid, ACCESS_TOKEN_TTL or 15 minutes
+func AccessTokenTTL() time.Duration {
+	return envDuration("ACCESS_TOKEN_TTL", 15*time.Minute)
+}
+
+// RefreshTokenTTL is how long refresh tokens are valid, REFRESH_TOKEN_TTL or 30 days
+func RefreshTokenTTL() time.Duration {
+	return envDuration("REFRESH_TOKEN_TTL", 30*24*time.Hour)
+}
 
+// GenerateToken creates a new access token for a user session. Tokens are
+// signed with the active key of JWT_KEYS_DIR, or with HS256 and JWT_SECRET
+// when no asymmetric key is configured.
+func GenerateToken(userID, role, sessionID string) (string, error) {
+	now := time.Now()
 	claims := Claims{
-		UserID: userID,
-		Role:   role,
+		UserID:    userID,
+		Role:      role,
+		SessionID: sessionID,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ID:        GenerateCUID(),
+			ExpiresAt: jwt.NewNumericDate(now.Add(AccessTokenTTL())),
+			IssuedAt:  jwt.NewNumericDate(now),
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(secret))
-}
+	if key := SigningKeyFor(now); key != nil {
+		token := jwt.NewWithClaims(key.method(), claims)
+		token.Header["kid"] = key.ID
+		return token.SignedString(key.Private)
+	}
 
-// ValidateToken validates a JWT token and returns the claims
-func ValidateToken(tokenString string) (*Claims, error) {
 	secret := os.Getenv("JWT_SECRET")
 	if secret == "" {
-		return nil, errors.New("JWT_SECRET not configured")
+		return "", errors.New("no JWT signing key configured")
 	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString([]byte(secret))
+}
 
+// ValidateToken validates a JWT token and returns the claims. RS256 and EdDSA
+// tokens are checked against the key named by their kid; HS256 tokens are
+// accepted while JWT_SECRET is set. It does not check for revocation, see
+// database.IsTokenRevoked.
+func ValidateToken(tokenString string) (*Claims, error) {
 	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+		switch token.Method.(type) {
+		case *jwt.SigningMethodHMAC:
+			secret := os.Getenv("JWT_SECRET")
+			if secret == "" {
+				return nil, errors.New("HS256 tokens are not accepted")
+			}
+			return []byte(secret), nil
+		case *jwt.SigningMethodRSA, *jwt.SigningMethodEd25519:
+			kid, _ := token.Header["kid"].(string)
+			if kid == "" {
+				return nil, errors.New("token has no key ID")
+			}
+			return PublicKey(kid)
+		default:
 			return nil, errors.New("invalid signing method")
 		}
-		return []byte(secret), nil
-	})
+	}, jwt.WithValidMethods([]string{"HS256", "RS256", "EdDSA"}))
 
 	if err != nil {
 		return nil, err
@@ -59,3 +93,22 @@ func ValidateToken(tokenString string) (*Claims, error) {
 
 	return nil, errors.New("invalid token")
 }
+
+// GenerateRefreshToken creates a random refresh token and the hash to store for it
+func GenerateRefreshToken() (token, hash string) {
+	token = GenerateRandomString(48)
+	return token, HashToken(token)
+}
+
+// HashToken returns the hex SHA-256 hash of a token
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func envDuration(key string, fallback time.Duration) time.Duration {
+	if d, err := time.ParseDuration(os.Getenv(key)); err == nil && d > 0 {
+		return d
+	}
+	return fallback
+}
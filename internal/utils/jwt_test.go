@@ -0,0 +1,103 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// withKeys points the keyring at a key directory and JWKS URL for a test,
+// either of which may be empty
+func withKeys(t *testing.T, dir, jwksURL string) {
+	t.Helper()
+	t.Setenv("JWT_KEYS_DIR", dir)
+	t.Setenv("JWT_JWKS_URL", jwksURL)
+	keys = &keyring{}
+	t.Cleanup(func() { keys = &keyring{} })
+}
+
+func TestGenerateTokenWithSecret(t *testing.T) {
+	withKeys(t, "", "")
+	t.Setenv("JWT_SECRET", "test-secret")
+	t.Setenv("ACCESS_TOKEN_TTL", "2m")
+
+	raw, err := GenerateToken("user-1", "User", "session-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	claims, err := ValidateToken(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.UserID != "user-1" || claims.Role != "User" || claims.SessionID != "session-1" {
+		t.Fatalf("claims = %+v", claims)
+	}
+	if ttl := claims.ExpiresAt.Sub(claims.IssuedAt.Time); ttl != 2*time.Minute {
+		t.Fatalf("token lives for %s, want ACCESS_TOKEN_TTL", ttl)
+	}
+
+	// Every token has its own ID so it can be denied on its own
+	other, _ := GenerateToken("user-1", "User", "session-1")
+	otherClaims, err := ValidateToken(other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.ID == "" || claims.ID == otherClaims.ID {
+		t.Fatalf("token IDs %q and %q, want distinct IDs", claims.ID, otherClaims.ID)
+	}
+}
+
+func TestValidateTokenRejects(t *testing.T) {
+	withKeys(t, "", "")
+	t.Setenv("JWT_SECRET", "test-secret")
+
+	sign := func(method jwt.SigningMethod, key interface{}, claims Claims) string {
+		raw, err := jwt.NewWithClaims(method, claims).SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return raw
+	}
+	valid := Claims{UserID: "user-1", RegisteredClaims: jwt.RegisteredClaims{
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+	}}
+	expired := Claims{UserID: "user-1", RegisteredClaims: jwt.RegisteredClaims{
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(-time.Minute)),
+	}}
+
+	for name, raw := range map[string]string{
+		"wrong secret": sign(jwt.SigningMethodHS256, []byte("other-secret"), valid),
+		"expired":      sign(jwt.SigningMethodHS256, []byte("test-secret"), expired),
+		"none":         sign(jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, valid),
+		"HS512":        sign(jwt.SigningMethodHS512, []byte("test-secret"), valid),
+		"garbage":      "not.a.token",
+	} {
+		if _, err := ValidateToken(raw); err == nil {
+			t.Errorf("%s: token accepted", name)
+		}
+	}
+
+	// HS256 stops being accepted once the secret is removed
+	raw := sign(jwt.SigningMethodHS256, []byte("test-secret"), valid)
+	t.Setenv("JWT_SECRET", "")
+	if _, err := ValidateToken(raw); err == nil {
+		t.Error("HS256 token accepted without JWT_SECRET")
+	}
+}
+
+func TestGenerateRefreshToken(t *testing.T) {
+	token, hash := GenerateRefreshToken()
+	other, otherHash := GenerateRefreshToken()
+
+	if len(token) != 48 || token == other {
+		t.Fatalf("refresh tokens %q and %q", token, other)
+	}
+	if hash != HashToken(token) || hash == otherHash {
+		t.Fatal("the stored hash does not identify the token")
+	}
+	if len(hash) != 64 || strings.Contains(hash, token) {
+		t.Fatalf("hash = %q", hash)
+	}
+}
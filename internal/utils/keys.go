@@ -0,0 +1,212 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// keyReloadInterval is how often the key directory is read again, so keys
+// dropped in for a rotation are picked up without a restart
+const keyReloadInterval = 5 * time.Minute
+
+// SigningKey is an asymmetric JWT key identified by its kid. Keys without a
+// private part can only verify tokens.
+type SigningKey struct {
+	ID         string
+	Algorithm  string
+	ActiveFrom time.Time
+	Private    crypto.Signer
+	Public     crypto.PublicKey
+}
+
+func (k *SigningKey) method() jwt.SigningMethod {
+	if k.Algorithm == "EdDSA" {
+		return jwt.SigningMethodEdDSA
+	}
+	return jwt.SigningMethodRS256
+}
+
+// keyring holds the keys read from JWT_KEYS_DIR and those fetched from JWT_JWKS_URL
+type keyring struct {
+	mu       sync.RWMutex
+	local    map[string]*SigningKey
+	loadedAt time.Time
+	remote   *RemoteKeySet
+}
+
+var keys = &keyring{}
+
+// SigningKeyFor returns the key new tokens are signed with: the private key
+// that became active most recently. It returns nil when only HS256 is configured.
+func SigningKeyFor(now time.Time) *SigningKey {
+	var current *SigningKey
+	for _, key := range keys.localKeys() {
+		if key.Private == nil || key.ActiveFrom.After(now) {
+			continue
+		}
+		if current == nil || key.ActiveFrom.After(current.ActiveFrom) ||
+			(key.ActiveFrom.Equal(current.ActiveFrom) && key.ID > current.ID) {
+			current = key
+		}
+	}
+	return current
+}
+
+// PublicKey returns the key to verify a token signed with the given kid,
+// looking in JWT_KEYS_DIR first and then at JWT_JWKS_URL
+func PublicKey(kid string) (crypto.PublicKey, error) {
+	if key, ok := keys.localKeys()[kid]; ok {
+		return key.Public, nil
+	}
+	if remote := keys.remoteKeys(); remote != nil {
+		return remote.Key(kid)
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// PublishedKeys returns every key in JWT_KEYS_DIR, including keys that are
+// not active yet so verifiers learn about them before they are used
+func PublishedKeys() []*SigningKey {
+	local := keys.localKeys()
+	published := make([]*SigningKey, 0, len(local))
+	for _, key := range local {
+		published = append(published, key)
+	}
+	sort.Slice(published, func(i, j int) bool { return published[i].ID < published[j].ID })
+	return published
+}
+
+// localKeys returns the keys of JWT_KEYS_DIR, reading the directory again
+// once keyReloadInterval has passed
+func (r *keyring) localKeys() map[string]*SigningKey {
+	r.mu.RLock()
+	local, loadedAt := r.local, r.loadedAt
+	r.mu.RUnlock()
+	if local != nil && time.Since(loadedAt) < keyReloadInterval {
+		return local
+	}
+
+	dir := os.Getenv("JWT_KEYS_DIR")
+	loaded := make(map[string]*SigningKey)
+	if dir != "" {
+		var err error
+		if loaded, err = LoadKeys(dir); err != nil {
+			log.Printf("Error loading JWT keys: %v", err)
+			if local != nil {
+				loaded = local
+			}
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.local = loaded
+	r.loadedAt = time.Now()
+	return loaded
+}
+
+func (r *keyring) remoteKeys() *RemoteKeySet {
+	jwksURL := os.Getenv("JWT_JWKS_URL")
+	if jwksURL == "" {
+		return nil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.remote == nil || r.remote.url != jwksURL {
+		r.remote = NewRemoteKeySet(jwksURL, nil)
+	}
+	return r.remote
+}
+
+// LoadKeys reads the PEM keys of a directory. Each file is named <kid>.pem and
+// holds an RSA or Ed25519 private key, or a public key for verifying only. A
+// kid starting with a date (2006-01-02) becomes active on that day, which is
+// how rotations are scheduled; other keys are active right away.
+func LoadKeys(dir string) (map[string]*SigningKey, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+
+	loaded := make(map[string]*SigningKey, len(paths))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		kid := strings.TrimSuffix(filepath.Base(path), ".pem")
+		key, err := parseKey(kid, data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		loaded[kid] = key
+	}
+	return loaded, nil
+}
+
+func parseKey(kid string, data []byte) (*SigningKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	key := &SigningKey{ID: kid}
+	if len(kid) >= 10 {
+		if activeFrom, err := time.Parse("2006-01-02", kid[:10]); err == nil {
+			key.ActiveFrom = activeFrom
+		}
+	}
+
+	var parsed interface{}
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		key.Private, key.Public = k, &k.PublicKey
+	case ed25519.PrivateKey:
+		key.Private, key.Public = k, k.Public()
+	case *rsa.PublicKey, ed25519.PublicKey:
+		key.Public = k
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", parsed)
+	}
+
+	switch pub := key.Public.(type) {
+	case *rsa.PublicKey:
+		if pub.N.BitLen() < 2048 {
+			return nil, errors.New("RSA keys must be at least 2048 bits")
+		}
+		key.Algorithm = "RS256"
+	case ed25519.PublicKey:
+		key.Algorithm = "EdDSA"
+	}
+	return key, nil
+}
@@ -0,0 +1,388 @@
+package utils
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// writeKey stores a key as <kid>.pem in a directory
+func writeKey(t *testing.T, dir, kid string, key interface{}) {
+	t.Helper()
+	var block *pem.Block
+	switch k := key.(type) {
+	case ed25519.PublicKey, *rsa.PublicKey:
+		der, err := x509.MarshalPKIXPublicKey(k)
+		if err != nil {
+			t.Fatal(err)
+		}
+		block = &pem.Block{Type: "PUBLIC KEY", Bytes: der}
+	default:
+		der, err := x509.MarshalPKCS8PrivateKey(k)
+		if err != nil {
+			t.Fatal(err)
+		}
+		block = &pem.Block{Type: "PRIVATE KEY", Bytes: der}
+	}
+	if err := os.WriteFile(filepath.Join(dir, kid+".pem"), pem.EncodeToMemory(block), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func newEd25519Key(t *testing.T) ed25519.PrivateKey {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func newRSAKey(t *testing.T, bits int) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, bits)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func day(s string) time.Time {
+	d, _ := time.Parse("2006-01-02", s)
+	return d
+}
+
+func TestLoadKeys(t *testing.T) {
+	dir := t.TempDir()
+	writeKey(t, dir, "2024-01-01-ed", newEd25519Key(t))
+	writeKey(t, dir, "legacy", newRSAKey(t, 2048))
+	writeKey(t, dir, "verify-only", newEd25519Key(t).Public())
+	os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("ignored"), 0o600)
+
+	loaded, err := LoadKeys(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded) != 3 {
+		t.Fatalf("loaded %d keys, want 3", len(loaded))
+	}
+	if key := loaded["2024-01-01-ed"]; key.Algorithm != "EdDSA" || !key.ActiveFrom.Equal(day("2024-01-01")) {
+		t.Fatalf("dated key = %+v", key)
+	}
+	if key := loaded["legacy"]; key.Algorithm != "RS256" || !key.ActiveFrom.IsZero() || key.Private == nil {
+		t.Fatalf("undated key = %+v", key)
+	}
+	if key := loaded["verify-only"]; key.Private != nil || key.Public == nil {
+		t.Fatalf("public key = %+v", key)
+	}
+
+	weak := t.TempDir()
+	writeKey(t, weak, "weak", newRSAKey(t, 1024))
+	if _, err := LoadKeys(weak); err == nil {
+		t.Fatal("a 1024-bit RSA key was accepted")
+	}
+}
+
+func TestSigningKeyForFollowsRotation(t *testing.T) {
+	dir := t.TempDir()
+	writeKey(t, dir, "legacy", newRSAKey(t, 2048))
+	writeKey(t, dir, "2024-01-01-a", newEd25519Key(t))
+	writeKey(t, dir, "2024-06-01-b", newEd25519Key(t))
+	// Public keys are never used for signing, however recent
+	writeKey(t, dir, "2024-09-01-c", newEd25519Key(t).Public())
+	withKeys(t, dir, "")
+
+	for now, want := range map[string]string{
+		"2023-12-31": "legacy",
+		"2024-01-01": "2024-01-01-a",
+		"2024-05-31": "2024-01-01-a",
+		"2024-06-01": "2024-06-01-b",
+		"2025-01-01": "2024-06-01-b",
+	} {
+		if key := SigningKeyFor(day(now)); key == nil || key.ID != want {
+			t.Errorf("signing key on %s = %v, want %s", now, key, want)
+		}
+	}
+
+	// Keys that are not active yet are published ahead of time
+	set := PublicJWKS()
+	if len(set.Keys) != 4 {
+		t.Fatalf("published %d keys, want 4", len(set.Keys))
+	}
+}
+
+func TestTokensVerifyAcrossRotation(t *testing.T) {
+	dir := t.TempDir()
+	writeKey(t, dir, "2000-01-01-old", newEd25519Key(t))
+	withKeys(t, dir, "")
+	t.Setenv("JWT_SECRET", "")
+
+	old, err := GenerateToken("user-1", "User", "session-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A new key is added and becomes active
+	writeKey(t, dir, "2001-01-01-new", newRSAKey(t, 2048))
+	withKeys(t, dir, "")
+	current, err := GenerateToken("user-1", "User", "session-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for name, raw := range map[string]string{"old": old, "current": current} {
+		if _, err := ValidateToken(raw); err != nil {
+			t.Errorf("%s token: %v", name, err)
+		}
+	}
+
+	// Once the old key is removed its tokens stop verifying
+	os.Remove(filepath.Join(dir, "2000-01-01-old.pem"))
+	withKeys(t, dir, "")
+	if _, err := ValidateToken(old); err == nil {
+		t.Fatal("token of a removed key accepted")
+	}
+	if _, err := ValidateToken(current); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPublicJWKSRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	ed := newEd25519Key(t)
+	rsaKey := newRSAKey(t, 2048)
+	writeKey(t, dir, "ed", ed)
+	writeKey(t, dir, "rsa", rsaKey)
+	withKeys(t, dir, "")
+
+	data, err := json.Marshal(PublicJWKS())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var set JWKS
+	if err := json.Unmarshal(data, &set); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]crypto.PublicKey{"ed": ed.Public(), "rsa": &rsaKey.PublicKey}
+	for _, jwk := range set.Keys {
+		if jwk.Use != "sig" {
+			t.Errorf("%s: use = %q", jwk.Kid, jwk.Use)
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			t.Fatalf("%s: %v", jwk.Kid, err)
+		}
+		if !key.(interface{ Equal(crypto.PublicKey) bool }).Equal(want[jwk.Kid]) {
+			t.Errorf("%s: published key does not match", jwk.Kid)
+		}
+	}
+}
+
+// serveJWKS publishes the keys of a directory like the /.well-known/jwks.json
+// endpoint of another instance, counting the requests
+func serveJWKS(t *testing.T, dir string) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	loaded, err := LoadKeys(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := keys
+	keys = &keyring{local: loaded, loadedAt: time.Now()}
+	set := PublicJWKS()
+	keys = saved
+
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		json.NewEncoder(w).Encode(set)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &requests
+}
+
+func TestRemoteKeySet(t *testing.T) {
+	dir := t.TempDir()
+	ed := newEd25519Key(t)
+	writeKey(t, dir, "ed", ed)
+	srv, requests := serveJWKS(t, dir)
+
+	set := NewRemoteKeySet(srv.URL, nil)
+	key, err := set.Key("ed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ed.Public().(ed25519.PublicKey).Equal(key) {
+		t.Fatal("fetched key does not match")
+	}
+	// A set of a single key also matches tokens without a kid
+	if _, err := set.Key(""); err != nil {
+		t.Fatal(err)
+	}
+
+	// Unknown kids do not trigger a fetch for every token
+	for i := 0; i < 5; i++ {
+		if _, err := set.Key("unknown"); err == nil {
+			t.Fatal("unknown kid accepted")
+		}
+	}
+	if n := requests.Load(); n != 1 {
+		t.Fatalf("fetched the set %d times, want 1", n)
+	}
+}
+
+// serveSlowJWKS publishes a set whose requests wait until release is closed
+func serveSlowJWKS(t *testing.T, set JWKS) (url string, requests *atomic.Int32, release chan struct{}) {
+	t.Helper()
+	requests, release = new(atomic.Int32), make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		<-release
+		json.NewEncoder(w).Encode(set)
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL, requests, release
+}
+
+func TestRemoteKeySetFetchesOnce(t *testing.T) {
+	ed := newEd25519Key(t)
+	url, requests, release := serveSlowJWKS(t, JWKS{Keys: []JWK{{
+		Kty: "OKP", Crv: "Ed25519", Kid: "ed",
+		X: base64.RawURLEncoding.EncodeToString(ed.Public().(ed25519.PublicKey)),
+	}}})
+	set := NewRemoteKeySet(url, nil)
+
+	// Callers that miss the kid during a fetch wait for it instead of
+	// fetching again
+	var wg sync.WaitGroup
+	errs := make(chan error, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := set.Key("ed")
+			errs <- err
+		}()
+	}
+	for requests.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := requests.Load(); n != 1 {
+		t.Fatalf("fetched the set %d times, want 1", n)
+	}
+}
+
+func TestRemoteKeySetServesStaleKeysDuringFetch(t *testing.T) {
+	ed := newEd25519Key(t)
+	url, requests, release := serveSlowJWKS(t, JWKS{})
+	set := NewRemoteKeySet(url, nil)
+	set.keys = map[string]crypto.PublicKey{"ed": ed.Public()}
+	set.fetchedAt = time.Now().Add(-jwksRefreshInterval - time.Minute)
+
+	// The first caller refreshes the stale set and blocks on the request
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		set.Key("ed")
+	}()
+	for requests.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// Others keep using the cached key meanwhile
+	lookup := make(chan error, 1)
+	go func() {
+		_, err := set.Key("ed")
+		lookup <- err
+	}()
+	select {
+	case err := <-lookup:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("a lookup waited for the fetch")
+	}
+	close(release)
+	<-done
+}
+
+func TestRemoteKeySetSkipsSmallRSAKeys(t *testing.T) {
+	jwk := func(kid string, key *rsa.PrivateKey) JWK {
+		return JWK{
+			Kty: "RSA", Kid: kid,
+			N: base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E: base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}
+	}
+	url, _, release := serveSlowJWKS(t, JWKS{Keys: []JWK{
+		jwk("weak", newRSAKey(t, 1024)),
+		jwk("strong", newRSAKey(t, 2048)),
+	}})
+	close(release)
+
+	set := NewRemoteKeySet(url, nil)
+	if _, err := set.Key("strong"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := set.Key("weak"); err == nil {
+		t.Fatal("a 1024-bit RSA key was accepted")
+	}
+}
+
+func TestValidateTokenWithRemoteKeys(t *testing.T) {
+	signer := t.TempDir()
+	writeKey(t, signer, "2020-01-01-http", newEd25519Key(t))
+	withKeys(t, signer, "")
+	t.Setenv("JWT_SECRET", "")
+	raw, err := GenerateToken("user-1", "User", "session-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A server without the private keys verifies with the published set
+	srv, _ := serveJWKS(t, signer)
+	withKeys(t, "", srv.URL)
+	claims, err := ValidateToken(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.UserID != "user-1" {
+		t.Fatalf("claims = %+v", claims)
+	}
+
+	// Tokens signed with keys the set does not publish are rejected
+	other := t.TempDir()
+	writeKey(t, other, "2020-01-01-http", newEd25519Key(t))
+	withKeys(t, other, "")
+	forged, err := GenerateToken("user-1", "Admin", "session-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	withKeys(t, "", srv.URL)
+	if _, err := ValidateToken(forged); err == nil {
+		t.Fatal("token signed with an unpublished key accepted")
+	}
+}
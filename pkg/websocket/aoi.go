@@ -0,0 +1,223 @@
+package websocket
+
+// ViewRadius is how many tiles around a user movement and presence are streamed.
+// Zero disables area-of-interest filtering so every user sees the whole room.
+var ViewRadius = 0
+
+// cell is the coordinate of a bucket in a spatial index
+type cell struct {
+	x, y int
+}
+
+// spatialIndex is a spatial hash of the users in a room keyed by their tile
+type spatialIndex struct {
+	cellSize int
+	cells    map[cell]map[string]*User
+	cellOf   map[string]cell
+}
+
+func newSpatialIndex() *spatialIndex {
+	size := ViewRadius
+	if size < 8 {
+		size = 8
+	}
+	return &spatialIndex{
+		cellSize: size,
+		cells:    make(map[cell]map[string]*User),
+		cellOf:   make(map[string]cell),
+	}
+}
+
+func (ix *spatialIndex) cellAt(x, y int) cell {
+	return cell{x: floorDiv(x, ix.cellSize), y: floorDiv(y, ix.cellSize)}
+}
+
+// update inserts a user or moves it to the bucket of its current tile
+func (ix *spatialIndex) update(u *User) {
+	c := ix.cellAt(u.X, u.Y)
+	if old, exists := ix.cellOf[u.ID]; exists && old != c {
+		ix.removeFrom(old, u.ID)
+	}
+	if _, exists := ix.cells[c]; !exists {
+		ix.cells[c] = make(map[string]*User)
+	}
+	ix.cells[c][u.ID] = u
+	ix.cellOf[u.ID] = c
+}
+
+// remove drops a user from the index
+func (ix *spatialIndex) remove(u *User) {
+	if c, exists := ix.cellOf[u.ID]; exists {
+		ix.removeFrom(c, u.ID)
+		delete(ix.cellOf, u.ID)
+	}
+}
+
+func (ix *spatialIndex) removeFrom(c cell, id string) {
+	delete(ix.cells[c], id)
+	if len(ix.cells[c]) == 0 {
+		delete(ix.cells, c)
+	}
+}
+
+// near calls fn for every user within radius tiles of (x, y) on both axes
+func (ix *spatialIndex) near(x, y, radius int, fn func(*User)) {
+	from := ix.cellAt(x-radius, y-radius)
+	to := ix.cellAt(x+radius, y+radius)
+	for cy := from.y; cy <= to.y; cy++ {
+		for cx := from.x; cx <= to.x; cx++ {
+			for _, u := range ix.cells[cell{x: cx, y: cy}] {
+				if abs(u.X-x) <= radius && abs(u.Y-y) <= radius {
+					fn(u)
+				}
+			}
+		}
+	}
+}
+
+func floorDiv(a, b int) int {
+	if a < 0 {
+		return (a - b + 1) / b
+	}
+	return a / b
+}
+
+// index returns the spatial index of a room. The caller must hold the lock.
+func (rm *RoomManager) index(spaceID string) *spatialIndex {
+	ix, exists := rm.indexes[spaceID]
+	if !exists {
+		ix = newSpatialIndex()
+		rm.indexes[spaceID] = ix
+	}
+	return ix
+}
+
+// viewEvent is a pending user-entered-view/user-exited-view notification.
+// The message is built under the room lock, like proximity events.
+type viewEvent struct {
+	to      *User
+	message OutgoingMessage
+}
+
+// newViewEvent tells a user that another one entered or left its view. The
+// caller must hold the lock.
+func newViewEvent(to *User, msgType MessageType, other *User) viewEvent {
+	return viewEvent{to: to, message: OutgoingMessage{
+		Type: msgType,
+		Payload: ViewPayload{
+			UserID:   other.UserID,
+			Username: other.Username,
+			X:        other.X,
+			Y:        other.Y,
+		},
+	}}
+}
+
+// refreshView re-indexes a user, marks its tile on the grid and recomputes
+// who it can see. With notify unset the visibility changes are applied
+// silently, which is used on join where user-joined already tells the room.
+// The caller must hold the lock.
+func (rm *RoomManager) refreshView(u *User, notify bool) []viewEvent {
+	rm.index(u.SpaceID).update(u)
+	if grid, exists := rm.grids[u.SpaceID]; exists {
+		grid.Occupy(u.ID, u.X, u.Y)
+	}
+	if ViewRadius <= 0 {
+		return nil
+	}
+
+	events := make([]viewEvent, 0)
+	inView := make(map[string]bool)
+	rm.index(u.SpaceID).near(u.X, u.Y, ViewRadius, func(other *User) {
+		if other.ID == u.ID {
+			return
+		}
+		inView[other.ID] = true
+		if _, visible := u.visible[other.ID]; visible {
+			return
+		}
+		u.visible[other.ID] = other
+		other.visible[u.ID] = u
+		if notify {
+			events = append(events,
+				newViewEvent(u, TypeUserEnteredView, other),
+				newViewEvent(other, TypeUserEnteredView, u),
+			)
+		}
+	})
+
+	for id, other := range u.visible {
+		if inView[id] {
+			continue
+		}
+		delete(u.visible, id)
+		delete(other.visible, u.ID)
+		if notify {
+			events = append(events,
+				newViewEvent(u, TypeUserExitedView, other),
+				newViewEvent(other, TypeUserExitedView, u),
+			)
+		}
+	}
+	return events
+}
+
+// clearView removes a leaving user from the index, the grid and every view.
+// The caller must hold the lock.
+func (rm *RoomManager) clearView(u *User) {
+	if ix, exists := rm.indexes[u.SpaceID]; exists {
+		ix.remove(u)
+	}
+	if grid, exists := rm.grids[u.SpaceID]; exists {
+		grid.Vacate(u.ID)
+	}
+	for id, other := range u.visible {
+		delete(other.visible, u.ID)
+		delete(u.visible, id)
+	}
+}
+
+// MoveUser sets the position of a user and recomputes its area of interest.
+// Other goroutines read positions under the room lock, so the position is
+// only written here, together with the spatial index.
+func (rm *RoomManager) MoveUser(u *User, x, y int) {
+	rm.mu.Lock()
+	u.X = x
+	u.Y = y
+	events := rm.refreshView(u, true)
+	rm.mu.Unlock()
+
+	sendViewEvents(events)
+}
+
+// CanSee reports whether a user receives the movement and presence of another
+func (rm *RoomManager) CanSee(u, other *User) bool {
+	rm.mu.RLock()
+	defer rm.mu.RUnlock()
+
+	return canSee(u, other.ID)
+}
+
+// canSee reports whether a user is within view of a subject. The caller must hold the lock.
+func canSee(u *User, subjectID string) bool {
+	if ViewRadius <= 0 || u.ID == subjectID {
+		return true
+	}
+	_, visible := u.visible[subjectID]
+	return visible
+}
+
+// isSpatial reports whether a message is only of interest to users in view of its sender
+func isSpatial(msgType MessageType) bool {
+	return msgType == TypeMovement || msgType == TypeUserJoined || msgType == TypeUserLeft
+}
+
+func sendViewEvents(events []viewEvent) {
+	for _, e := range events {
+		// Remote users get their view events from their own node
+		if e.to.remote {
+			continue
+		}
+		e.to.Send(e.message)
+	}
+}
@@ -0,0 +1,123 @@
+package websocket
+
+import (
+	"runtime"
+	"sync"
+	"testing"
+)
+
+func TestMoveUserWritesPositionUnderRoomLock(t *testing.T) {
+	rm := newTestRoomManager()
+	mover, _ := newTestUser(t, "")
+	watcher, _ := newTestUser(t, "")
+	for _, u := range []*User{mover, watcher} {
+		u.SpaceID = "space-1"
+		u.SpaceWidth, u.SpaceHeight = 100, 100
+		rm.AddUser("space-1", u)
+	}
+
+	// Run with -race: readers of other users' positions hold the room lock
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 200; i++ {
+			rm.MoveUser(mover, i%50, i%50)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 200; i++ {
+			rm.UsersWithin("space-1", 0, 0, 100)
+			rm.CanSee(watcher, mover)
+		}
+	}()
+	wg.Wait()
+
+	rm.MoveUser(mover, 7, 9)
+	users := rm.UsersWithin("space-1", 7, 9, 0)
+	if len(users) != 1 || users[0] != mover {
+		t.Fatalf("users at the new position = %v, want the mover", users)
+	}
+}
+
+func TestConcurrentMoveAndJoin(t *testing.T) {
+	withQueueSize(t, 4096)
+	rm := newTestRoomManager()
+	mover, _ := newTestUser(t, "")
+	mover.SpaceID = "space-1"
+	mover.SpaceWidth, mover.SpaceHeight = 100, 100
+	rm.AddUser("space-1", mover)
+
+	joiners := make([]*User, 5)
+	for i := range joiners {
+		joiners[i], _ = newTestUser(t, "")
+		joiners[i].SpaceID = "space-1"
+		joiners[i].X, joiners[i].Y = 2*i, 2*i
+	}
+
+	// Run with -race: every event and room state payload carrying the
+	// mover's position is built while the room lock is held
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+		for i := 0; ; i++ {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			rm.MoveUser(mover, i%10, i%10)
+			rm.UpdateProximity(mover)
+			runtime.Gosched()
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			rm.trackRemote("space-1", &RemoteUser{ID: "remote-1", UserID: "user-2", X: i % 10, Y: i % 10}, false)
+			runtime.Gosched()
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		defer close(done)
+		for _, joiner := range joiners {
+			rm.AddUser("space-1", joiner)
+			rm.VisibleUsers(joiner)
+			rm.UpdateProximity(joiner)
+		}
+		for i := 0; i < 200; i++ {
+			rm.VisibleUsers(joiners[i%len(joiners)])
+			runtime.Gosched()
+		}
+	}()
+	wg.Wait()
+
+	users := rm.VisibleUsers(joiners[0])
+	if len(users) != len(joiners)+1 {
+		t.Fatalf("joiner sees %d users, want %d", len(users), len(joiners)+1)
+	}
+}
+
+func TestQueriesDoNotRecreateRemovedRooms(t *testing.T) {
+	rm := newTestRoomManager()
+	u, _ := newTestUser(t, "")
+	u.SpaceID = "space-1"
+	rm.AddUser("space-1", u)
+	rm.RemoveUser(u, "space-1")
+
+	// A late proximity update or nearby chat from the user that just left
+	rm.UpdateProximity(u)
+	if users := rm.UsersWithin("space-1", 0, 0, 10); len(users) != 0 {
+		t.Fatalf("removed room has users %v", users)
+	}
+
+	rm.mu.RLock()
+	defer rm.mu.RUnlock()
+	if _, exists := rm.indexes["space-1"]; exists {
+		t.Fatal("the spatial index of the removed room was recreated")
+	}
+}
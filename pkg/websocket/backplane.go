@@ -0,0 +1,144 @@
+package websocket
+
+import (
+	"fmt"
+	"net/url"
+	"sync"
+)
+
+// EnvelopeKind identifies what a backplane envelope carries
+type EnvelopeKind string
+
+const (
+	// EnvelopeBroadcast delivers a message to every local user in the room except ExcludeID
+	EnvelopeBroadcast EnvelopeKind = "broadcast"
+	// EnvelopeDirect delivers a message to the single connection TargetID
+	EnvelopeDirect EnvelopeKind = "direct"
+	// EnvelopePresence announces or refreshes a remote user in the room
+	EnvelopePresence EnvelopeKind = "presence"
+	// EnvelopeUser delivers a message to every local connection of the user TargetID
+	EnvelopeUser EnvelopeKind = "user"
+	// EnvelopeKick disconnects the local connections of the user TargetID from the room
+	EnvelopeKick EnvelopeKind = "kick"
+	// EnvelopeLeave removes a remote user from the room
+	EnvelopeLeave EnvelopeKind = "leave"
+	// EnvelopeSync asks the other nodes to announce their users in the room
+	EnvelopeSync EnvelopeKind = "sync"
+)
+
+// Envelope is a room event exchanged between WebSocket server nodes
+type Envelope struct {
+	NodeID    string           `json:"nodeId"`
+	Kind      EnvelopeKind     `json:"kind"`
+	SpaceID   string           `json:"spaceId"`
+	ExcludeID string           `json:"excludeId,omitempty"`
+	TargetID  string           `json:"targetId,omitempty"`
+	Message   *OutgoingMessage `json:"message,omitempty"`
+	User      *RemoteUser      `json:"user,omitempty"`
+}
+
+// RemoteUser describes a user connected to another node
+type RemoteUser struct {
+	ID       string `json:"id"`
+	UserID   string `json:"userId"`
+	Username string `json:"username"`
+	X        int    `json:"x"`
+	Y        int    `json:"y"`
+}
+
+// Backplane fans room events out to every WebSocket server node. Topics are
+// space IDs, or "user:<id>" for the direct messages of a user. The room
+// manager calls it while holding its lock on joins and leaves, so
+// implementations must queue network I/O rather than wait for it.
+type Backplane interface {
+	// Publish sends an envelope to every subscriber of the space, including this node
+	Publish(spaceID string, env Envelope) error
+	// Subscribe registers a handler for the envelopes of a space and returns a
+	// function that removes it. ready, if not nil, is called once envelopes
+	// published by other nodes are being received, from a goroutine of the
+	// backplane rather than from Subscribe itself.
+	Subscribe(spaceID string, handler func(Envelope), ready func()) (func(), error)
+	// Close releases the resources held by the backplane
+	Close() error
+}
+
+// NewBackplane creates a backplane from a URL such as redis://:password@host:6379/0.
+// An empty URL or "memory" selects the in-memory backplane.
+func NewBackplane(rawURL string) (Backplane, error) {
+	if rawURL == "" || rawURL == "memory" {
+		return NewMemoryBackplane(), nil
+	}
+
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	switch parsed.Scheme {
+	case "redis":
+		return NewRedisBackplane(parsed)
+	default:
+		return nil, fmt.Errorf("unsupported backplane scheme %q", parsed.Scheme)
+	}
+}
+
+// MemoryBackplane is a process-local backplane, used by single-node deployments
+type MemoryBackplane struct {
+	mu     sync.RWMutex
+	nextID int
+	subs   map[string]map[int]func(Envelope)
+}
+
+// NewMemoryBackplane creates an empty in-memory backplane
+func NewMemoryBackplane() *MemoryBackplane {
+	return &MemoryBackplane{
+		subs: make(map[string]map[int]func(Envelope)),
+	}
+}
+
+// Publish delivers an envelope to the handlers subscribed to the space
+func (b *MemoryBackplane) Publish(spaceID string, env Envelope) error {
+	b.mu.RLock()
+	handlers := make([]func(Envelope), 0, len(b.subs[spaceID]))
+	for _, handler := range b.subs[spaceID] {
+		handlers = append(handlers, handler)
+	}
+	b.mu.RUnlock()
+
+	for _, handler := range handlers {
+		handler(env)
+	}
+	return nil
+}
+
+// Subscribe registers a handler for the envelopes of a space. The
+// subscription is active as soon as it is registered.
+func (b *MemoryBackplane) Subscribe(spaceID string, handler func(Envelope), ready func()) (func(), error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if ready != nil {
+		go ready()
+	}
+
+	id := b.nextID
+	b.nextID++
+	if _, exists := b.subs[spaceID]; !exists {
+		b.subs[spaceID] = make(map[int]func(Envelope))
+	}
+	b.subs[spaceID][id] = handler
+
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		delete(b.subs[spaceID], id)
+		if len(b.subs[spaceID]) == 0 {
+			delete(b.subs, spaceID)
+		}
+	}, nil
+}
+
+// Close is a no-op for the in-memory backplane
+func (b *MemoryBackplane) Close() error {
+	return nil
+}
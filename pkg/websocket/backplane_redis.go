@@ -0,0 +1,328 @@
+package websocket
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/redis/go-redis/v9/maintnotifications"
+)
+
+const redisChannelPrefix = "metaverse:space:"
+
+const (
+	// redisQueueSize bounds the envelopes waiting for Redis. Publishing while
+	// the queue is full drops the envelope instead of blocking the room.
+	redisQueueSize = 4096
+	// redisIOTimeout bounds a single dial, write or command round trip
+	redisIOTimeout = 5 * time.Second
+	// redisMaxBackoff caps the wait between reconnection attempts
+	redisMaxBackoff = 5 * time.Second
+)
+
+// errRedisQueueFull is returned by Publish when Redis cannot keep up
+var errRedisQueueFull = errors.New("redis backplane queue full")
+
+// redisMessage is an envelope waiting to be published
+type redisMessage struct {
+	channel string
+	payload []byte
+}
+
+// RedisBackplane fans room events out over Redis pub/sub. It uses RESP2, so
+// any server implementing PUBLISH/SUBSCRIBE works. Publish, Subscribe and
+// unsubscribing only queue work for background goroutines, so a slow or
+// unreachable Redis never holds up a room.
+type RedisBackplane struct {
+	client *redis.Client
+	pubsub *redis.PubSub
+
+	// outbound holds envelopes to publish; resync wakes syncSubscriptions
+	outbound chan redisMessage
+	resync   chan struct{}
+	done     chan struct{}
+
+	mu       sync.Mutex
+	handlers map[string]map[int]func(Envelope)
+	nextID   int
+	closed   bool
+	// Channels subscribed to, and those of them Redis has confirmed on the
+	// current connection
+	subscribed map[string]bool
+	active     map[string]bool
+	// ready callbacks of subscriptions waiting for their confirmation
+	pending map[string]map[int]func()
+}
+
+// NewRedisBackplane connects to the Redis server described by the URL
+func NewRedisBackplane(u *url.URL) (*RedisBackplane, error) {
+	opts, err := redis.ParseURL(u.String())
+	if err != nil {
+		return nil, err
+	}
+	opts.Protocol = 2
+	opts.DisableIdentity = true
+	opts.MaintNotificationsConfig = &maintnotifications.Config{Mode: maintnotifications.ModeDisabled}
+	opts.DialTimeout = redisIOTimeout
+	opts.ReadTimeout = redisIOTimeout
+	opts.WriteTimeout = redisIOTimeout
+	opts.MaxRetryBackoff = redisMaxBackoff
+
+	client := redis.NewClient(opts)
+	ctx, cancel := context.WithTimeout(context.Background(), redisIOTimeout)
+	defer cancel()
+	if err := client.Ping(ctx).Err(); err != nil {
+		client.Close()
+		return nil, err
+	}
+
+	b := &RedisBackplane{
+		client:   client,
+		pubsub:   client.Subscribe(context.Background()),
+		outbound: make(chan redisMessage, redisQueueSize),
+		resync:   make(chan struct{}, 1),
+		done:     make(chan struct{}),
+		handlers: make(map[string]map[int]func(Envelope)),
+
+		subscribed: make(map[string]bool),
+		active:     make(map[string]bool),
+		pending:    make(map[string]map[int]func()),
+	}
+	go b.publishLoop()
+	go b.syncSubscriptions()
+	go b.listen()
+	return b, nil
+}
+
+// Publish queues an envelope for every node subscribed to the space. It does
+// not wait for Redis and fails only when the queue is full.
+func (b *RedisBackplane) Publish(spaceID string, env Envelope) error {
+	data, err := json.Marshal(env)
+	if err != nil {
+		return err
+	}
+
+	select {
+	case <-b.done:
+		return errors.New("backplane closed")
+	default:
+	}
+
+	select {
+	case b.outbound <- redisMessage{channel: redisChannelPrefix + spaceID, payload: data}:
+		return nil
+	default:
+		return errRedisQueueFull
+	}
+}
+
+// Subscribe registers a handler for the envelopes of a space. ready is called
+// once Redis has confirmed the SUBSCRIBE, as messages published before that
+// are not delivered.
+func (b *RedisBackplane) Subscribe(spaceID string, handler func(Envelope), ready func()) (func(), error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return nil, errors.New("backplane closed")
+	}
+
+	channel := redisChannelPrefix + spaceID
+	if _, exists := b.handlers[channel]; !exists {
+		b.handlers[channel] = make(map[int]func(Envelope))
+		b.wakeResync()
+	}
+	id := b.nextID
+	b.nextID++
+	b.handlers[channel][id] = handler
+
+	if ready != nil {
+		if b.active[channel] {
+			go ready()
+		} else {
+			if _, exists := b.pending[channel]; !exists {
+				b.pending[channel] = make(map[int]func())
+			}
+			b.pending[channel][id] = ready
+		}
+	}
+
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+
+		delete(b.handlers[channel], id)
+		delete(b.pending[channel], id)
+		if len(b.pending[channel]) == 0 {
+			delete(b.pending, channel)
+		}
+		if len(b.handlers[channel]) == 0 {
+			delete(b.handlers, channel)
+			b.wakeResync()
+		}
+	}, nil
+}
+
+// wakeResync asks syncSubscriptions to bring the subscriptions in line with
+// handlers
+func (b *RedisBackplane) wakeResync() {
+	select {
+	case b.resync <- struct{}{}:
+	default:
+	}
+}
+
+// Close stops the background goroutines and closes the Redis connections
+func (b *RedisBackplane) Close() error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return nil
+	}
+	b.closed = true
+	close(b.done)
+	b.mu.Unlock()
+
+	b.pubsub.Close()
+	return b.client.Close()
+}
+
+// publishLoop sends queued envelopes. The client reconnects and retries on
+// its own; an envelope that still fails is dropped.
+func (b *RedisBackplane) publishLoop() {
+	for {
+		select {
+		case <-b.done:
+			return
+		case msg := <-b.outbound:
+			ctx, cancel := context.WithTimeout(context.Background(), redisIOTimeout)
+			err := b.client.Publish(ctx, msg.channel, msg.payload).Err()
+			cancel()
+			if err != nil {
+				log.Printf("Error publishing to redis backplane: %v", err)
+			}
+		}
+	}
+}
+
+// syncSubscriptions subscribes to the channels that have handlers and
+// unsubscribes from the others. The pub/sub connection remembers them and
+// subscribes again after reconnecting.
+func (b *RedisBackplane) syncSubscriptions() {
+	for {
+		select {
+		case <-b.done:
+			return
+		case <-b.resync:
+		}
+
+		b.mu.Lock()
+		var subscribe, unsubscribe []string
+		for channel := range b.handlers {
+			if !b.subscribed[channel] {
+				b.subscribed[channel] = true
+				subscribe = append(subscribe, channel)
+			}
+		}
+		for channel := range b.subscribed {
+			if _, exists := b.handlers[channel]; !exists {
+				delete(b.subscribed, channel)
+				delete(b.active, channel)
+				unsubscribe = append(unsubscribe, channel)
+			}
+		}
+		b.mu.Unlock()
+
+		ctx, cancel := context.WithTimeout(context.Background(), redisIOTimeout)
+		if len(subscribe) > 0 {
+			if err := b.pubsub.Subscribe(ctx, subscribe...); err != nil {
+				log.Printf("Error subscribing to redis backplane: %v", err)
+			}
+		}
+		if len(unsubscribe) > 0 {
+			if err := b.pubsub.Unsubscribe(ctx, unsubscribe...); err != nil {
+				log.Printf("Error unsubscribing from redis backplane: %v", err)
+			}
+		}
+		cancel()
+	}
+}
+
+// listen receives pushed pub/sub messages. A failed receive drops the
+// connection, and the next one reconnects and subscribes again.
+func (b *RedisBackplane) listen() {
+	backoff := 100 * time.Millisecond
+	for {
+		msg, err := b.pubsub.Receive(context.Background())
+		if err != nil {
+			select {
+			case <-b.done:
+				return
+			default:
+			}
+
+			// Confirmations are needed again on the new connection
+			b.mu.Lock()
+			b.active = make(map[string]bool)
+			b.mu.Unlock()
+
+			log.Printf("Redis backplane connection lost, retrying in %s: %v", backoff, err)
+			select {
+			case <-b.done:
+				return
+			case <-time.After(backoff):
+			}
+			if backoff *= 2; backoff > redisMaxBackoff {
+				backoff = redisMaxBackoff
+			}
+			continue
+		}
+		backoff = 100 * time.Millisecond
+
+		switch msg := msg.(type) {
+		case *redis.Subscription:
+			if msg.Kind == "subscribe" {
+				b.confirm(msg.Channel)
+			}
+		case *redis.Message:
+			var env Envelope
+			if err := json.Unmarshal([]byte(msg.Payload), &env); err != nil {
+				log.Printf("Error parsing backplane envelope: %v", err)
+				continue
+			}
+
+			b.mu.Lock()
+			handlers := make([]func(Envelope), 0, len(b.handlers[msg.Channel]))
+			for _, handler := range b.handlers[msg.Channel] {
+				handlers = append(handlers, handler)
+			}
+			b.mu.Unlock()
+
+			for _, handler := range handlers {
+				handler(env)
+			}
+		}
+	}
+}
+
+// confirm marks a channel as subscribed and runs the ready callbacks waiting for it
+func (b *RedisBackplane) confirm(channel string) {
+	b.mu.Lock()
+	if _, wanted := b.handlers[channel]; !wanted {
+		b.mu.Unlock()
+		return
+	}
+	b.active[channel] = true
+	callbacks := b.pending[channel]
+	delete(b.pending, channel)
+	b.mu.Unlock()
+
+	for _, ready := range callbacks {
+		ready()
+	}
+}
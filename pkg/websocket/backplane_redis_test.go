@@ -0,0 +1,382 @@
+package websocket
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeRedis is a local stand-in for Redis that implements just enough of
+// RESP for the backplane: AUTH, SELECT, PUBLISH, SUBSCRIBE and UNSUBSCRIBE
+type fakeRedis struct {
+	ln       net.Listener
+	password string
+
+	mu    sync.Mutex
+	conns map[net.Conn]bool
+	subs  map[string]map[net.Conn]bool
+	// stall makes PUBLISH never reply, like an overloaded server
+	stall bool
+	// subscribeDelay holds up SUBSCRIBE, like a busy server
+	subscribeDelay time.Duration
+	// subscribes counts the SUBSCRIBE commands for each channel
+	subscribes map[string]int
+}
+
+func newFakeRedis(t *testing.T, password string) *fakeRedis {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeRedis{
+		ln:       ln,
+		password: password,
+		conns:    make(map[net.Conn]bool),
+		subs:     make(map[string]map[net.Conn]bool),
+
+		subscribes: make(map[string]int),
+	}
+	go f.serve()
+	t.Cleanup(func() {
+		ln.Close()
+		f.dropConnections()
+	})
+	return f
+}
+
+func (f *fakeRedis) url() *url.URL {
+	u := &url.URL{Scheme: "redis", Host: f.ln.Addr().String(), Path: "/2"}
+	if f.password != "" {
+		u.User = url.UserPassword("", f.password)
+	}
+	return u
+}
+
+func (f *fakeRedis) serve() {
+	for {
+		conn, err := f.ln.Accept()
+		if err != nil {
+			return
+		}
+		f.mu.Lock()
+		f.conns[conn] = true
+		f.mu.Unlock()
+		go f.handle(conn)
+	}
+}
+
+func (f *fakeRedis) handle(conn net.Conn) {
+	defer func() {
+		f.mu.Lock()
+		delete(f.conns, conn)
+		for _, subs := range f.subs {
+			delete(subs, conn)
+		}
+		f.mu.Unlock()
+		conn.Close()
+	}()
+
+	r := bufio.NewReader(conn)
+	authed := f.password == ""
+	subscribed := 0
+	for {
+		args, err := readCommand(r)
+		if err != nil || len(args) == 0 {
+			return
+		}
+		args[0] = strings.ToUpper(args[0])
+
+		f.mu.Lock()
+		switch {
+		case args[0] == "AUTH":
+			authed = len(args) == 2 && args[1] == f.password
+			if authed {
+				fmt.Fprint(conn, "+OK\r\n")
+			} else {
+				fmt.Fprint(conn, "-WRONGPASS invalid password\r\n")
+			}
+		case !authed:
+			fmt.Fprint(conn, "-NOAUTH Authentication required\r\n")
+		case args[0] == "SELECT":
+			fmt.Fprint(conn, "+OK\r\n")
+		case args[0] == "PING" && subscribed > 0:
+			fmt.Fprint(conn, "*2\r\n$4\r\npong\r\n$0\r\n\r\n")
+		case args[0] == "PING":
+			fmt.Fprint(conn, "+PONG\r\n")
+		case args[0] == "PUBLISH" && len(args) == 3:
+			if f.stall {
+				break
+			}
+			for sub := range f.subs[args[1]] {
+				fmt.Fprintf(sub, "*3\r\n$7\r\nmessage\r\n$%d\r\n%s\r\n$%d\r\n%s\r\n",
+					len(args[1]), args[1], len(args[2]), args[2])
+			}
+			fmt.Fprintf(conn, ":%d\r\n", len(f.subs[args[1]]))
+		case args[0] == "SUBSCRIBE" && len(args) >= 2:
+			if delay := f.subscribeDelay; delay > 0 {
+				f.mu.Unlock()
+				time.Sleep(delay)
+				f.mu.Lock()
+			}
+			for _, channel := range args[1:] {
+				if f.subs[channel] == nil {
+					f.subs[channel] = make(map[net.Conn]bool)
+				}
+				f.subscribes[channel]++
+				if !f.subs[channel][conn] {
+					f.subs[channel][conn] = true
+					subscribed++
+				}
+				fmt.Fprintf(conn, "*3\r\n$9\r\nsubscribe\r\n$%d\r\n%s\r\n:%d\r\n", len(channel), channel, subscribed)
+			}
+		case args[0] == "UNSUBSCRIBE" && len(args) >= 2:
+			for _, channel := range args[1:] {
+				if f.subs[channel][conn] {
+					delete(f.subs[channel], conn)
+					subscribed--
+				}
+				fmt.Fprintf(conn, "*3\r\n$11\r\nunsubscribe\r\n$%d\r\n%s\r\n:%d\r\n", len(channel), channel, subscribed)
+			}
+		default:
+			fmt.Fprintf(conn, "-ERR unknown command %q\r\n", args[0])
+		}
+		f.mu.Unlock()
+	}
+}
+
+// readCommand reads a command sent as a RESP array of bulk strings
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(line, "*") {
+		return nil, fmt.Errorf("unexpected %q", line)
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, n)
+	for i := range args {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "$")))
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
+
+func (f *fakeRedis) subscribers(spaceID string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.subs[redisChannelPrefix+spaceID])
+}
+
+func (f *fakeRedis) setStall(stall bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.stall = stall
+}
+
+// dropConnections closes every client connection, as a Redis restart would
+func (f *fakeRedis) dropConnections() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for conn := range f.conns {
+		conn.Close()
+	}
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func newTestRedisBackplane(t *testing.T, f *fakeRedis) *RedisBackplane {
+	t.Helper()
+	b, err := NewRedisBackplane(f.url())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { b.Close() })
+	return b
+}
+
+func receive(t *testing.T, ch <-chan Envelope) Envelope {
+	t.Helper()
+	select {
+	case env := <-ch:
+		return env
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for an envelope")
+		return Envelope{}
+	}
+}
+
+func TestRedisBackplaneDeliversBetweenNodes(t *testing.T) {
+	f := newFakeRedis(t, "s3cret")
+	nodeA := newTestRedisBackplane(t, f)
+	nodeB := newTestRedisBackplane(t, f)
+
+	received := make(chan Envelope, 1)
+	unsubscribe, err := nodeB.Subscribe("space-1", func(env Envelope) { received <- env }, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "subscription", func() bool { return f.subscribers("space-1") == 1 })
+
+	if err := nodeA.Publish("space-1", Envelope{NodeID: "a", Kind: EnvelopeLeave, TargetID: "user-1"}); err != nil {
+		t.Fatal(err)
+	}
+	if env := receive(t, received); env.NodeID != "a" || env.Kind != EnvelopeLeave || env.TargetID != "user-1" {
+		t.Fatalf("received %+v", env)
+	}
+
+	unsubscribe()
+	waitFor(t, "unsubscribe", func() bool { return f.subscribers("space-1") == 0 })
+}
+
+func TestRedisBackplaneRejectsWrongPassword(t *testing.T) {
+	f := newFakeRedis(t, "s3cret")
+	u := f.url()
+	u.User = url.UserPassword("", "wrong")
+	if _, err := NewRedisBackplane(u); err == nil {
+		t.Fatal("expected an authentication error")
+	}
+}
+
+func TestRedisBackplanePublishDoesNotWaitForRedis(t *testing.T) {
+	f := newFakeRedis(t, "")
+	b := newTestRedisBackplane(t, f)
+	f.setStall(true)
+
+	start := time.Now()
+	var full int
+	for i := 0; i < redisQueueSize+100; i++ {
+		err := b.Publish("space-1", Envelope{Kind: EnvelopeSync})
+		if errors.Is(err, errRedisQueueFull) {
+			full++
+		} else if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("publishing to a stalled server took %s", elapsed)
+	}
+	if full == 0 {
+		t.Fatal("expected publishes beyond the queue size to be dropped")
+	}
+
+	// Subscribing does not wait for the stalled server either
+	start = time.Now()
+	if _, err := b.Subscribe("space-2", func(Envelope) {}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Fatalf("subscribing took %s", elapsed)
+	}
+}
+
+func TestRedisBackplaneResubscribesAfterReconnect(t *testing.T) {
+	f := newFakeRedis(t, "")
+	publisher := newTestRedisBackplane(t, f)
+	subscriber := newTestRedisBackplane(t, f)
+
+	received := make(chan Envelope, 10)
+	if _, err := subscriber.Subscribe("space-1", func(env Envelope) { received <- env }, nil); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "subscription", func() bool { return f.subscribers("space-1") == 1 })
+
+	f.dropConnections()
+	waitFor(t, "resubscription", func() bool {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		return f.subscribes[redisChannelPrefix+"space-1"] == 2 && len(f.subs[redisChannelPrefix+"space-1"]) == 1
+	})
+
+	// The publisher reconnects on its next command
+	if err := publisher.Publish("space-1", Envelope{NodeID: "a", Kind: EnvelopeSync}); err != nil {
+		t.Fatal(err)
+	}
+	if env := receive(t, received); env.Kind != EnvelopeSync {
+		t.Fatalf("received %+v", env)
+	}
+}
+
+func TestRedisBackplaneReadyAfterSubscribeIsConfirmed(t *testing.T) {
+	f := newFakeRedis(t, "")
+	b := newTestRedisBackplane(t, f)
+
+	ready := make(chan int, 2)
+	ch := func() { ready <- f.subscribers("space-1") }
+	if _, err := b.Subscribe("space-1", func(Envelope) {}, ch); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case subscribers := <-ready:
+		if subscribers != 1 {
+			t.Fatal("ready was called before Redis registered the subscription")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for ready")
+	}
+
+	// A second handler on a confirmed channel is ready at once
+	if _, err := b.Subscribe("space-1", func(Envelope) {}, ch); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-ready:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for ready on a confirmed channel")
+	}
+}
+
+func TestJoiningNodeLearnsExistingUsers(t *testing.T) {
+	f := newFakeRedis(t, "")
+	nodeA, nodeB := newTestRoomManager(), newTestRoomManager()
+	nodeA.nodeID, nodeB.nodeID = "node-a", "node-b"
+	nodeA.SetBackplane(newTestRedisBackplane(t, f))
+	nodeB.SetBackplane(newTestRedisBackplane(t, f))
+
+	alice := joinTestRoom(t, nodeA, "space-1", "alice", 1, 1)
+	waitFor(t, "node A subscription", func() bool { return f.subscribers("space-1") == 1 })
+	f.mu.Lock()
+	f.subscribeDelay = 200 * time.Millisecond
+	f.mu.Unlock()
+	joinTestRoom(t, nodeB, "space-1", "bob", 2, 2)
+
+	// Node A answers the sync of node B without waiting for the presence loop
+	waitFor(t, "alice on node B", func() bool {
+		nodeB.mu.RLock()
+		defer nodeB.mu.RUnlock()
+		_, exists := nodeB.remote["space-1"][alice.ID]
+		return exists
+	})
+}
@@ -0,0 +1,115 @@
+package websocket
+
+import (
+	"os"
+	"testing"
+
+	"github.com/genosis18m/Metaverse_go/internal/database"
+	"github.com/genosis18m/Metaverse_go/internal/models"
+	"github.com/genosis18m/Metaverse_go/internal/utils"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// withTestDB points the database package at the Postgres database of
+// TEST_DATABASE_URL and migrates it. Tests are skipped when it is not set.
+func withTestDB(t *testing.T) {
+	t.Helper()
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	saved := database.DB
+	database.DB = db
+	t.Cleanup(func() { database.DB = saved })
+	if err := database.AutoMigrate(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// createTestAccount stores a user with a unique name
+func createTestAccount(t *testing.T) models.User {
+	t.Helper()
+	user := models.User{ID: utils.GenerateCUID(), Username: "user-" + utils.GenerateRandomString(10), Role: models.RoleUser}
+	if err := database.DB.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+// createTestSpace stores a 100×100 space created by a user
+func createTestSpace(t *testing.T, creatorID string) models.Space {
+	t.Helper()
+	space := models.Space{ID: utils.GenerateCUID(), Name: "test space", Width: 100, Height: 100, CreatorID: creatorID}
+	if err := database.DB.Create(&space).Error; err != nil {
+		t.Fatal(err)
+	}
+	return space
+}
+
+func TestUsersWithinUsesManhattanDistance(t *testing.T) {
+	rm := newTestRoomManager()
+	joinTestRoom(t, rm, "space-1", "center", 10, 10)
+	joinTestRoom(t, rm, "space-1", "edge", 12, 11)
+	joinTestRoom(t, rm, "space-1", "diagonal", 12, 12)
+	joinTestRoom(t, rm, "space-2", "elsewhere", 10, 10)
+
+	got := make(map[string]bool)
+	for _, u := range rm.UsersWithin("space-1", 10, 10, 3) {
+		got[u.UserID] = true
+	}
+	if len(got) != 2 || !got["center"] || !got["edge"] {
+		t.Fatalf("users within 3 tiles = %v, want center and edge", got)
+	}
+	if users := rm.UsersWithin("empty", 0, 0, 100); len(users) != 0 {
+		t.Fatalf("an unknown room has users %v", users)
+	}
+}
+
+func TestNearbyChatReachesOnlyUsersInRange(t *testing.T) {
+	withTestDB(t)
+	keepConfig(t)
+	ChatRadius = 3
+
+	aliceAccount, bobAccount, carolAccount := createTestAccount(t), createTestAccount(t), createTestAccount(t)
+	space := createTestSpace(t, aliceAccount.ID)
+	rm := GetRoomManager()
+	alice := joinTestRoom(t, rm, space.ID, aliceAccount.ID, 10, 10)
+	bob := joinTestRoom(t, rm, space.ID, bobAccount.ID, 11, 12)
+	carol := joinTestRoom(t, rm, space.ID, carolAccount.ID, 20, 20)
+	for _, u := range []*User{alice, bob, carol} {
+		sent(u)
+	}
+
+	alice.handleChat(ChatRequest{Message: "psst", Scope: models.ChatScopeNearby})
+
+	for _, u := range []*User{alice, bob} {
+		chats := sentOfType(u, TypeChat)
+		if len(chats) != 1 || chats[0].Payload.(ChatPayload).Scope != models.ChatScopeNearby {
+			t.Fatalf("%s got %v, want the nearby message", u.UserID, chats)
+		}
+	}
+	if chats := sentOfType(carol, TypeChat); len(chats) != 0 {
+		t.Fatalf("carol, out of range, got %v", chats)
+	}
+
+	// History keeps the message from users who were out of range
+	for _, c := range []struct {
+		viewer string
+		sees   bool
+	}{{alice.UserID, true}, {bob.UserID, true}, {carol.UserID, false}} {
+		history, _, err := database.ListMessages(space.ID, database.MessageQuery{ViewerID: c.viewer})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (len(history) == 1) != c.sees {
+			t.Fatalf("history of %s has %d messages, want the message visible: %t", c.viewer, len(history), c.sees)
+		}
+	}
+}
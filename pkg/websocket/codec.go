@@ -0,0 +1,96 @@
+package websocket
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+
+	"github.com/gorilla/websocket"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Subprotocols clients can request in the Sec-WebSocket-Protocol header
+const (
+	SubprotocolJSON    = "metaverse.json"
+	SubprotocolMsgpack = "metaverse.msgpack"
+)
+
+// Codec encodes and decodes the messages of a connection
+type Codec interface {
+	// Subprotocol is the WebSocket subprotocol name that selects the codec
+	Subprotocol() string
+	// FrameType is the WebSocket message type frames are sent with
+	FrameType() int
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+var codecs = []Codec{jsonCodec{}, msgpackCodec{}}
+
+// Subprotocols lists the supported subprotocols in order of server preference
+func Subprotocols() []string {
+	names := make([]string, len(codecs))
+	for i, codec := range codecs {
+		names[i] = codec.Subprotocol()
+	}
+	return names
+}
+
+// CodecFor returns the codec of a negotiated subprotocol. Connections that did
+// not negotiate one use JSON.
+func CodecFor(subprotocol string) Codec {
+	for _, codec := range codecs {
+		if codec.Subprotocol() == subprotocol {
+			return codec
+		}
+	}
+	return jsonCodec{}
+}
+
+// jsonCodec is the default text protocol
+type jsonCodec struct{}
+
+func (jsonCodec) Subprotocol() string { return SubprotocolJSON }
+
+func (jsonCodec) FrameType() int { return websocket.TextMessage }
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) { return json.Marshal(v) }
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+
+// msgpackCodec is the binary protocol. Structs are encoded as maps keyed by
+// their JSON field names so both encodings carry the same documents.
+type msgpackCodec struct{}
+
+func (msgpackCodec) Subprotocol() string { return SubprotocolMsgpack }
+
+func (msgpackCodec) FrameType() int { return websocket.BinaryMessage }
+
+func (msgpackCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetCustomStructTag("json")
+	enc.UseCompactInts(true)
+	// Payloads relayed through the backplane hold JSON numbers as float64;
+	// whole numbers among them are sent as integers
+	enc.UseCompactFloats(true)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (msgpackCodec) Unmarshal(data []byte, v interface{}) error {
+	r := bytes.NewReader(data)
+	dec := msgpack.NewDecoder(r)
+	dec.SetCustomStructTag("json")
+	// Numbers in untyped values decode as int64, uint64 or float64, as with JSON
+	dec.UseLooseInterfaceDecoding(true)
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+	if r.Len() != 0 {
+		return errors.New("msgpack: trailing data")
+	}
+	return nil
+}
@@ -0,0 +1,218 @@
+package websocket
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/genosis18m/Metaverse_go/internal/models"
+)
+
+// clientMessage is a message as a client encodes it
+type clientMessage struct {
+	Type    MessageType `json:"type"`
+	Payload interface{} `json:"payload"`
+}
+
+func intPtr(n int) *int { return &n }
+
+func stringPtr(s string) *string { return &s }
+
+func TestCodecsRoundTripRequests(t *testing.T) {
+	requests := []struct {
+		msgType MessageType
+		payload validator
+		decoded func() validator
+	}{
+		{TypeJoin, &JoinRequest{Version: 2, SpaceID: "space-1", Token: "token", Snapshots: true}, func() validator { return &JoinRequest{} }},
+		{TypeMove, &MoveRequest{X: intPtr(0), Y: intPtr(-3)}, func() validator { return &MoveRequest{} }},
+		{TypeChat, &ChatRequest{Message: "héllo", Scope: models.ChatScopeNearby}, func() validator { return &ChatRequest{} }},
+		{TypeChatHistory, &ChatHistoryRequest{Before: "msg-1", Query: "hi", Limit: 20}, func() validator { return &ChatHistoryRequest{} }},
+		{TypeChatEdit, &ChatEditRequest{MessageID: "msg-1", Message: "fixed"}, func() validator { return &ChatEditRequest{} }},
+		{TypeChatDelete, &ChatDeleteRequest{MessageID: "msg-1"}, func() validator { return &ChatDeleteRequest{} }},
+		{TypeMute, &MuteRequest{UserID: "user-2", Duration: 300}, func() validator { return &MuteRequest{} }},
+		{TypeKick, &KickRequest{UserID: "user-2", Duration: 70000}, func() validator { return &KickRequest{} }},
+		{TypeDirectMessage, &DirectMessageRequest{TargetUserID: "user-2", Message: "psst"}, func() validator { return &DirectMessageRequest{} }},
+		{TypeDirectMessageRead, &DirectMessageReadRequest{UserID: "user-2", MessageID: "dm-1"}, func() validator { return &DirectMessageReadRequest{} }},
+		{TypeRTCOffer, &SignalRequest{TargetUserID: "user-2", SDP: "v=0\r\n"}, func() validator { return &SignalRequest{} }},
+		{TypeRTCIceCandidate, &SignalRequest{TargetUserID: "user-2", Candidate: &ICECandidate{
+			Candidate: "candidate:1 1 udp 1 10.0.0.1 9 typ host", SDPMid: stringPtr("0"), SDPMLineIndex: intPtr(0),
+		}}, func() validator { return &SignalRequest{} }},
+	}
+
+	for _, codec := range codecs {
+		for _, req := range requests {
+			data, err := codec.Marshal(clientMessage{Type: req.msgType, Payload: req.payload})
+			if err != nil {
+				t.Fatalf("%s: marshal %s: %v", codec.Subprotocol(), req.msgType, err)
+			}
+
+			var msg IncomingMessage
+			if err := codec.Unmarshal(data, &msg); err != nil {
+				t.Fatalf("%s: unmarshal %s: %v", codec.Subprotocol(), req.msgType, err)
+			}
+			if msg.Type != req.msgType {
+				t.Fatalf("%s: type = %q, want %q", codec.Subprotocol(), msg.Type, req.msgType)
+			}
+			decoded := req.decoded()
+			if err := codec.Unmarshal(msg.Payload, decoded); err != nil {
+				t.Fatalf("%s: unmarshal %s payload: %v", codec.Subprotocol(), req.msgType, err)
+			}
+			if !reflect.DeepEqual(decoded, req.payload) {
+				t.Fatalf("%s: %s payload = %+v, want %+v", codec.Subprotocol(), req.msgType, decoded, req.payload)
+			}
+		}
+	}
+}
+
+func TestCodecsRoundTripOutgoingMessages(t *testing.T) {
+	payloads := []struct {
+		msgType MessageType
+		payload interface{}
+	}{
+		{TypeSpaceJoined, SpaceJoinedPayload{
+			SpaceID: "space-1", Spawn: SpawnPoint{X: 3, Y: 4},
+			Users:       []UserInfo{{UserID: "a", Username: "alice", X: 1, Y: 2}},
+			Messages:    []ChatMessage{{ID: "msg-1", UserID: "a", Username: "alice", Message: "hi", Scope: models.ChatScopeRoom, Timestamp: "2024-01-01T00:00:00Z"}},
+			ResumeToken: "resume", ProtocolVersion: ProtocolVersion,
+		}},
+		{TypeUserJoined, UserJoinedPayload{UserID: "a", Username: "alice", X: 1, Y: 2}},
+		{TypeMovement, MovementPayload{UserID: "a", X: -1, Y: 128}},
+		{TypeUserLeft, UserLeftPayload{UserID: "a"}},
+		{TypeChat, ChatPayload{ID: "msg-1", UserID: "a", Username: "alice", Message: "héllo", Scope: models.ChatScopeZone}},
+		{TypeProximityEnter, ProximityPayload{UserID: "a", Username: "alice", X: 1, Y: 2}},
+		{TypeRTCAnswer, RTCSignalPayload{FromUserID: "a", SDP: "v=0\r\n"}},
+		{TypeRTCIceCandidate, RTCSignalPayload{FromUserID: "a", Candidate: &ICECandidate{Candidate: "candidate:1", UsernameFragment: stringPtr("frag")}}},
+		{TypeRoomSnapshot, RoomSnapshotPayload{Tick: 1 << 40, Moves: []MovementPayload{{UserID: "a", X: 1, Y: 2}, {UserID: "b", X: 300, Y: 70000}}}},
+		{TypeUserEnteredView, ViewPayload{UserID: "a", Username: "alice", X: 1, Y: 2}},
+		{TypeChatHistory, ChatHistoryPayload{Messages: []ChatMessage{{ID: "msg-1", EditedAt: "2024-01-01T00:00:00Z"}}, HasMore: true}},
+		{TypeDirectMessage, DirectMessagePayload{ID: "dm-1", FromUserID: "a", FromUsername: "alice", ToUserID: "b", Message: "psst", Timestamp: "2024-01-01T00:00:00Z"}},
+		{TypeDirectMessageRead, DirectMessageReadPayload{ReaderID: "b", SenderID: "a", MessageID: "dm-1", ReadAt: "2024-01-01T00:00:00Z"}},
+		{TypeChatEdited, ChatEditedPayload{ID: "msg-1", UserID: "a", Message: "fixed", EditedBy: "a", EditedAt: "2024-01-01T00:00:00Z"}},
+		{TypeChatDeleted, ChatDeletedPayload{ID: "msg-1", DeletedBy: "owner"}},
+		{TypeUserKicked, ModerationPayload{UserID: "a", By: "owner", Until: "2024-01-01T00:00:00Z"}},
+		{TypeElementAdded, ElementPayload{ID: "se-1", Element: ElementDetail{ID: "el-1", ImageURL: "https://example.com/a.png", Width: 2, Height: 1, Static: true}, X: 4, Y: 5, Rotation: 90, By: "a"}},
+		{TypeSpaceDeleted, SpaceDeletedPayload{SpaceID: "space-1"}},
+		{TypeZoneEnter, ZonePayload{ZoneID: "zone-1", Name: "Stage", UserID: "a", Occupancy: 3, MaxOccupancy: 10}},
+		{TypeError, ErrorPayload{Code: ErrRateLimited, Message: "slow down", RequestType: TypeChat}},
+	}
+
+	for _, codec := range codecs {
+		for _, p := range payloads {
+			data, err := codec.Marshal(OutgoingMessage{Type: p.msgType, Payload: p.payload})
+			if err != nil {
+				t.Fatalf("%s: marshal %s: %v", codec.Subprotocol(), p.msgType, err)
+			}
+
+			var msg IncomingMessage
+			if err := codec.Unmarshal(data, &msg); err != nil {
+				t.Fatalf("%s: unmarshal %s: %v", codec.Subprotocol(), p.msgType, err)
+			}
+			decoded := reflect.New(reflect.TypeOf(p.payload))
+			if err := codec.Unmarshal(msg.Payload, decoded.Interface()); err != nil {
+				t.Fatalf("%s: unmarshal %s payload: %v", codec.Subprotocol(), p.msgType, err)
+			}
+			if msg.Type != p.msgType || !reflect.DeepEqual(decoded.Elem().Interface(), p.payload) {
+				t.Fatalf("%s: decoded %s %+v, want %+v", codec.Subprotocol(), msg.Type, decoded.Elem().Interface(), p.payload)
+			}
+		}
+	}
+}
+
+func TestMsgpackRelaysBackplanePayloads(t *testing.T) {
+	// Messages relayed through the backplane carry decoded JSON objects
+	payload := map[string]interface{}{"userId": "a", "x": float64(3), "y": float64(-4)}
+	codec := msgpackCodec{}
+	data, err := codec.Marshal(OutgoingMessage{Type: TypeMovement, Payload: payload})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var msg struct {
+		Type    MessageType     `json:"type"`
+		Payload MovementPayload `json:"payload"`
+	}
+	if err := codec.Unmarshal(data, &msg); err != nil {
+		t.Fatal(err)
+	}
+	if msg.Payload != (MovementPayload{UserID: "a", X: 3, Y: -4}) {
+		t.Fatalf("decoded %+v", msg.Payload)
+	}
+}
+
+func TestMsgpackKeepsPayloadUndecoded(t *testing.T) {
+	codec := msgpackCodec{}
+	payload, _ := codec.Marshal(ChatRequest{Message: "hi"})
+	data, _ := codec.Marshal(clientMessage{Type: TypeChat, Payload: ChatRequest{Message: "hi"}})
+
+	var msg IncomingMessage
+	if err := codec.Unmarshal(data, &msg); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(msg.Payload, payload) {
+		t.Fatalf("payload = %x, want the encoded request %x", []byte(msg.Payload), payload)
+	}
+
+	data, _ = codec.Marshal(clientMessage{Type: TypeChat})
+	if err := codec.Unmarshal(data, &msg); err != nil {
+		t.Fatal(err)
+	}
+	var chat ChatRequest
+	if err := codec.Unmarshal(msg.Payload, &chat); len(msg.Payload) != 0 && (err != nil || chat.Validate() == nil) {
+		t.Fatalf("nil payload = %x decoded to a valid request", []byte(msg.Payload))
+	}
+}
+
+func TestMsgpackRejectsMalformedData(t *testing.T) {
+	codec := msgpackCodec{}
+	var msg IncomingMessage
+	for name, data := range map[string][]byte{
+		"truncated":     {0x82, 0xa4, 't', 'y'},
+		"huge length":   {0xdf, 0xff, 0xff, 0xff, 0xff},
+		"trailing data": {0x80, 0xc0},
+		"integer key":   {0x81, 0x01, 0x02},
+	} {
+		if err := codec.Unmarshal(data, &msg); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+
+	var move MoveRequest
+	data, _ := codec.Marshal(map[string]interface{}{"x": "left", "y": 1})
+	if err := codec.Unmarshal(data, &move); err == nil {
+		t.Error("a string decoded into an int")
+	}
+}
+
+// FuzzMsgpackIncomingMessage decodes arbitrary frames the way HandleMessages
+// and decodePayload do, which must fail cleanly rather than panic
+func FuzzMsgpackIncomingMessage(f *testing.F) {
+	codec := msgpackCodec{}
+	for _, seed := range []interface{}{
+		clientMessage{Type: TypeJoin, Payload: JoinRequest{SpaceID: "space-1", Token: "token"}},
+		clientMessage{Type: TypeMove, Payload: MoveRequest{X: intPtr(1), Y: intPtr(2)}},
+		clientMessage{Type: TypeRTCIceCandidate, Payload: SignalRequest{TargetUserID: "b", Candidate: &ICECandidate{Candidate: "c", SDPMLineIndex: intPtr(0)}}},
+		clientMessage{Type: TypeChat, Payload: []interface{}{1, "two", map[string]interface{}{"three": 3.0}}},
+	} {
+		data, err := codec.Marshal(seed)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(data)
+	}
+	f.Add([]byte{0xdf, 0xff, 0xff, 0xff, 0xff})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var msg IncomingMessage
+		if codec.Unmarshal(data, &msg) != nil {
+			return
+		}
+		for _, payload := range []validator{
+			&JoinRequest{}, &MoveRequest{}, &ChatRequest{}, &ChatHistoryRequest{}, &MuteRequest{}, &SignalRequest{},
+		} {
+			if codec.Unmarshal(msg.Payload, payload) == nil {
+				payload.Validate()
+			}
+		}
+	})
+}
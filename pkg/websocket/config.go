@@ -0,0 +1,141 @@
+package websocket
+
+import (
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+// LoadConfig reads the WebSocket server settings from the environment. Call it
+// once at startup, after any .env file has been loaded and before accepting
+// connections; settings that are unset or invalid keep their defaults.
+func LoadConfig() {
+	// Send queues
+	SendQueueSize = envPositiveInt("WS_SEND_QUEUE_SIZE", SendQueueSize)
+	WriteTimeout = envPositiveDuration("WS_WRITE_TIMEOUT", WriteTimeout)
+	SlowClientTimeout = envPositiveDuration("WS_SLOW_CLIENT_TIMEOUT", SlowClientTimeout)
+	MovementOverflow = envMovementPolicy("WS_MOVEMENT_POLICY", MovementOverflow)
+
+	// Keepalive, resume and ticks
+	PingInterval = envPositiveDuration("WS_PING_INTERVAL", PingInterval)
+	PongTimeout = envPositiveDuration("WS_PONG_TIMEOUT", PongTimeout)
+	ResumeGrace = envPositiveDuration("WS_RESUME_GRACE", ResumeGrace)
+	TickRate = envInt("WS_TICK_RATE", TickRate)
+	PositionFlushInterval = envDuration("WS_POSITION_FLUSH_INTERVAL", PositionFlushInterval)
+
+	// Area of interest and proximity
+	ViewRadius = envInt("WS_VIEW_RADIUS", ViewRadius)
+	ProximityRadius = envInt("PROXIMITY_RADIUS", ProximityRadius)
+	ChatRadius = envInt("CHAT_RADIUS", ChatRadius)
+
+	// Rate limits
+	MessageRateLimits = messageRateLimits()
+	RoomChatRateLimit = envRateLimit("ROOM_CHAT", RoomChatRateLimit.Rate, RoomChatRateLimit.Burst)
+	OtherRateLimit = envRateLimit("OTHER", OtherRateLimit.Rate, OtherRateLimit.Burst)
+	RateViolationLimit = envInt("WS_RATE_MAX_VIOLATIONS", RateViolationLimit)
+
+	// Chat moderation
+	ChatMaxLength = envInt("CHAT_MAX_LENGTH", ChatMaxLength)
+	ChatBlockedWords = envString("CHAT_BLOCKED_WORDS", ChatBlockedWords)
+	ChatBlockLinks = envBool("CHAT_BLOCK_LINKS", ChatBlockLinks)
+	KickDuration = envDuration("WS_KICK_DURATION", KickDuration)
+	moderationMu.Lock()
+	configuredHooks = defaultModerationHooks()
+	moderationMu.Unlock()
+}
+
+// envInt reads an integer setting from the environment, falling back to def
+func envInt(name string, def int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		log.Printf("Ignoring %s=%q: not an integer, keeping %d", name, value, def)
+		return def
+	}
+	return n
+}
+
+// envPositiveInt reads an integer setting that must be above zero, falling back to def
+func envPositiveInt(name string, def int) int {
+	n := envInt(name, def)
+	if n <= 0 {
+		log.Printf("Ignoring %s=%d: must be greater than zero, keeping %d", name, n, def)
+		return def
+	}
+	return n
+}
+
+// envDuration reads a duration setting such as "10s" from the environment, falling back to def
+func envDuration(name string, def time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("Ignoring %s=%q: not a duration such as 10s, keeping %s", name, value, def)
+		return def
+	}
+	return d
+}
+
+// envPositiveDuration reads a duration setting that must be above zero, falling back to def
+func envPositiveDuration(name string, def time.Duration) time.Duration {
+	d := envDuration(name, def)
+	if d <= 0 {
+		log.Printf("Ignoring %s=%s: must be greater than zero, keeping %s", name, d, def)
+		return def
+	}
+	return d
+}
+
+// envString reads a string setting from the environment, falling back to def
+func envString(name, def string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return def
+}
+
+// envFloat reads a decimal setting from the environment, falling back to def
+func envFloat(name string, def float64) float64 {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		log.Printf("Ignoring %s=%q: not a number, keeping %g", name, value, def)
+		return def
+	}
+	return f
+}
+
+// envBool reads a boolean setting such as "true" from the environment, falling back to def
+func envBool(name string, def bool) bool {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Printf("Ignoring %s=%q: not a boolean, keeping %t", name, value, def)
+		return def
+	}
+	return b
+}
+
+// envMovementPolicy reads a movement overflow policy from the environment, falling back to def
+func envMovementPolicy(name string, def MovementPolicy) MovementPolicy {
+	switch policy := MovementPolicy(envString(name, string(def))); policy {
+	case MovementDrop, MovementCoalesce:
+		return policy
+	default:
+		log.Printf("Ignoring %s=%q: use %q or %q, keeping %q", name, policy, MovementDrop, MovementCoalesce, def)
+		return def
+	}
+}
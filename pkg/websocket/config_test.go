@@ -0,0 +1,105 @@
+package websocket
+
+import (
+	"testing"
+	"time"
+)
+
+// keep returns a function that puts back the current value of a setting
+func keep[T any](setting *T) func() {
+	value := *setting
+	return func() { *setting = value }
+}
+
+// keepConfig restores every setting LoadConfig writes once the test ends
+func keepConfig(t *testing.T) {
+	for _, restore := range []func(){
+		keep(&SendQueueSize), keep(&WriteTimeout), keep(&SlowClientTimeout), keep(&MovementOverflow),
+		keep(&PingInterval), keep(&PongTimeout), keep(&ResumeGrace), keep(&TickRate), keep(&PositionFlushInterval),
+		keep(&ViewRadius), keep(&ProximityRadius), keep(&ChatRadius),
+		keep(&MessageRateLimits), keep(&RoomChatRateLimit), keep(&OtherRateLimit), keep(&RateViolationLimit),
+		keep(&ChatMaxLength), keep(&ChatBlockedWords), keep(&ChatBlockLinks), keep(&KickDuration), keep(&configuredHooks),
+	} {
+		t.Cleanup(restore)
+	}
+}
+
+func TestLoadConfigReadsEnvironment(t *testing.T) {
+	keepConfig(t)
+
+	t.Setenv("WS_SEND_QUEUE_SIZE", "64")
+	t.Setenv("WS_MOVEMENT_POLICY", "drop")
+	t.Setenv("WS_PING_INTERVAL", "3s")
+	t.Setenv("WS_VIEW_RADIUS", "12")
+	t.Setenv("PROXIMITY_RADIUS", "4")
+	t.Setenv("WS_RATE_MOVE", "5")
+	t.Setenv("CHAT_BLOCKED_WORDS", "darn")
+	LoadConfig()
+
+	if SendQueueSize != 64 || MovementOverflow != MovementDrop || ProximityRadius != 4 {
+		t.Fatalf("settings not loaded: queue=%d movement=%s proximity=%d", SendQueueSize, MovementOverflow, ProximityRadius)
+	}
+	if PingInterval != 3*time.Second || ViewRadius != 12 {
+		t.Fatalf("settings not loaded: ping=%s view=%d", PingInterval, ViewRadius)
+	}
+	if limit := MessageRateLimits[TypeMove]; limit.Rate != 5 || limit.Burst != 40 {
+		t.Fatalf("move limit = %+v", limit)
+	}
+	if text, err := (&User{}).moderate("well darn it"); err != nil || text != "well **** it" {
+		t.Fatalf("blocked word from CHAT_BLOCKED_WORDS not masked: %q, %v", text, err)
+	}
+}
+
+func TestLoadConfigKeepsDefaultsForInvalidValues(t *testing.T) {
+	keepConfig(t)
+	radius, grace := ProximityRadius, ResumeGrace
+
+	t.Setenv("PROXIMITY_RADIUS", "not-a-number")
+	t.Setenv("WS_RESUME_GRACE", "30")
+	LoadConfig()
+
+	if ProximityRadius != radius || ResumeGrace != grace {
+		t.Fatalf("invalid settings should keep the defaults, got proximity=%d grace=%s", ProximityRadius, ResumeGrace)
+	}
+}
+
+func TestLoadConfigRejectsOutOfRangeQueueSettings(t *testing.T) {
+	keepConfig(t)
+	size, policy := SendQueueSize, MovementOverflow
+
+	for _, value := range []string{"0", "-1"} {
+		t.Setenv("WS_SEND_QUEUE_SIZE", value)
+		t.Setenv("WS_MOVEMENT_POLICY", "dorp")
+		LoadConfig()
+
+		if SendQueueSize != size || MovementOverflow != policy {
+			t.Fatalf("WS_SEND_QUEUE_SIZE=%s: got queue=%d movement=%s, want the defaults", value, SendQueueSize, MovementOverflow)
+		}
+	}
+
+	// Users created with the loaded settings still get a working queue
+	user, _ := newTestUser(t, "")
+	user.Send(chat("hello"))
+	if len(user.queue.messages) != 1 {
+		t.Fatal("message was not queued")
+	}
+}
+
+func TestLoadConfigRejectsNonPositiveTimeouts(t *testing.T) {
+	keepConfig(t)
+	want := []time.Duration{PingInterval, PongTimeout, ResumeGrace, WriteTimeout, SlowClientTimeout}
+
+	t.Setenv("WS_PING_INTERVAL", "0s")
+	t.Setenv("WS_PONG_TIMEOUT", "-5s")
+	t.Setenv("WS_RESUME_GRACE", "0")
+	t.Setenv("WS_WRITE_TIMEOUT", "-1ms")
+	t.Setenv("WS_SLOW_CLIENT_TIMEOUT", "0s")
+	LoadConfig()
+
+	got := []time.Duration{PingInterval, PongTimeout, ResumeGrace, WriteTimeout, SlowClientTimeout}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("timeouts = %v, want the defaults %v", got, want)
+		}
+	}
+}
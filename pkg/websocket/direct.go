@@ -0,0 +1,161 @@
+package websocket
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"github.com/genosis18m/Metaverse_go/internal/database"
+	"github.com/genosis18m/Metaverse_go/internal/models"
+	"github.com/genosis18m/Metaverse_go/internal/utils"
+)
+
+// userTopic is the backplane topic carrying the direct messages of a user
+func userTopic(userID string) string {
+	return "user:" + userID
+}
+
+// userSubscription counts the local connections of a user subscribed to its topic
+type userSubscription struct {
+	conns       int
+	unsubscribe func()
+}
+
+// addConnection subscribes to the topic of a user on its first local
+// connection. The caller must hold the lock.
+func (rm *RoomManager) addConnection(userID string) {
+	if sub, exists := rm.userSubs[userID]; exists {
+		sub.conns++
+		return
+	}
+
+	unsubscribe, err := rm.backplane.Subscribe(userTopic(userID), rm.handleEnvelope, nil)
+	if err != nil {
+		log.Printf("Error subscribing to backplane: %v", err)
+		unsubscribe = func() {}
+	}
+	rm.userSubs[userID] = &userSubscription{conns: 1, unsubscribe: unsubscribe}
+}
+
+// removeConnection unsubscribes from the topic of a user once its last local
+// connection is gone. The caller must hold the lock.
+func (rm *RoomManager) removeConnection(userID string) {
+	sub, exists := rm.userSubs[userID]
+	if !exists {
+		return
+	}
+	sub.conns--
+	if sub.conns <= 0 {
+		sub.unsubscribe()
+		delete(rm.userSubs, userID)
+	}
+}
+
+// SendToUser delivers a message to every connection of a user, whichever
+// space and node they are on
+func (rm *RoomManager) SendToUser(userID string, message OutgoingMessage) {
+	rm.deliverToUser(userID, message)
+
+	rm.publishUnlocked(userTopic(userID), Envelope{Kind: EnvelopeUser, TargetID: userID, Message: &message})
+}
+
+// deliverToUser queues a message for the local connections of a user
+func (rm *RoomManager) deliverToUser(userID string, message OutgoingMessage) {
+	rm.mu.RLock()
+	users := make([]*User, 0)
+	for _, room := range rm.rooms {
+		for _, user := range room {
+			if user.UserID == userID {
+				users = append(users, user)
+			}
+		}
+	}
+	rm.mu.RUnlock()
+
+	for _, user := range users {
+		user.Send(message)
+	}
+}
+
+// handleDirectMessage stores a private message and delivers it to every
+// connection of the recipient and of the sender
+func (u *User) handleDirectMessage(payload DirectMessageRequest) {
+	if payload.TargetUserID == u.UserID {
+		u.sendError(ErrInvalidPayload, "cannot message yourself", TypeDirectMessage)
+		return
+	}
+
+	text, err := u.moderate(payload.Message)
+	if err != nil {
+		u.sendError(ErrMessageRejected, err.Error(), TypeDirectMessage)
+		return
+	}
+
+	var target models.User
+	if err := database.GetDB().First(&target, "id = ?", payload.TargetUserID).Error; err != nil {
+		u.sendError(ErrTargetNotFound, "target user not found", TypeDirectMessage)
+		return
+	}
+
+	spaceID := u.SpaceID
+	msg := models.DirectMessage{
+		ID:          utils.GenerateCUID(),
+		Text:        text,
+		SenderID:    u.UserID,
+		RecipientID: target.ID,
+		SpaceID:     &spaceID,
+		CreatedAt:   time.Now(),
+	}
+	if err := database.GetDB().Create(&msg).Error; err != nil {
+		log.Printf("Error saving direct message: %v", err)
+		u.sendError(ErrInternal, "could not send message", TypeDirectMessage)
+		return
+	}
+
+	out := OutgoingMessage{
+		Type: TypeDirectMessage,
+		Payload: DirectMessagePayload{
+			ID:           msg.ID,
+			FromUserID:   u.UserID,
+			FromUsername: u.Username,
+			ToUserID:     target.ID,
+			SpaceID:      spaceID,
+			Message:      msg.Text,
+			Timestamp:    msg.CreatedAt.Format(time.RFC3339),
+		},
+	}
+	rm := GetRoomManager()
+	rm.SendToUser(target.ID, out)
+	// Echo to the sender's connections so every open client shows the message
+	rm.SendToUser(u.UserID, out)
+}
+
+// handleDirectMessageRead records a read receipt and tells the sender
+func (u *User) handleDirectMessageRead(payload DirectMessageReadRequest) {
+	readAt, marked, err := database.MarkDirectMessagesRead(u.UserID, payload.UserID, payload.MessageID)
+	if errors.Is(err, database.ErrCursorNotFound) {
+		u.sendError(ErrInvalidPayload, "message not found", TypeDirectMessageRead)
+		return
+	}
+	if err != nil {
+		log.Printf("Error marking direct messages read: %v", err)
+		u.sendError(ErrInternal, "could not mark messages read", TypeDirectMessageRead)
+		return
+	}
+	if marked == 0 {
+		return
+	}
+
+	out := OutgoingMessage{
+		Type: TypeDirectMessageRead,
+		Payload: DirectMessageReadPayload{
+			ReaderID:  u.UserID,
+			SenderID:  payload.UserID,
+			MessageID: payload.MessageID,
+			ReadAt:    readAt.Format(time.RFC3339),
+		},
+	}
+	rm := GetRoomManager()
+	rm.SendToUser(payload.UserID, out)
+	rm.SendToUser(u.UserID, out)
+}
@@ -0,0 +1,133 @@
+package websocket
+
+import (
+	"github.com/genosis18m/Metaverse_go/internal/database"
+	"github.com/genosis18m/Metaverse_go/internal/models"
+)
+
+// Grid is an occupancy map of the tiles covered by static elements in a space,
+// along with the portals placed on it and the tiles users stand on
+type Grid struct {
+	Width   int
+	Height  int
+	blocked []bool
+	portals map[int]*models.SpacePortal
+
+	// Users on each tile, and the tile of each user by connection ID
+	occupants map[int]int
+	tileOf    map[string]int
+}
+
+// NewGrid creates an empty grid of the given size
+func NewGrid(width, height int) *Grid {
+	if width < 0 {
+		width = 0
+	}
+	if height < 0 {
+		height = 0
+	}
+	return &Grid{
+		Width:   width,
+		Height:  height,
+		blocked: make([]bool, width*height),
+		portals: make(map[int]*models.SpacePortal),
+
+		occupants: make(map[int]int),
+		tileOf:    make(map[string]int),
+	}
+}
+
+// Block marks a rectangle of tiles as blocked, clipped to the grid
+func (g *Grid) Block(x, y, width, height int) {
+	for ty := y; ty < y+height; ty++ {
+		for tx := x; tx < x+width; tx++ {
+			if g.inBounds(tx, ty) {
+				g.blocked[ty*g.Width+tx] = true
+			}
+		}
+	}
+}
+
+// IsBlocked reports whether a tile is covered by a static element
+func (g *Grid) IsBlocked(x, y int) bool {
+	if !g.inBounds(x, y) {
+		return false
+	}
+	return g.blocked[y*g.Width+x]
+}
+
+// Occupy records that a user stands on a tile, leaving its previous one
+func (g *Grid) Occupy(id string, x, y int) {
+	g.Vacate(id)
+	if g.inBounds(x, y) {
+		tile := y*g.Width + x
+		g.occupants[tile]++
+		g.tileOf[id] = tile
+	}
+}
+
+// Vacate records that a user left the grid
+func (g *Grid) Vacate(id string) {
+	tile, exists := g.tileOf[id]
+	if !exists {
+		return
+	}
+	delete(g.tileOf, id)
+	if g.occupants[tile]--; g.occupants[tile] <= 0 {
+		delete(g.occupants, tile)
+	}
+}
+
+// IsOccupied reports whether a user stands on a tile
+func (g *Grid) IsOccupied(x, y int) bool {
+	if !g.inBounds(x, y) {
+		return false
+	}
+	return g.occupants[y*g.Width+x] > 0
+}
+
+// AddPortal places a portal on its tile
+func (g *Grid) AddPortal(portal *models.SpacePortal) {
+	if g.inBounds(portal.X, portal.Y) {
+		g.portals[portal.Y*g.Width+portal.X] = portal
+	}
+}
+
+// PortalAt returns the portal on a tile, or nil
+func (g *Grid) PortalAt(x, y int) *models.SpacePortal {
+	if !g.inBounds(x, y) {
+		return nil
+	}
+	return g.portals[y*g.Width+x]
+}
+
+func (g *Grid) inBounds(x, y int) bool {
+	return x >= 0 && x < g.Width && y >= 0 && y < g.Height
+}
+
+// LoadGrid builds the occupancy grid of a space from its static elements and portals
+func LoadGrid(spaceID string, width, height int) (*Grid, error) {
+	var elements []models.SpaceElement
+	err := database.GetDB().Preload("Element").Where("space_id = ?", spaceID).Find(&elements).Error
+	if err != nil {
+		return nil, err
+	}
+
+	grid := NewGrid(width, height)
+	for _, e := range elements {
+		if e.Element == nil || !e.Element.Static {
+			continue
+		}
+		w, h := e.Footprint()
+		grid.Block(e.X, e.Y, w, h)
+	}
+
+	var portals []*models.SpacePortal
+	if err := database.GetDB().Where("space_id = ?", spaceID).Find(&portals).Error; err != nil {
+		return nil, err
+	}
+	for _, portal := range portals {
+		grid.AddPortal(portal)
+	}
+	return grid, nil
+}
@@ -0,0 +1,143 @@
+package websocket
+
+import (
+	"testing"
+)
+
+// setTestGrid installs a grid for a room, as joining would load it
+func setTestGrid(t *testing.T, rm *RoomManager, spaceID string, grid *Grid) {
+	t.Helper()
+	rm.mu.Lock()
+	rm.setGrid(spaceID, grid)
+	rm.mu.Unlock()
+	t.Cleanup(func() {
+		rm.mu.Lock()
+		delete(rm.grids, spaceID)
+		rm.mu.Unlock()
+	})
+}
+
+func TestGridBlocksTiles(t *testing.T) {
+	grid := NewGrid(10, 5)
+	grid.Block(2, 1, 3, 2) // a 3×2 table
+	grid.Block(8, 4, 4, 4) // clipped at the corner
+
+	cases := []struct {
+		name    string
+		x, y    int
+		blocked bool
+	}{
+		{"table corner", 2, 1, true},
+		{"table far corner", 4, 2, true},
+		{"left of the table", 1, 1, false},
+		{"below the table", 2, 3, false},
+		{"clipped element", 9, 4, true},
+		{"outside on the right", 10, 4, false},
+		{"outside below", 8, 5, false},
+		{"negative", -1, 0, false},
+	}
+	for _, c := range cases {
+		if got := grid.IsBlocked(c.x, c.y); got != c.blocked {
+			t.Errorf("%s (%d,%d): blocked %t, want %t", c.name, c.x, c.y, got, c.blocked)
+		}
+	}
+}
+
+func TestNewGridClampsNegativeSizes(t *testing.T) {
+	grid := NewGrid(-3, 4)
+	if grid.Width != 0 || grid.Height != 4 {
+		t.Fatalf("size = %d×%d, want 0×4", grid.Width, grid.Height)
+	}
+	grid.Block(0, 0, 1, 1)
+	grid.Occupy("alice", 0, 0)
+	if grid.IsBlocked(0, 0) || grid.IsOccupied(0, 0) {
+		t.Fatal("an empty grid has a blocked or occupied tile")
+	}
+}
+
+func TestGridOccupancy(t *testing.T) {
+	grid := NewGrid(10, 10)
+
+	steps := []struct {
+		name     string
+		apply    func()
+		occupied [][2]int
+		free     [][2]int
+	}{
+		{"alice joins", func() { grid.Occupy("alice", 1, 1) }, [][2]int{{1, 1}}, [][2]int{{1, 2}}},
+		{"alice moves", func() { grid.Occupy("alice", 1, 2) }, [][2]int{{1, 2}}, [][2]int{{1, 1}}},
+		{"bob joins on her tile", func() { grid.Occupy("bob", 1, 2) }, [][2]int{{1, 2}}, nil},
+		{"alice leaves", func() { grid.Vacate("alice") }, [][2]int{{1, 2}}, nil},
+		{"bob leaves", func() { grid.Vacate("bob") }, nil, [][2]int{{1, 2}}},
+		{"leaving twice", func() { grid.Vacate("bob") }, nil, [][2]int{{1, 2}}},
+		{"out of bounds", func() { grid.Occupy("carol", 10, 0) }, nil, [][2]int{{10, 0}, {9, 0}}},
+	}
+	for _, step := range steps {
+		step.apply()
+		for _, tile := range step.occupied {
+			if !grid.IsOccupied(tile[0], tile[1]) {
+				t.Errorf("%s: %v is free, want occupied", step.name, tile)
+			}
+		}
+		for _, tile := range step.free {
+			if grid.IsOccupied(tile[0], tile[1]) {
+				t.Errorf("%s: %v is occupied, want free", step.name, tile)
+			}
+		}
+	}
+}
+
+func TestRoomOccupancyFollowsUsers(t *testing.T) {
+	rm := newTestRoomManager()
+	alice := joinTestRoom(t, rm, "space-1", "alice", 1, 1)
+	// Users already in the room when the grid is loaded are on it
+	setTestGrid(t, rm, "space-1", NewGrid(20, 20))
+	if !rm.IsOccupied("space-1", 1, 1) {
+		t.Fatal("the tile of a user in the room is free")
+	}
+
+	bob := joinTestRoom(t, rm, "space-1", "bob", 5, 5)
+	if !rm.IsOccupied("space-1", 5, 5) {
+		t.Fatal("the tile of a joining user is free")
+	}
+
+	rm.MoveUser(alice, 2, 1)
+	if rm.IsOccupied("space-1", 1, 1) || !rm.IsOccupied("space-1", 2, 1) {
+		t.Fatal("moving did not move the occupied tile")
+	}
+
+	rm.RemoveUser(bob, "space-1")
+	if rm.IsOccupied("space-1", 5, 5) {
+		t.Fatal("the tile of a user who left is still occupied")
+	}
+}
+
+func TestMoveOntoBlockedOrOccupiedTileIsRejected(t *testing.T) {
+	rm := GetRoomManager()
+	spaceID := "grid-" + t.Name()
+	alice := joinTestRoom(t, rm, spaceID, "alice", 5, 5)
+	joinTestRoom(t, rm, spaceID, "bob", 5, 6)
+	grid := NewGrid(100, 100)
+	grid.Block(6, 5, 1, 1)
+	setTestGrid(t, rm, spaceID, grid)
+
+	for _, target := range [][2]int{{6, 5}, {5, 6}} {
+		moveTo(alice, target[0], target[1])
+		rejected := sentOfType(alice, TypeMovementRejected)
+		if len(rejected) != 1 {
+			t.Fatalf("move to %v: got %d movement-rejected messages, want 1", target, len(rejected))
+		}
+		if payload := rejected[0].Payload.(MovementPayload); payload.X != 5 || payload.Y != 5 {
+			t.Fatalf("move to %v: rejected at (%d,%d), want (5,5)", target, payload.X, payload.Y)
+		}
+		if alice.X != 5 || alice.Y != 5 {
+			t.Fatalf("move to %v: alice moved to (%d,%d)", target, alice.X, alice.Y)
+		}
+	}
+
+	// A free tile is fine
+	moveTo(alice, 4, 5)
+	if got := sentOfType(alice, TypeMovementRejected); len(got) != 0 || alice.X != 4 {
+		t.Fatalf("move to a free tile: rejected %d times, alice at (%d,%d)", len(got), alice.X, alice.Y)
+	}
+}
@@ -0,0 +1,130 @@
+package websocket
+
+import (
+	"encoding/json"
+	"log"
+
+	"github.com/genosis18m/Metaverse_go/internal/database"
+	"github.com/genosis18m/Metaverse_go/internal/events"
+	"github.com/genosis18m/Metaverse_go/internal/models"
+)
+
+// HandleEvent applies a change made through the HTTP API to the local users
+// it affects. Every node receives the event, so nothing is forwarded over
+// the backplane.
+func (rm *RoomManager) HandleEvent(event events.Event) {
+	switch event.Type {
+	case events.SpaceChanged:
+		rm.RefreshGrid(event.SpaceID)
+		rm.RefreshZones(event.SpaceID)
+	case events.ElementAdded, events.ElementUpdated, events.ElementRemoved:
+		rm.elementChanged(event)
+	case events.SpaceAccessChanged:
+		rm.revokeAccess(event.SpaceID)
+	case events.SpaceDeleted:
+		rm.closeRoom(event.SpaceID)
+	case events.UserSuspended, events.UserDeleted:
+		rm.disconnectUser(event.UserID)
+	}
+}
+
+// elementChanged refreshes the occupancy grid of a space after one of its
+// elements changed and pushes the change to the room, so editors see each
+// other's changes without reloading the space
+func (rm *RoomManager) elementChanged(event events.Event) {
+	var payload ElementPayload
+	if err := json.Unmarshal(event.Element, &payload); err != nil {
+		log.Printf("Error decoding %s event: %v", event.Type, err)
+		return
+	}
+	payload.By = event.By
+
+	rm.RefreshGrid(event.SpaceID)
+	rm.deliver(event.SpaceID, "", OutgoingMessage{Type: MessageType(event.Type), Payload: payload})
+}
+
+// revokeAccess disconnects the local users of a space who may no longer
+// access it, as kicking them would
+func (rm *RoomManager) revokeAccess(spaceID string) {
+	var space models.Space
+	if err := database.GetDB().First(&space, "id = ?", spaceID).Error; err != nil {
+		log.Printf("Error loading space %s: %v", spaceID, err)
+		return
+	}
+
+	rm.mu.RLock()
+	userIDs := make(map[string]bool)
+	for _, user := range rm.rooms[spaceID] {
+		userIDs[user.UserID] = true
+	}
+	for _, d := range rm.detached {
+		if d.user.SpaceID == spaceID {
+			userIDs[d.user.UserID] = true
+		}
+	}
+	rm.mu.RUnlock()
+
+	for userID := range userIDs {
+		if !database.CanAccessSpace(space, userID) {
+			rm.removeLocal(spaceID, userID, ErrForbidden, "you no longer have access to this space")
+		}
+	}
+}
+
+// closeRoom tells the local users of a deleted space and disconnects them.
+// They are destroyed rather than kept around for resuming.
+func (rm *RoomManager) closeRoom(spaceID string) {
+	rm.deliver(spaceID, "", OutgoingMessage{Type: TypeSpaceDeleted, Payload: SpaceDeletedPayload{SpaceID: spaceID}})
+
+	rm.mu.Lock()
+	users := make([]*User, 0, len(rm.rooms[spaceID]))
+	for _, user := range rm.rooms[spaceID] {
+		users = append(users, user)
+	}
+	detached := make([]*User, 0)
+	for token, d := range rm.detached {
+		if d.user.SpaceID == spaceID && d.timer.Stop() {
+			delete(rm.detached, token)
+			detached = append(detached, d.user)
+		}
+	}
+	rm.mu.Unlock()
+
+	for _, user := range users {
+		user.kicked.Store(true)
+		user.fail(ErrSpaceNotFound, "this space was deleted", "")
+	}
+	for _, user := range detached {
+		user.Destroy()
+	}
+}
+
+// disconnectUser closes every local connection of a suspended or deleted
+// user, in every space
+func (rm *RoomManager) disconnectUser(userID string) {
+	rm.mu.Lock()
+	users := make([]*User, 0)
+	for _, room := range rm.rooms {
+		for _, user := range room {
+			if user.UserID == userID {
+				users = append(users, user)
+			}
+		}
+	}
+	detached := make([]*User, 0)
+	for token, d := range rm.detached {
+		if d.user.UserID == userID && d.timer.Stop() {
+			delete(rm.detached, token)
+			detached = append(detached, d.user)
+		}
+	}
+	rm.mu.Unlock()
+
+	for _, user := range users {
+		user.kicked.Store(true)
+		user.fail(ErrSuspended, "your account is no longer active", "")
+	}
+	for _, user := range detached {
+		user.Destroy()
+	}
+}
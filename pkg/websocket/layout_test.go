@@ -0,0 +1,179 @@
+package websocket
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/genosis18m/Metaverse_go/internal/database"
+	"github.com/genosis18m/Metaverse_go/internal/events"
+	"github.com/genosis18m/Metaverse_go/internal/models"
+	"github.com/genosis18m/Metaverse_go/internal/utils"
+)
+
+// subscribeTestBus delivers the events of a new in-memory bus to a room manager
+func subscribeTestBus(t *testing.T, rm *RoomManager) events.Bus {
+	t.Helper()
+	bus := events.NewMemoryBus()
+	unsubscribe, err := bus.Subscribe(rm.HandleEvent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(unsubscribe)
+	return bus
+}
+
+func isClosing(u *User) bool {
+	u.queue.mu.Lock()
+	defer u.queue.mu.Unlock()
+	return u.queue.closing
+}
+
+func TestElementEventsReachTheRoom(t *testing.T) {
+	rm := newTestRoomManager()
+	bus := subscribeTestBus(t, rm)
+	alice := joinTestRoom(t, rm, "space-1", "alice", 1, 1)
+	bob := joinTestRoom(t, rm, "space-1", "bob", 90, 90)
+	outsider := joinTestRoom(t, rm, "space-2", "carol", 1, 1)
+
+	element, _ := json.Marshal(ElementPayload{ID: "placed-1", Element: ElementDetail{ID: "desk", Width: 2, Height: 1}, X: 3, Y: 4, Rotation: 90})
+	bus.Publish(events.Event{Type: events.ElementAdded, SpaceID: "space-1", By: "alice", Element: element})
+
+	// Layout changes are not spatial: users far from the element see them too
+	for _, u := range []*User{alice, bob} {
+		got := sentOfType(u, MessageType(events.ElementAdded))
+		if len(got) != 1 {
+			t.Fatalf("%s got %d element-added messages, want 1", u.UserID, len(got))
+		}
+		payload := got[0].Payload.(ElementPayload)
+		if payload.ID != "placed-1" || payload.X != 3 || payload.Rotation != 90 || payload.By != "alice" {
+			t.Fatalf("%s got %+v", u.UserID, payload)
+		}
+	}
+	if got := sent(outsider); len(got) != 0 {
+		t.Fatalf("a user of another space got %v", got)
+	}
+
+	// A malformed element is dropped
+	bus.Publish(events.Event{Type: events.ElementRemoved, SpaceID: "space-1", Element: json.RawMessage(`"oops"`)})
+	if got := sent(alice); len(got) != 0 {
+		t.Fatalf("a malformed event was delivered: %v", got)
+	}
+}
+
+func TestSpaceDeletedClosesTheRoom(t *testing.T) {
+	rm := newTestRoomManager()
+	bus := subscribeTestBus(t, rm)
+	alice := joinTestRoom(t, rm, "space-1", "alice", 1, 1)
+	bob := joinTestRoom(t, rm, "space-2", "bob", 1, 1)
+
+	bus.Publish(events.Event{Type: events.SpaceDeleted, SpaceID: "space-1"})
+
+	messages := sent(alice)
+	if len(messages) != 2 || messages[0].Type != TypeSpaceDeleted || messages[1].Payload.(ErrorPayload).Code != ErrSpaceNotFound {
+		t.Fatalf("alice got %v, want space-deleted then a space_not_found error", messages)
+	}
+	if !isClosing(alice) || !alice.kicked.Load() {
+		t.Fatal("the connection to a deleted space is kept open or can be resumed")
+	}
+	if isClosing(bob) {
+		t.Fatal("a user of another space was disconnected")
+	}
+}
+
+func TestSuspendedUserIsDisconnectedEverywhere(t *testing.T) {
+	rm := newTestRoomManager()
+	bus := subscribeTestBus(t, rm)
+	first := joinTestRoom(t, rm, "space-1", "alice", 1, 1)
+	second := joinTestRoom(t, rm, "space-2", "alice", 1, 1)
+	bob := joinTestRoom(t, rm, "space-1", "bob", 2, 2)
+
+	bus.Publish(events.Event{Type: events.UserSuspended, UserID: "alice"})
+
+	for _, u := range []*User{first, second} {
+		if got := lastError(t, u); got.Code != ErrSuspended {
+			t.Fatalf("error = %+v, want suspended", got)
+		}
+		if !isClosing(u) {
+			t.Fatal("a connection of the suspended user is kept open")
+		}
+	}
+	if isClosing(bob) {
+		t.Fatal("another user was disconnected")
+	}
+}
+
+func TestUsersWhoLostAccessAreDisconnected(t *testing.T) {
+	withTestDB(t)
+	rm := newTestRoomManager()
+	bus := subscribeTestBus(t, rm)
+	creatorAccount, memberAccount, visitorAccount := createTestAccount(t), createTestAccount(t), createTestAccount(t)
+	space := createTestSpace(t, creatorAccount.ID)
+	addTestMember(t, space.ID, memberAccount.ID, models.SpaceRoleMember)
+	creator := joinTestRoom(t, rm, space.ID, creatorAccount.ID, 1, 1)
+	member := joinTestRoom(t, rm, space.ID, memberAccount.ID, 2, 2)
+	visitor := joinTestRoom(t, rm, space.ID, visitorAccount.ID, 3, 3)
+
+	if err := database.DB.Model(&space).Update("visibility", models.SpaceVisibilityPrivate).Error; err != nil {
+		t.Fatal(err)
+	}
+	bus.Publish(events.Event{Type: events.SpaceAccessChanged, SpaceID: space.ID})
+
+	if got := lastError(t, visitor); got.Code != ErrForbidden {
+		t.Fatalf("error = %+v, want forbidden", got)
+	}
+	if !isClosing(visitor) || !visitor.kicked.Load() {
+		t.Fatal("a visitor of a private space is kept or can resume")
+	}
+	for _, u := range []*User{creator, member} {
+		if isClosing(u) {
+			t.Fatalf("%s, who still has access, was disconnected", u.UserID)
+		}
+	}
+}
+
+func TestLayoutEventsRefreshGridAndZones(t *testing.T) {
+	withTestDB(t)
+	account := createTestAccount(t)
+	space := createTestSpace(t, account.ID)
+	rm := newTestRoomManager()
+	bus := subscribeTestBus(t, rm)
+	joinTestRoom(t, rm, space.ID, account.ID, 0, 0)
+	rm.EnsureGrid(space.ID, space.Width, space.Height)
+	rm.EnsureZones(space.ID)
+
+	desk := models.Element{ID: utils.GenerateCUID(), Width: 2, Height: 1, Static: true, ImageURL: "https://example.com/desk.png"}
+	if err := database.DB.Create(&desk).Error; err != nil {
+		t.Fatal(err)
+	}
+	placed := models.SpaceElement{ID: utils.GenerateCUID(), SpaceID: space.ID, ElementID: desk.ID, X: 5, Y: 5}
+	if err := database.DB.Create(&placed).Error; err != nil {
+		t.Fatal(err)
+	}
+	if rm.IsBlocked(space.ID, 5, 5) {
+		t.Fatal("the grid changed before the event")
+	}
+
+	element, _ := json.Marshal(ElementPayload{ID: placed.ID, X: 5, Y: 5})
+	bus.Publish(events.Event{Type: events.ElementAdded, SpaceID: space.ID, Element: element})
+	if !rm.IsBlocked(space.ID, 5, 5) || !rm.IsBlocked(space.ID, 6, 5) {
+		t.Fatal("the new static element does not block its tiles")
+	}
+
+	zone := models.SpaceZone{ID: utils.GenerateCUID(), SpaceID: space.ID, Name: "Lounge", Shape: models.ZoneShapeRect, X: 10, Y: 10, Width: 3, Height: 3, CreatedAt: time.Now()}
+	if err := database.DB.Create(&zone).Error; err != nil {
+		t.Fatal(err)
+	}
+	portal := models.SpacePortal{ID: utils.GenerateCUID(), SpaceID: space.ID, X: 15, Y: 15, TargetSpaceID: space.ID, TargetX: 0, TargetY: 0}
+	if err := database.DB.Create(&portal).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	bus.Publish(events.Event{Type: events.SpaceChanged, SpaceID: space.ID})
+	if got := rm.ZoneAt(space.ID, 11, 11); got == nil || got.ID != zone.ID {
+		t.Fatalf("zone at (11,11) = %+v, want the new zone", got)
+	}
+	if got := rm.PortalAt(space.ID, 15, 15); got == nil || got.ID != portal.ID {
+		t.Fatalf("portal at (15,15) = %+v, want the new portal", got)
+	}
+}
@@ -0,0 +1,380 @@
+package websocket
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/genosis18m/Metaverse_go/internal/database"
+	"github.com/genosis18m/Metaverse_go/internal/models"
+)
+
+// Chat moderation settings, configurable through the environment
+var (
+	ChatMaxLength    = 500
+	ChatBlockedWords = ""
+	ChatBlockLinks   = false
+	// KickDuration is how long a kicked user stays out of the space when the
+	// kick does not say
+	KickDuration = 10 * time.Minute
+)
+
+// ModerationHook inspects a chat or direct message before it is stored. It
+// returns the text to keep, possibly rewritten, or an error whose text is
+// shown to the sender when the message is rejected.
+type ModerationHook func(u *User, text string) (string, error)
+
+var (
+	moderationMu sync.RWMutex
+	// configuredHooks are built from the settings by LoadConfig and run
+	// before the hooks added with RegisterModerationHook
+	configuredHooks = defaultModerationHooks()
+	moderationHooks []ModerationHook
+)
+
+// RegisterModerationHook appends a hook to the moderation chain
+func RegisterModerationHook(hook ModerationHook) {
+	moderationMu.Lock()
+	defer moderationMu.Unlock()
+	moderationHooks = append(moderationHooks, hook)
+}
+
+// defaultModerationHooks builds the chain configured through the environment
+func defaultModerationHooks() []ModerationHook {
+	hooks := make([]ModerationHook, 0, 3)
+	if ChatMaxLength > 0 {
+		hooks = append(hooks, MaxLengthHook(ChatMaxLength))
+	}
+	if ChatBlockedWords != "" {
+		hooks = append(hooks, WordFilterHook(strings.Split(ChatBlockedWords, ",")))
+	}
+	if ChatBlockLinks {
+		hooks = append(hooks, LinkBlockHook())
+	}
+	return hooks
+}
+
+// moderate runs a message through every hook in order
+func (u *User) moderate(text string) (string, error) {
+	moderationMu.RLock()
+	hooks := append(append([]ModerationHook{}, configuredHooks...), moderationHooks...)
+	moderationMu.RUnlock()
+
+	for _, hook := range hooks {
+		var err error
+		if text, err = hook(u, text); err != nil {
+			return "", err
+		}
+	}
+	if strings.TrimSpace(text) == "" {
+		return "", errors.New("message is empty")
+	}
+	return text, nil
+}
+
+// MaxLengthHook rejects messages longer than max characters
+func MaxLengthHook(max int) ModerationHook {
+	return func(u *User, text string) (string, error) {
+		if utf8.RuneCountInString(text) > max {
+			return "", fmt.Errorf("message is longer than %d characters", max)
+		}
+		return text, nil
+	}
+}
+
+// WordFilterHook masks the listed words, matched case-insensitively as whole words
+func WordFilterHook(words []string) ModerationHook {
+	quoted := make([]string, 0, len(words))
+	for _, word := range words {
+		if word = strings.TrimSpace(word); word != "" {
+			quoted = append(quoted, regexp.QuoteMeta(word))
+		}
+	}
+	if len(quoted) == 0 {
+		return func(u *User, text string) (string, error) { return text, nil }
+	}
+
+	pattern := regexp.MustCompile(`(?i)\b(` + strings.Join(quoted, "|") + `)\b`)
+	return func(u *User, text string) (string, error) {
+		return pattern.ReplaceAllStringFunc(text, func(match string) string {
+			return strings.Repeat("*", utf8.RuneCountInString(match))
+		}), nil
+	}
+}
+
+var linkPattern = regexp.MustCompile(`(?i)\b(https?://|www\.)\S+`)
+
+// LinkBlockHook rejects messages containing links
+func LinkBlockHook() ModerationHook {
+	return func(u *User, text string) (string, error) {
+		if linkPattern.MatchString(text) {
+			return "", errors.New("links are not allowed")
+		}
+		return text, nil
+	}
+}
+
+// isSpaceOwner reports whether the user owns the space it is in, as its
+// creator or as a member with the owner role
+func (u *User) isSpaceOwner() bool {
+	space := models.Space{ID: u.SpaceID, CreatorID: u.spaceOwnerID}
+	return database.HasSpaceRole(space, u.UserID, models.SpaceRoleOwner)
+}
+
+// outranks reports whether the user's role in the space is above the role of
+// another user. Nobody outranks the creator of the space.
+func (u *User) outranks(userID string) bool {
+	space := models.Space{ID: u.SpaceID, CreatorID: u.spaceOwnerID}
+	if userID == space.CreatorID {
+		return false
+	}
+	own, ok := database.SpaceRole(space, u.UserID)
+	if !ok {
+		return false
+	}
+	other, ok := database.SpaceRole(space, userID)
+	return !ok || !other.AtLeast(own)
+}
+
+// findMessage loads a message of the user's space for editing or deleting,
+// checking that the user wrote it or owns the space
+func (u *User) findMessage(messageID string, requestType MessageType) (*models.Message, bool) {
+	var msg models.Message
+	if err := database.GetDB().First(&msg, "id = ? AND space_id = ?", messageID, u.SpaceID).Error; err != nil {
+		u.sendError(ErrMessageNotFound, "message not found", requestType)
+		return nil, false
+	}
+	if msg.UserID != u.UserID && !u.isSpaceOwner() {
+		u.sendError(ErrForbidden, "only the author or the space owner can change this message", requestType)
+		return nil, false
+	}
+	return &msg, true
+}
+
+// handleChatEdit replaces the text of a message and tells everyone who received it
+func (u *User) handleChatEdit(payload ChatEditRequest) {
+	msg, ok := u.findMessage(payload.MessageID, TypeChatEdit)
+	if !ok {
+		return
+	}
+
+	text, err := u.moderate(payload.Message)
+	if err != nil {
+		u.sendError(ErrMessageRejected, err.Error(), TypeChatEdit)
+		return
+	}
+
+	editedAt := time.Now()
+	err = database.GetDB().Model(msg).Updates(map[string]interface{}{"text": text, "edited_at": editedAt}).Error
+	if err != nil {
+		log.Printf("Error editing message: %v", err)
+		u.sendError(ErrInternal, "could not edit message", TypeChatEdit)
+		return
+	}
+
+	u.sendToAudience(*msg, OutgoingMessage{
+		Type: TypeChatEdited,
+		Payload: ChatEditedPayload{
+			ID:       msg.ID,
+			UserID:   msg.UserID,
+			Message:  text,
+			EditedBy: u.UserID,
+			EditedAt: editedAt.Format(time.RFC3339),
+		},
+	})
+}
+
+// handleChatDelete removes a message and tells everyone who received it
+func (u *User) handleChatDelete(payload ChatDeleteRequest) {
+	msg, ok := u.findMessage(payload.MessageID, TypeChatDelete)
+	if !ok {
+		return
+	}
+
+	if err := database.GetDB().Delete(msg).Error; err != nil {
+		log.Printf("Error deleting message: %v", err)
+		u.sendError(ErrInternal, "could not delete message", TypeChatDelete)
+		return
+	}
+
+	u.sendToAudience(*msg, OutgoingMessage{
+		Type: TypeChatDeleted,
+		Payload: ChatDeletedPayload{
+			ID:        msg.ID,
+			DeletedBy: u.UserID,
+		},
+	})
+}
+
+// sendToAudience delivers an event about a message to the users of the room
+// who received the message
+func (u *User) sendToAudience(msg models.Message, out OutgoingMessage) {
+	audience, err := database.MessageAudience(msg)
+	if err != nil {
+		log.Printf("Error loading message recipients: %v", err)
+		return
+	}
+	if audience == nil {
+		GetRoomManager().Broadcast(out, nil, u.SpaceID)
+		return
+	}
+
+	received := make(map[string]bool, len(audience))
+	for _, userID := range audience {
+		received[userID] = true
+	}
+	for _, user := range GetRoomManager().GetRoomUsers(u.SpaceID) {
+		if received[user.UserID] {
+			user.Send(out)
+		}
+	}
+}
+
+// handleMute stops a user from chatting in the space, for a while or until unmuted
+func (u *User) handleMute(payload MuteRequest) {
+	if !u.isSpaceOwner() {
+		u.sendError(ErrForbidden, "only the space owner can mute users", TypeMute)
+		return
+	}
+	if payload.UserID == u.UserID {
+		u.sendError(ErrInvalidPayload, "cannot mute yourself", TypeMute)
+		return
+	}
+	if !u.outranks(payload.UserID) {
+		u.sendError(ErrForbidden, "cannot mute a user whose role is not below yours", TypeMute)
+		return
+	}
+
+	mute := models.SpaceMute{
+		SpaceID:   u.SpaceID,
+		UserID:    payload.UserID,
+		MutedByID: u.UserID,
+		CreatedAt: time.Now(),
+	}
+	if payload.Duration > 0 {
+		until := time.Now().Add(time.Duration(payload.Duration) * time.Second)
+		mute.Until = &until
+	}
+	if err := database.GetDB().Save(&mute).Error; err != nil {
+		log.Printf("Error muting user: %v", err)
+		u.sendError(ErrInternal, "could not mute user", TypeMute)
+		return
+	}
+
+	event := ModerationPayload{UserID: payload.UserID, By: u.UserID}
+	if mute.Until != nil {
+		event.Until = mute.Until.Format(time.RFC3339)
+	}
+	GetRoomManager().Broadcast(OutgoingMessage{Type: TypeUserMuted, Payload: event}, nil, u.SpaceID)
+}
+
+// handleUnmute lifts the mute of a user
+func (u *User) handleUnmute(payload MuteRequest) {
+	if !u.isSpaceOwner() {
+		u.sendError(ErrForbidden, "only the space owner can unmute users", TypeUnmute)
+		return
+	}
+
+	err := database.GetDB().Delete(&models.SpaceMute{}, "space_id = ? AND user_id = ?", u.SpaceID, payload.UserID).Error
+	if err != nil {
+		log.Printf("Error unmuting user: %v", err)
+		u.sendError(ErrInternal, "could not unmute user", TypeUnmute)
+		return
+	}
+
+	GetRoomManager().Broadcast(OutgoingMessage{
+		Type:    TypeUserUnmuted,
+		Payload: ModerationPayload{UserID: payload.UserID, By: u.UserID},
+	}, nil, u.SpaceID)
+}
+
+// handleKick disconnects every connection of a user from the space and keeps
+// it out until the kick expires
+func (u *User) handleKick(payload KickRequest) {
+	if !u.isSpaceOwner() {
+		u.sendError(ErrForbidden, "only the space owner can kick users", TypeKick)
+		return
+	}
+	if payload.UserID == u.UserID {
+		u.sendError(ErrInvalidPayload, "cannot kick yourself", TypeKick)
+		return
+	}
+	if !u.outranks(payload.UserID) {
+		u.sendError(ErrForbidden, "cannot kick a user whose role is not below yours", TypeKick)
+		return
+	}
+	if GetRoomManager().FindUser(u.SpaceID, payload.UserID) == nil {
+		u.sendError(ErrTargetNotFound, "target user is not in this space", TypeKick)
+		return
+	}
+
+	duration := KickDuration
+	if payload.Duration > 0 {
+		duration = time.Duration(payload.Duration) * time.Second
+	}
+	kick := models.SpaceKick{
+		SpaceID:    u.SpaceID,
+		UserID:     payload.UserID,
+		KickedByID: u.UserID,
+		Until:      time.Now().Add(duration),
+		CreatedAt:  time.Now(),
+	}
+	if err := database.GetDB().Save(&kick).Error; err != nil {
+		log.Printf("Error kicking user: %v", err)
+		u.sendError(ErrInternal, "could not kick user", TypeKick)
+		return
+	}
+
+	// Tell the room first so the kicked user's own user-left follows it
+	GetRoomManager().Broadcast(OutgoingMessage{
+		Type:    TypeUserKicked,
+		Payload: ModerationPayload{UserID: payload.UserID, By: u.UserID, Until: kick.Until.Format(time.RFC3339)},
+	}, nil, u.SpaceID)
+	GetRoomManager().Kick(u.SpaceID, payload.UserID)
+}
+
+// Kick disconnects the connections of a user in a room, on every node
+func (rm *RoomManager) Kick(spaceID, userID string) {
+	rm.kickLocal(spaceID, userID)
+
+	rm.publishUnlocked(spaceID, Envelope{Kind: EnvelopeKick, TargetID: userID})
+}
+
+// kickLocal closes the local connections of a user in a room
+func (rm *RoomManager) kickLocal(spaceID, userID string) {
+	rm.removeLocal(spaceID, userID, ErrKicked, "you were removed from this space")
+}
+
+// removeLocal closes the local connections of a user in a room with an
+// error. The users are destroyed rather than kept around for resuming.
+func (rm *RoomManager) removeLocal(spaceID, userID string, code ErrorCode, message string) {
+	rm.mu.Lock()
+	users := make([]*User, 0)
+	for _, user := range rm.rooms[spaceID] {
+		if user.UserID == userID {
+			users = append(users, user)
+		}
+	}
+	detached := make([]*User, 0)
+	for token, d := range rm.detached {
+		if d.user.UserID == userID && d.user.SpaceID == spaceID && d.timer.Stop() {
+			delete(rm.detached, token)
+			detached = append(detached, d.user)
+		}
+	}
+	rm.mu.Unlock()
+
+	for _, user := range users {
+		user.kicked.Store(true)
+		user.fail(code, message, "")
+	}
+	// Disconnected users waiting to resume go right away
+	for _, user := range detached {
+		user.Destroy()
+	}
+}
@@ -0,0 +1,58 @@
+package websocket
+
+import (
+	"testing"
+
+	"github.com/genosis18m/Metaverse_go/internal/database"
+	"github.com/genosis18m/Metaverse_go/internal/models"
+)
+
+func TestModerationRequiresHigherRole(t *testing.T) {
+	withTestDB(t)
+	creator, owner, coOwner, editor := createTestAccount(t), createTestAccount(t), createTestAccount(t), createTestAccount(t)
+	space := createTestSpace(t, creator.ID)
+	addTestMember(t, space.ID, owner.ID, models.SpaceRoleOwner)
+	addTestMember(t, space.ID, coOwner.ID, models.SpaceRoleOwner)
+	addTestMember(t, space.ID, editor.ID, models.SpaceRoleEditor)
+
+	rm := GetRoomManager()
+	users := make(map[string]*User)
+	for i, account := range []models.User{creator, owner, coOwner, editor} {
+		u := joinTestRoom(t, rm, space.ID, account.ID, i, 0)
+		u.spaceOwnerID = creator.ID
+		users[account.ID] = u
+	}
+	moderator := users[owner.ID]
+
+	for _, target := range []string{creator.ID, coOwner.ID} {
+		moderator.handleMute(MuteRequest{UserID: target})
+		if got := lastError(t, moderator); got.Code != ErrForbidden || got.RequestType != TypeMute {
+			t.Fatalf("muting %s: error = %+v, want forbidden", target, got)
+		}
+		moderator.handleKick(KickRequest{UserID: target})
+		if got := lastError(t, moderator); got.Code != ErrForbidden || got.RequestType != TypeKick {
+			t.Fatalf("kicking %s: error = %+v, want forbidden", target, got)
+		}
+		if users[target].kicked.Load() {
+			t.Fatalf("%s was kicked by a user without a higher role", target)
+		}
+	}
+	if muted, err := database.IsMuted(space.ID, creator.ID); err != nil || muted {
+		t.Fatalf("the creator is muted: %t (err %v)", muted, err)
+	}
+
+	// Equal roles cannot moderate each other, even when one of them created the space
+	users[creator.ID].handleMute(MuteRequest{UserID: owner.ID})
+	if got := lastError(t, users[creator.ID]); got.Code != ErrForbidden {
+		t.Fatalf("creator muting an owner: error = %+v, want forbidden", got)
+	}
+
+	moderator.handleMute(MuteRequest{UserID: editor.ID})
+	events := sentOfType(moderator, TypeUserMuted)
+	if len(events) != 1 || events[0].Payload.(ModerationPayload).UserID != editor.ID {
+		t.Fatalf("muting the editor broadcast %v, want user-muted", events)
+	}
+	if muted, err := database.IsMuted(space.ID, editor.ID); err != nil || !muted {
+		t.Fatalf("the editor is not muted: %t (err %v)", muted, err)
+	}
+}
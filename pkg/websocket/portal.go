@@ -0,0 +1,77 @@
+package websocket
+
+import (
+	"log"
+
+	"github.com/genosis18m/Metaverse_go/internal/database"
+	"github.com/genosis18m/Metaverse_go/internal/models"
+)
+
+// teleport moves the user through a portal into its target space, or rejects
+// the move when the user may not enter the target space or it has no free
+// tile. It returns false when the portal leads nowhere, in which case the
+// portal tile behaves like any other tile.
+func (u *User) teleport(portal *models.SpacePortal) bool {
+	var space models.Space
+	if err := database.GetDB().First(&space, "id = ?", portal.TargetSpaceID).Error; err != nil {
+		log.Printf("Portal %s leads to a missing space: %v", portal.ID, err)
+		return false
+	}
+	if portal.TargetX < 0 || portal.TargetX >= space.Width || portal.TargetY < 0 || portal.TargetY >= space.Height {
+		log.Printf("Portal %s leads outside of space %s", portal.ID, space.ID)
+		return false
+	}
+
+	if !database.CanAccessSpace(space, u.UserID) {
+		u.sendError(ErrForbidden, "you do not have access to the target space", TypeMove)
+		u.Send(OutgoingMessage{
+			Type:    TypeMovementRejected,
+			Payload: MovementPayload{UserID: u.UserID, X: u.X, Y: u.Y},
+		})
+		return true
+	}
+	if kicked, err := database.IsKicked(space.ID, u.UserID); err != nil {
+		log.Printf("Error checking kick: %v", err)
+	} else if kicked {
+		u.sendError(ErrKicked, "you were removed from the target space", TypeMove)
+		u.Send(OutgoingMessage{
+			Type:    TypeMovementRejected,
+			Payload: MovementPayload{UserID: u.UserID, X: u.X, Y: u.Y},
+		})
+		return true
+	}
+
+	rm := GetRoomManager()
+	rm.EnsureGrid(space.ID, space.Width, space.Height)
+	rm.EnsureZones(space.ID)
+	// Arrive on the free tile closest to the portal's target
+	x, y, ok := rm.FreeTileNear(space.ID, portal.TargetX, portal.TargetY, space.Width, space.Height)
+	if !ok {
+		u.sendError(ErrZoneFull, "there is no room in the target space", TypeMove)
+		u.Send(OutgoingMessage{
+			Type:    TypeMovementRejected,
+			Payload: MovementPayload{UserID: u.UserID, X: u.X, Y: u.Y},
+		})
+		return true
+	}
+
+	// Leave the old room
+	u.rememberPosition()
+	u.leaveZone()
+	rm.Broadcast(OutgoingMessage{
+		Type:    TypeUserLeft,
+		Payload: UserLeftPayload{UserID: u.UserID},
+	}, u, u.SpaceID)
+	rm.ClearProximity(u)
+
+	from := u.SpaceID
+	u.SpaceWidth = space.Width
+	u.SpaceHeight = space.Height
+	u.spaceOwnerID = space.CreatorID
+	u.forgetPositions = space.ForgetPositions
+	rm.Transfer(u, space.ID, x, y)
+	log.Printf("User %s took portal %s from space %s to %s", u.UserID, portal.ID, from, space.ID)
+
+	u.announceJoin()
+	return true
+}
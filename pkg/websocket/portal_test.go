@@ -0,0 +1,103 @@
+package websocket
+
+import (
+	"testing"
+	"time"
+
+	"github.com/genosis18m/Metaverse_go/internal/database"
+	"github.com/genosis18m/Metaverse_go/internal/models"
+	"github.com/genosis18m/Metaverse_go/internal/utils"
+)
+
+// createTestPortal stores a portal and loads the grid of its room
+func createTestPortal(t *testing.T, rm *RoomManager, spaceID string, x, y int, targetSpaceID string, targetX, targetY int) models.SpacePortal {
+	t.Helper()
+	portal := models.SpacePortal{ID: utils.GenerateCUID(), SpaceID: spaceID, X: x, Y: y, TargetSpaceID: targetSpaceID, TargetX: targetX, TargetY: targetY}
+	if err := database.DB.Create(&portal).Error; err != nil {
+		t.Fatal(err)
+	}
+	rm.EnsureGrid(spaceID, 100, 100)
+	return portal
+}
+
+// addTestMember gives a user a role in a space
+func addTestMember(t *testing.T, spaceID, userID string, role models.SpaceRole) {
+	t.Helper()
+	member := models.SpaceMember{SpaceID: spaceID, UserID: userID, Role: role, CreatedAt: time.Now()}
+	if err := database.DB.Create(&member).Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+// rejectedWith checks that a move was rejected with an error code and left the user in place
+func rejectedWith(t *testing.T, u *User, code ErrorCode, spaceID string, x, y int) {
+	t.Helper()
+	if got := lastError(t, u); got.Code != code || got.RequestType != TypeMove {
+		t.Fatalf("error = %+v, want %s", got, code)
+	}
+	if u.SpaceID != spaceID || u.X != x || u.Y != y {
+		t.Fatalf("user moved to (%d,%d) in %s", u.X, u.Y, u.SpaceID)
+	}
+}
+
+func TestPortalChecksAccessAndKicks(t *testing.T) {
+	withTestDB(t)
+	travellerAccount, ownerAccount := createTestAccount(t), createTestAccount(t)
+	source := createTestSpace(t, ownerAccount.ID)
+	target := createTestSpace(t, ownerAccount.ID)
+	if err := database.DB.Model(&target).Update("visibility", models.SpaceVisibilityPrivate).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	rm := GetRoomManager()
+	traveller := joinTestRoom(t, rm, source.ID, travellerAccount.ID, 4, 5)
+	t.Cleanup(func() { rm.RemoveUser(traveller, target.ID) })
+	createTestPortal(t, rm, source.ID, 5, 5, target.ID, 10, 10)
+
+	// A private space needs a membership
+	moveTo(traveller, 5, 5)
+	rejectedWith(t, traveller, ErrForbidden, source.ID, 4, 5)
+
+	// Members who were kicked stay out until the kick expires
+	addTestMember(t, target.ID, travellerAccount.ID, models.SpaceRoleMember)
+	kick := models.SpaceKick{SpaceID: target.ID, UserID: travellerAccount.ID, KickedByID: ownerAccount.ID, Until: time.Now().Add(time.Hour)}
+	if err := database.DB.Create(&kick).Error; err != nil {
+		t.Fatal(err)
+	}
+	moveTo(traveller, 5, 5)
+	rejectedWith(t, traveller, ErrKicked, source.ID, 4, 5)
+
+	if err := database.DB.Model(&kick).Update("until", time.Now().Add(-time.Second)).Error; err != nil {
+		t.Fatal(err)
+	}
+	moveTo(traveller, 5, 5)
+	if traveller.SpaceID != target.ID || traveller.X != 10 || traveller.Y != 10 {
+		t.Fatalf("traveller is at (%d,%d) in %s, want (10,10) in the target space", traveller.X, traveller.Y, traveller.SpaceID)
+	}
+	if joined := sentOfType(traveller, TypeSpaceJoined); len(joined) != 1 || joined[0].Payload.(SpaceJoinedPayload).SpaceID != target.ID {
+		t.Fatalf("traveller got %v, want space-joined for the target space", joined)
+	}
+	if rm.FindUser(source.ID, travellerAccount.ID) != nil {
+		t.Fatal("the traveller is still in the source room")
+	}
+}
+
+func TestPortalTellsTheOldRoom(t *testing.T) {
+	withTestDB(t)
+	travellerAccount, watcherAccount := createTestAccount(t), createTestAccount(t)
+	source := createTestSpace(t, watcherAccount.ID)
+	target := createTestSpace(t, watcherAccount.ID)
+
+	rm := GetRoomManager()
+	traveller := joinTestRoom(t, rm, source.ID, travellerAccount.ID, 4, 5)
+	watcher := joinTestRoom(t, rm, source.ID, watcherAccount.ID, 0, 0)
+	t.Cleanup(func() { rm.RemoveUser(traveller, target.ID) })
+	createTestPortal(t, rm, source.ID, 5, 5, target.ID, 0, 0)
+	sent(watcher)
+
+	moveTo(traveller, 5, 5)
+	left := sentOfType(watcher, TypeUserLeft)
+	if len(left) != 1 || left[0].Payload.(UserLeftPayload).UserID != travellerAccount.ID {
+		t.Fatalf("the old room got %v, want user-left for the traveller", left)
+	}
+}
@@ -0,0 +1,131 @@
+package websocket
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/genosis18m/Metaverse_go/internal/database"
+	"github.com/genosis18m/Metaverse_go/internal/models"
+	"gorm.io/gorm/clause"
+)
+
+// PositionFlushInterval is how often remembered positions are written to the database
+var PositionFlushInterval = 5 * time.Second
+
+// positionKey identifies the position of a user in a space
+type positionKey struct {
+	userID  string
+	spaceID string
+}
+
+// positionStore buffers the last positions of users who left a space and
+// writes them in batches
+type positionStore struct {
+	mu      sync.Mutex
+	pending map[positionKey]models.UserSpacePosition
+	once    sync.Once
+}
+
+var positions = &positionStore{pending: make(map[positionKey]models.UserSpacePosition)}
+
+// Remember queues the position of a user in a space for the next flush
+func (s *positionStore) Remember(userID, spaceID string, x, y int) {
+	s.once.Do(func() { go s.flushLoop() })
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pending[positionKey{userID, spaceID}] = models.UserSpacePosition{
+		UserID:    userID,
+		SpaceID:   spaceID,
+		X:         x,
+		Y:         y,
+		UpdatedAt: time.Now(),
+	}
+}
+
+// Lookup returns the last known position of a user in a space, checking the
+// positions not flushed yet before the database
+func (s *positionStore) Lookup(userID, spaceID string) (int, int, bool) {
+	s.mu.Lock()
+	pos, pending := s.pending[positionKey{userID, spaceID}]
+	s.mu.Unlock()
+	if pending {
+		return pos.X, pos.Y, true
+	}
+
+	err := database.GetDB().First(&pos, "user_id = ? AND space_id = ?", userID, spaceID).Error
+	if err != nil {
+		return 0, 0, false
+	}
+	return pos.X, pos.Y, true
+}
+
+// Flush writes the buffered positions in one statement
+func (s *positionStore) Flush() {
+	s.mu.Lock()
+	if len(s.pending) == 0 {
+		s.mu.Unlock()
+		return
+	}
+	batch := make([]models.UserSpacePosition, 0, len(s.pending))
+	for _, pos := range s.pending {
+		batch = append(batch, pos)
+	}
+	s.pending = make(map[positionKey]models.UserSpacePosition)
+	s.mu.Unlock()
+
+	err := database.GetDB().Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "space_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"x", "y", "updated_at"}),
+	}).Create(&batch).Error
+	if err != nil {
+		log.Printf("Error saving %d user positions: %v", len(batch), err)
+	}
+}
+
+func (s *positionStore) flushLoop() {
+	ticker := time.NewTicker(PositionFlushInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		s.Flush()
+	}
+}
+
+// FlushPositions remembers where every connected user stands and writes all
+// pending positions, for use on shutdown
+func FlushPositions() {
+	rm := GetRoomManager()
+	rm.mu.RLock()
+	for _, users := range rm.rooms {
+		for _, user := range users {
+			user.rememberPosition()
+		}
+	}
+	rm.mu.RUnlock()
+
+	positions.Flush()
+}
+
+// rememberPosition queues where the user stands unless its space opted out
+func (u *User) rememberPosition() {
+	if u.forgetPositions || u.SpaceID == "" {
+		return
+	}
+	positions.Remember(u.UserID, u.SpaceID, u.X, u.Y)
+}
+
+// lastPosition returns where the user last stood in a space if it can stand there again
+func (u *User) lastPosition(space models.Space) (int, int, bool) {
+	if space.ForgetPositions {
+		return 0, 0, false
+	}
+	x, y, ok := positions.Lookup(u.UserID, space.ID)
+	if !ok || x < 0 || x >= space.Width || y < 0 || y >= space.Height {
+		return 0, 0, false
+	}
+	if !GetRoomManager().isFreeTile(space.ID, x, y) {
+		return 0, 0, false
+	}
+	return x, y, true
+}
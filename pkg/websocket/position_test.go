@@ -0,0 +1,95 @@
+package websocket
+
+import (
+	"testing"
+
+	"github.com/genosis18m/Metaverse_go/internal/models"
+)
+
+// withTestPositions swaps the position store for an empty one whose flush
+// loop never runs
+func withTestPositions(t *testing.T) *positionStore {
+	t.Helper()
+	store := &positionStore{pending: make(map[positionKey]models.UserSpacePosition)}
+	store.once.Do(func() {})
+
+	saved := positions
+	positions = store
+	t.Cleanup(func() { positions = saved })
+	return store
+}
+
+func TestRememberedPositionIsRestored(t *testing.T) {
+	withTestPositions(t)
+	space := models.Space{ID: "position-" + t.Name(), Width: 20, Height: 20}
+	u, _ := newTestUser(t, "")
+	u.UserID, u.SpaceID, u.X, u.Y = "alice", space.ID, 7, 3
+
+	u.rememberPosition()
+	if x, y, ok := u.lastPosition(space); !ok || x != 7 || y != 3 {
+		t.Fatalf("last position = (%d,%d) %t, want (7,3)", x, y, ok)
+	}
+}
+
+func TestLastPositionMustStillBeUsable(t *testing.T) {
+	withTestPositions(t)
+	rm := GetRoomManager()
+	space := models.Space{ID: "position-" + t.Name(), Width: 20, Height: 20}
+	u, _ := newTestUser(t, "")
+	u.UserID, u.SpaceID, u.X, u.Y = "alice", space.ID, 15, 15
+	u.rememberPosition()
+
+	// The space shrank since the user left
+	if _, _, ok := u.lastPosition(models.Space{ID: space.ID, Width: 10, Height: 10}); ok {
+		t.Fatal("a position outside the space was restored")
+	}
+
+	// Someone else stands there now
+	joinTestRoom(t, rm, space.ID, "bob", 15, 15)
+	if _, _, ok := u.lastPosition(space); ok {
+		t.Fatal("an occupied position was restored")
+	}
+
+	space.ForgetPositions = true
+	if _, _, ok := u.lastPosition(space); ok {
+		t.Fatal("a position was restored in a space that forgets positions")
+	}
+}
+
+func TestForgetPositionsIsNotRemembered(t *testing.T) {
+	store := withTestPositions(t)
+	u, _ := newTestUser(t, "")
+	u.UserID, u.SpaceID, u.forgetPositions = "alice", "space-1", true
+
+	u.rememberPosition()
+	if len(store.pending) != 0 {
+		t.Fatalf("a space that forgets positions queued %v", store.pending)
+	}
+}
+
+func TestFlushSavesAndUpdatesPositions(t *testing.T) {
+	withTestDB(t)
+	store := withTestPositions(t)
+	account := createTestAccount(t)
+	space := createTestSpace(t, account.ID)
+	other := createTestSpace(t, account.ID)
+
+	store.Remember(account.ID, space.ID, 4, 6)
+	store.Flush()
+	if len(store.pending) != 0 {
+		t.Fatalf("positions still pending after a flush: %v", store.pending)
+	}
+	if x, y, ok := store.Lookup(account.ID, space.ID); !ok || x != 4 || y != 6 {
+		t.Fatalf("saved position = (%d,%d) %t, want (4,6)", x, y, ok)
+	}
+	if _, _, ok := store.Lookup(account.ID, other.ID); ok {
+		t.Fatal("a position was found in a space the user never visited")
+	}
+
+	// A later position replaces the saved one
+	store.Remember(account.ID, space.ID, 9, 1)
+	store.Flush()
+	if x, y, ok := store.Lookup(account.ID, space.ID); !ok || x != 9 || y != 1 {
+		t.Fatalf("updated position = (%d,%d) %t, want (9,1)", x, y, ok)
+	}
+}
@@ -0,0 +1,283 @@
+package websocket
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/genosis18m/Metaverse_go/internal/database"
+	"github.com/genosis18m/Metaverse_go/internal/models"
+)
+
+// ProtocolVersion is the WebSocket protocol version spoken by this server.
+// Clients send it in the join payload; a missing version means version 1.
+const ProtocolVersion = 1
+
+// ErrorCode is a machine-readable reason carried by error messages
+type ErrorCode string
+
+const (
+	ErrInvalidMessage     ErrorCode = "invalid_message"
+	ErrUnknownType        ErrorCode = "unknown_type"
+	ErrInvalidPayload     ErrorCode = "invalid_payload"
+	ErrUnsupportedVersion ErrorCode = "unsupported_version"
+	ErrInvalidToken       ErrorCode = "invalid_token"
+	ErrUserNotFound       ErrorCode = "user_not_found"
+	ErrSpaceNotFound      ErrorCode = "space_not_found"
+	ErrNotJoined          ErrorCode = "not_joined"
+	ErrAlreadyJoined      ErrorCode = "already_joined"
+	ErrTargetNotFound     ErrorCode = "target_not_found"
+	ErrRateLimited        ErrorCode = "rate_limited"
+	ErrInternal           ErrorCode = "internal_error"
+	ErrMessageRejected    ErrorCode = "message_rejected"
+	ErrMessageNotFound    ErrorCode = "message_not_found"
+	ErrForbidden          ErrorCode = "forbidden"
+	ErrMuted              ErrorCode = "muted"
+	ErrKicked             ErrorCode = "kicked"
+	ErrZoneFull           ErrorCode = "zone_full"
+	ErrSuspended          ErrorCode = "suspended"
+)
+
+// ErrorPayload represents an error reply to a client message
+type ErrorPayload struct {
+	Code        ErrorCode   `json:"code"`
+	Message     string      `json:"message"`
+	RequestType MessageType `json:"requestType,omitempty"`
+}
+
+// validator is implemented by every incoming payload type
+type validator interface {
+	Validate() error
+}
+
+// JoinRequest is the payload of a join message
+type JoinRequest struct {
+	Version     int    `json:"version,omitempty"`
+	SpaceID     string `json:"spaceId"`
+	Token       string `json:"token"`
+	DisplayName string `json:"displayName,omitempty"`
+	ResumeToken string `json:"resumeToken,omitempty"`
+	Snapshots   bool   `json:"snapshots,omitempty"`
+}
+
+// Validate checks the required join fields
+func (r *JoinRequest) Validate() error {
+	if r.SpaceID == "" {
+		return errors.New("spaceId is required")
+	}
+	if r.Token == "" {
+		return errors.New("token is required")
+	}
+	if len(r.DisplayName) > 50 {
+		return errors.New("displayName must be at most 50 characters")
+	}
+	return nil
+}
+
+// MoveRequest is the payload of a move message
+type MoveRequest struct {
+	X *int `json:"x"`
+	Y *int `json:"y"`
+}
+
+// Validate checks that both coordinates are present
+func (r *MoveRequest) Validate() error {
+	if r.X == nil || r.Y == nil {
+		return errors.New("x and y are required")
+	}
+	return nil
+}
+
+// ChatRequest is the payload of a chat message. Scope defaults to room.
+type ChatRequest struct {
+	Message string           `json:"message"`
+	Scope   models.ChatScope `json:"scope,omitempty"`
+}
+
+// Validate checks that the message is not empty and the scope is known
+func (r *ChatRequest) Validate() error {
+	if r.Message == "" {
+		return errors.New("message is required")
+	}
+	switch r.Scope {
+	case "":
+		r.Scope = models.ChatScopeRoom
+	case models.ChatScopeRoom, models.ChatScopeNearby, models.ChatScopeZone:
+	default:
+		return fmt.Errorf("unknown chat scope %q", r.Scope)
+	}
+	return nil
+}
+
+// ChatHistoryRequest is the payload of a chat-history message
+type ChatHistoryRequest struct {
+	Before string `json:"before,omitempty"`
+	After  string `json:"after,omitempty"`
+	Query  string `json:"query,omitempty"`
+	Limit  int    `json:"limit,omitempty"`
+}
+
+// Validate checks the cursor and page size
+func (r *ChatHistoryRequest) Validate() error {
+	if r.Before != "" && r.After != "" {
+		return errors.New("use either before or after")
+	}
+	if r.Limit < 0 || r.Limit > database.MaxMessageLimit {
+		return fmt.Errorf("limit must be at most %d, or 0 for the default of %d", database.MaxMessageLimit, database.DefaultMessageLimit)
+	}
+	return nil
+}
+
+// ChatEditRequest is the payload of a chat-edit message
+type ChatEditRequest struct {
+	MessageID string `json:"messageId"`
+	Message   string `json:"message"`
+}
+
+// Validate checks that the edit names a message and has a body
+func (r *ChatEditRequest) Validate() error {
+	if r.MessageID == "" {
+		return errors.New("messageId is required")
+	}
+	if r.Message == "" {
+		return errors.New("message is required")
+	}
+	return nil
+}
+
+// ChatDeleteRequest is the payload of a chat-delete message
+type ChatDeleteRequest struct {
+	MessageID string `json:"messageId"`
+}
+
+// Validate checks that the request names a message
+func (r *ChatDeleteRequest) Validate() error {
+	if r.MessageID == "" {
+		return errors.New("messageId is required")
+	}
+	return nil
+}
+
+// MuteRequest is the payload of a mute or unmute message. Duration is in
+// seconds; zero mutes until the user is unmuted.
+type MuteRequest struct {
+	UserID   string `json:"userId"`
+	Duration int    `json:"duration,omitempty"`
+}
+
+// Validate checks that the request names a user
+func (r *MuteRequest) Validate() error {
+	if r.UserID == "" {
+		return errors.New("userId is required")
+	}
+	if r.Duration < 0 {
+		return errors.New("duration must not be negative")
+	}
+	return nil
+}
+
+// KickRequest is the payload of a kick message. Duration is in seconds; zero
+// keeps the user out for KickDuration.
+type KickRequest struct {
+	UserID   string `json:"userId"`
+	Duration int    `json:"duration,omitempty"`
+}
+
+// Validate checks that the request names a user
+func (r *KickRequest) Validate() error {
+	if r.UserID == "" {
+		return errors.New("userId is required")
+	}
+	if r.Duration < 0 {
+		return errors.New("duration must not be negative")
+	}
+	return nil
+}
+
+// DirectMessageRequest is the payload of a dm message
+type DirectMessageRequest struct {
+	TargetUserID string `json:"targetUserId"`
+	Message      string `json:"message"`
+}
+
+// Validate checks that the message has a target and a body
+func (r *DirectMessageRequest) Validate() error {
+	if r.TargetUserID == "" {
+		return errors.New("targetUserId is required")
+	}
+	if r.Message == "" {
+		return errors.New("message is required")
+	}
+	return nil
+}
+
+// DirectMessageReadRequest is the payload of a dm-read message. It marks the
+// messages from UserID up to and including MessageID as read.
+type DirectMessageReadRequest struct {
+	UserID    string `json:"userId"`
+	MessageID string `json:"messageId"`
+}
+
+// Validate checks that the receipt names a sender and a message
+func (r *DirectMessageReadRequest) Validate() error {
+	if r.UserID == "" {
+		return errors.New("userId is required")
+	}
+	if r.MessageID == "" {
+		return errors.New("messageId is required")
+	}
+	return nil
+}
+
+// SignalRequest is the payload of a WebRTC offer, answer or ICE candidate
+type SignalRequest struct {
+	TargetUserID string        `json:"targetUserId"`
+	SDP          string        `json:"sdp,omitempty"`
+	Candidate    *ICECandidate `json:"candidate,omitempty"`
+}
+
+// Validate checks that the signal has a target and a body
+func (r *SignalRequest) Validate() error {
+	if r.TargetUserID == "" {
+		return errors.New("targetUserId is required")
+	}
+	if r.SDP == "" && r.Candidate == nil {
+		return errors.New("sdp or candidate is required")
+	}
+	return nil
+}
+
+// decodePayload parses and validates the payload of a message, replying
+// with an invalid_payload error when it does not match its type
+func (u *User) decodePayload(msg IncomingMessage, payload validator) bool {
+	if len(msg.Payload) == 0 {
+		u.sendError(ErrInvalidPayload, "payload is required", msg.Type)
+		return false
+	}
+	if err := u.codec.Unmarshal(msg.Payload, payload); err != nil {
+		u.sendError(ErrInvalidPayload, fmt.Sprintf("invalid %s payload", msg.Type), msg.Type)
+		return false
+	}
+	if err := payload.Validate(); err != nil {
+		u.sendError(ErrInvalidPayload, err.Error(), msg.Type)
+		return false
+	}
+	return true
+}
+
+// sendError replies to the client with a typed error
+func (u *User) sendError(code ErrorCode, message string, requestType MessageType) {
+	u.Send(OutgoingMessage{
+		Type: TypeError,
+		Payload: ErrorPayload{
+			Code:        code,
+			Message:     message,
+			RequestType: requestType,
+		},
+	})
+}
+
+// fail replies with an error and closes the connection once it was sent
+func (u *User) fail(code ErrorCode, message string, requestType MessageType) {
+	u.sendError(code, message, requestType)
+	u.closeAfterFlush()
+}
@@ -0,0 +1,145 @@
+package websocket
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/genosis18m/Metaverse_go/internal/database"
+	"github.com/genosis18m/Metaverse_go/internal/models"
+	"github.com/gorilla/websocket"
+)
+
+// lastError drains the messages queued for a user and returns the last error reply
+func lastError(t *testing.T, u *User) ErrorPayload {
+	t.Helper()
+	errs := sentOfType(u, TypeError)
+	if len(errs) == 0 {
+		t.Fatal("no error reply was sent")
+	}
+	return errs[len(errs)-1].Payload.(ErrorPayload)
+}
+
+func TestProcessMessageRepliesWithTypedErrors(t *testing.T) {
+	cases := []struct {
+		name    string
+		joined  bool
+		msg     IncomingMessage
+		code    ErrorCode
+		request MessageType
+	}{
+		{"unknown type", true, IncomingMessage{Type: "teleport", Payload: RawPayload(`{}`)}, ErrUnknownType, "teleport"},
+		{"not joined", false, IncomingMessage{Type: TypeChat, Payload: RawPayload(`{"message":"hi"}`)}, ErrNotJoined, TypeChat},
+		{"missing payload", true, IncomingMessage{Type: TypeMove}, ErrInvalidPayload, TypeMove},
+		{"wrong field type", true, IncomingMessage{Type: TypeMove, Payload: RawPayload(`{"x":"left","y":1}`)}, ErrInvalidPayload, TypeMove},
+		{"failed validation", true, IncomingMessage{Type: TypeMove, Payload: RawPayload(`{"x":1}`)}, ErrInvalidPayload, TypeMove},
+		{"join without token", false, IncomingMessage{Type: TypeJoin, Payload: RawPayload(`{"spaceId":"space-1"}`)}, ErrInvalidPayload, TypeJoin},
+		{"join twice", true, IncomingMessage{Type: TypeJoin, Payload: RawPayload(`{"spaceId":"space-1","token":"t"}`)}, ErrAlreadyJoined, TypeJoin},
+		{"unsupported version", false, IncomingMessage{Type: TypeJoin, Payload: RawPayload(`{"version":99,"spaceId":"space-1","token":"t"}`)}, ErrUnsupportedVersion, TypeJoin},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			u, _ := newTestUser(t, "")
+			if c.joined {
+				u.SpaceID = "space-1"
+			}
+			u.processMessage(c.msg)
+
+			got := lastError(t, u)
+			if got.Code != c.code || got.RequestType != c.request || got.Message == "" {
+				t.Fatalf("error = %+v, want code %s for %s", got, c.code, c.request)
+			}
+		})
+	}
+}
+
+func TestUnsupportedVersionClosesConnection(t *testing.T) {
+	u, _ := newTestUser(t, "")
+	u.processMessage(IncomingMessage{Type: TypeJoin, Payload: RawPayload(`{"version":2,"spaceId":"space-1","token":"t"}`)})
+
+	u.queue.mu.Lock()
+	closing := u.queue.closing
+	u.queue.mu.Unlock()
+	if !closing {
+		t.Fatal("the connection is kept open after an unsupported version")
+	}
+}
+
+func TestUnparsableFrameGetsInvalidMessage(t *testing.T) {
+	u, client := newTestUser(t, "")
+	go u.HandleMessages()
+
+	if err := client.WriteMessage(websocket.TextMessage, []byte("not json")); err != nil {
+		t.Fatal(err)
+	}
+	client.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var msg struct {
+		Type    MessageType  `json:"type"`
+		Payload ErrorPayload `json:"payload"`
+	}
+	if err := client.ReadJSON(&msg); err != nil {
+		t.Fatal(err)
+	}
+	if msg.Type != TypeError || msg.Payload.Code != ErrInvalidMessage {
+		t.Fatalf("reply = %+v, want an invalid_message error", msg)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	cases := []struct {
+		name    string
+		payload validator
+		wantErr string
+	}{
+		{"join", &JoinRequest{SpaceID: "s", Token: "t"}, ""},
+		{"join without space", &JoinRequest{Token: "t"}, "spaceId"},
+		{"join without token", &JoinRequest{SpaceID: "s"}, "token"},
+		{"join with long name", &JoinRequest{SpaceID: "s", Token: "t", DisplayName: strings.Repeat("a", 51)}, "displayName"},
+		{"move", &MoveRequest{X: intPtr(0), Y: intPtr(0)}, ""},
+		{"move without y", &MoveRequest{X: intPtr(1)}, "x and y"},
+		{"chat", &ChatRequest{Message: "hi", Scope: models.ChatScopeZone}, ""},
+		{"empty chat", &ChatRequest{}, "message"},
+		{"chat with unknown scope", &ChatRequest{Message: "hi", Scope: "galaxy"}, "scope"},
+		{"history", &ChatHistoryRequest{Before: "m", Limit: database.MaxMessageLimit}, ""},
+		{"history with both cursors", &ChatHistoryRequest{Before: "a", After: "b"}, "either"},
+		{"history with default limit", &ChatHistoryRequest{}, ""},
+		{"history with large limit", &ChatHistoryRequest{Limit: database.MaxMessageLimit + 1}, fmt.Sprintf("limit must be at most %d", database.MaxMessageLimit)},
+		{"history with negative limit", &ChatHistoryRequest{Limit: -1}, "limit must be at most"},
+		{"edit", &ChatEditRequest{MessageID: "m", Message: "x"}, ""},
+		{"edit without message id", &ChatEditRequest{Message: "x"}, "messageId"},
+		{"edit without text", &ChatEditRequest{MessageID: "m"}, "message"},
+		{"delete without message id", &ChatDeleteRequest{}, "messageId"},
+		{"mute", &MuteRequest{UserID: "u", Duration: 60}, ""},
+		{"mute without user", &MuteRequest{}, "userId"},
+		{"mute with negative duration", &MuteRequest{UserID: "u", Duration: -1}, "duration"},
+		{"kick with negative duration", &KickRequest{UserID: "u", Duration: -1}, "duration"},
+		{"dm without target", &DirectMessageRequest{Message: "hi"}, "targetUserId"},
+		{"dm without text", &DirectMessageRequest{TargetUserID: "u"}, "message"},
+		{"dm-read without message", &DirectMessageReadRequest{UserID: "u"}, "messageId"},
+		{"signal with candidate", &SignalRequest{TargetUserID: "u", Candidate: &ICECandidate{Candidate: "c"}}, ""},
+		{"signal without target", &SignalRequest{SDP: "v=0"}, "targetUserId"},
+		{"empty signal", &SignalRequest{TargetUserID: "u"}, "sdp or candidate"},
+	}
+
+	for _, c := range cases {
+		err := c.payload.Validate()
+		switch {
+		case c.wantErr == "" && err != nil:
+			t.Errorf("%s: unexpected error %v", c.name, err)
+		case c.wantErr != "" && (err == nil || !strings.Contains(err.Error(), c.wantErr)):
+			t.Errorf("%s: error = %v, want one mentioning %q", c.name, err, c.wantErr)
+		}
+	}
+}
+
+func TestChatValidateDefaultsScopeToRoom(t *testing.T) {
+	req := ChatRequest{Message: "hi"}
+	if err := req.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if req.Scope != models.ChatScopeRoom {
+		t.Fatalf("scope = %q, want room", req.Scope)
+	}
+}
@@ -0,0 +1,126 @@
+package websocket
+
+// ProximityRadius is the Manhattan distance in tiles within which users can talk
+var ProximityRadius = 3
+
+// ChatRadius is the Manhattan distance in tiles that nearby chat reaches
+var ChatRadius = 5
+
+// proximityEvent is a pending proximity-enter/leave notification. The message
+// is built under the room lock, as it carries the position of another user.
+type proximityEvent struct {
+	to      *User
+	message OutgoingMessage
+}
+
+// newProximityEvent tells a user that another one entered or left its
+// proximity. The caller must hold the lock.
+func newProximityEvent(to *User, msgType MessageType, other *User) proximityEvent {
+	return proximityEvent{to: to, message: OutgoingMessage{
+		Type: msgType,
+		Payload: ProximityPayload{
+			UserID:   other.UserID,
+			Username: other.Username,
+			X:        other.X,
+			Y:        other.Y,
+		},
+	}}
+}
+
+// isNear reports whether two users are within the proximity radius
+func isNear(a, b *User) bool {
+	return abs(a.X-b.X)+abs(a.Y-b.Y) <= ProximityRadius
+}
+
+// UpdateProximity recomputes the neighbours of a user after it joined or moved
+// and notifies both sides of every pair that entered or left proximity
+func (rm *RoomManager) UpdateProximity(u *User) {
+	rm.mu.Lock()
+	// The room is gone once its last user left; do not bring its index back
+	ix, exists := rm.indexes[u.SpaceID]
+	if !exists {
+		rm.mu.Unlock()
+		return
+	}
+	events := make([]proximityEvent, 0)
+	ix.near(u.X, u.Y, ProximityRadius, func(other *User) {
+		if other.ID == u.ID || !isNear(u, other) {
+			return
+		}
+		if _, wasNear := u.nearby[other.ID]; wasNear {
+			return
+		}
+		u.nearby[other.ID] = other
+		other.nearby[u.ID] = u
+		events = append(events,
+			newProximityEvent(u, TypeProximityEnter, other),
+			newProximityEvent(other, TypeProximityEnter, u),
+		)
+	})
+	for id, other := range u.nearby {
+		if isNear(u, other) {
+			continue
+		}
+		delete(u.nearby, id)
+		delete(other.nearby, u.ID)
+		events = append(events,
+			newProximityEvent(u, TypeProximityLeave, other),
+			newProximityEvent(other, TypeProximityLeave, u),
+		)
+	}
+	rm.mu.Unlock()
+
+	sendProximityEvents(events)
+}
+
+// ClearProximity removes a leaving user from the neighbour sets of the room
+func (rm *RoomManager) ClearProximity(u *User) {
+	rm.mu.Lock()
+	events := make([]proximityEvent, 0, len(u.nearby))
+	for id, other := range u.nearby {
+		delete(other.nearby, u.ID)
+		delete(u.nearby, id)
+		events = append(events, newProximityEvent(other, TypeProximityLeave, u))
+	}
+	rm.mu.Unlock()
+
+	sendProximityEvents(events)
+}
+
+func sendProximityEvents(events []proximityEvent) {
+	for _, e := range events {
+		e.to.Send(e.message)
+	}
+}
+
+// UsersWithin returns the local and remote users of a room within a
+// Manhattan distance of a tile
+func (rm *RoomManager) UsersWithin(spaceID string, x, y, radius int) []*User {
+	rm.mu.RLock()
+	defer rm.mu.RUnlock()
+
+	users := make([]*User, 0)
+	ix, exists := rm.indexes[spaceID]
+	if !exists {
+		return users
+	}
+	ix.near(x, y, radius, func(other *User) {
+		if abs(other.X-x)+abs(other.Y-y) <= radius {
+			users = append(users, other)
+		}
+	})
+	return users
+}
+
+// FindUser returns the user with the given account ID in a room
+func (rm *RoomManager) FindUser(spaceID, userID string) *User {
+	rm.mu.RLock()
+	defer rm.mu.RUnlock()
+
+	for _, user := range rm.members(spaceID) {
+		if user.UserID == userID {
+			return user
+		}
+	}
+	return nil
+}
@@ -0,0 +1,208 @@
+package websocket
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/genosis18m/Metaverse_go/internal/models"
+	"github.com/genosis18m/Metaverse_go/internal/utils"
+	"github.com/gorilla/websocket"
+)
+
+// newTestRoomManager returns a room manager that is not the process-wide
+// singleton, with an in-memory backplane
+func newTestRoomManager() *RoomManager {
+	return &RoomManager{
+		rooms:        make(map[string][]*User),
+		grids:        make(map[string]*Grid),
+		zones:        make(map[string][]*models.SpaceZone),
+		remote:       make(map[string]map[string]*User),
+		nodeID:       "test-node",
+		backplane:    NewMemoryBackplane(),
+		subs:         make(map[string]func()),
+		detached:     make(map[string]*detachedUser),
+		tickers:      make(map[string]*roomTicker),
+		indexes:      make(map[string]*spatialIndex),
+		chatLimiters: make(map[string]*tokenBucket),
+		userLimiters: make(map[rateKey]*tokenBucket),
+		userSubs:     make(map[string]*userSubscription),
+		spawnCursors: make(map[string]int),
+	}
+}
+
+// sent drains the messages queued for a user whose writer is not running
+func sent(u *User) []OutgoingMessage {
+	messages := make([]OutgoingMessage, 0)
+	for {
+		select {
+		case msg := <-u.queue.messages:
+			messages = append(messages, msg)
+		default:
+			return messages
+		}
+	}
+}
+
+// sentOfType drains the messages queued for a user and keeps those of one type
+func sentOfType(u *User, msgType MessageType) []OutgoingMessage {
+	matching := make([]OutgoingMessage, 0)
+	for _, msg := range sent(u) {
+		if msg.Type == msgType {
+			matching = append(matching, msg)
+		}
+	}
+	return matching
+}
+
+// newTestUser returns a user on the server side of a real WebSocket
+// connection, along with the client side
+func newTestUser(t *testing.T, subprotocol string) (*User, *websocket.Conn) {
+	t.Helper()
+	conns := make(chan *websocket.Conn, 1)
+	upgrader := websocket.Upgrader{Subprotocols: Subprotocols()}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		conns <- conn
+	}))
+	t.Cleanup(srv.Close)
+
+	dialer := websocket.Dialer{}
+	if subprotocol != "" {
+		dialer.Subprotocols = []string{subprotocol}
+	}
+	client, _, err := dialer.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	user := NewUser(<-conns)
+	// Rate limits are kept per user ID, so every test gets its own
+	user.UserID = "user-" + utils.GenerateRandomString(8)
+	t.Cleanup(user.close)
+	return user, client
+}
+
+// joinTestRoom puts a test user at a position in a room of a room manager
+func joinTestRoom(t *testing.T, rm *RoomManager, spaceID, userID string, x, y int) *User {
+	t.Helper()
+	u, _ := newTestUser(t, "")
+	u.UserID = userID
+	u.Username = userID
+	u.SpaceID = spaceID
+	u.SpaceWidth, u.SpaceHeight = 100, 100
+	u.X, u.Y = x, y
+	rm.AddUser(spaceID, u)
+	t.Cleanup(func() { rm.RemoveUser(u, spaceID) })
+	return u
+}
+
+func TestUpdateProximityAnnouncesEnterAndLeave(t *testing.T) {
+	keepConfig(t)
+	ProximityRadius = 3
+	rm := newTestRoomManager()
+	alice := joinTestRoom(t, rm, "space-1", "alice", 10, 10)
+	bob := joinTestRoom(t, rm, "space-1", "bob", 20, 20)
+
+	rm.UpdateProximity(alice)
+	if got := sentOfType(alice, TypeProximityEnter); len(got) != 0 {
+		t.Fatalf("users 20 tiles apart got %d proximity-enter events", len(got))
+	}
+
+	rm.MoveUser(bob, 12, 11)
+	rm.UpdateProximity(bob)
+	for _, pair := range [][2]*User{{alice, bob}, {bob, alice}} {
+		events := sentOfType(pair[0], TypeProximityEnter)
+		if len(events) != 1 {
+			t.Fatalf("%s got %d proximity-enter events, want 1", pair[0].UserID, len(events))
+		}
+		payload := events[0].Payload.(ProximityPayload)
+		if payload.UserID != pair[1].UserID || payload.X != pair[1].X || payload.Y != pair[1].Y {
+			t.Fatalf("%s got %+v, want %s at its position", pair[0].UserID, payload, pair[1].UserID)
+		}
+	}
+
+	// Moving within the radius does not announce the pair again
+	rm.MoveUser(bob, 11, 11)
+	rm.UpdateProximity(bob)
+	if got := sentOfType(alice, TypeProximityEnter); len(got) != 0 {
+		t.Fatalf("a move within the radius announced the pair again: %v", got)
+	}
+
+	rm.MoveUser(alice, 1, 1)
+	rm.UpdateProximity(alice)
+	for _, pair := range [][2]*User{{alice, bob}, {bob, alice}} {
+		events := sentOfType(pair[0], TypeProximityLeave)
+		if len(events) != 1 || events[0].Payload.(ProximityPayload).UserID != pair[1].UserID {
+			t.Fatalf("%s got %v, want proximity-leave for %s", pair[0].UserID, events, pair[1].UserID)
+		}
+	}
+	if len(alice.nearby) != 0 || len(bob.nearby) != 0 {
+		t.Fatalf("neighbour sets not cleared: %v, %v", alice.nearby, bob.nearby)
+	}
+}
+
+func TestClearProximityTellsNeighbours(t *testing.T) {
+	keepConfig(t)
+	ProximityRadius = 3
+	rm := newTestRoomManager()
+	alice := joinTestRoom(t, rm, "space-1", "alice", 10, 10)
+	bob := joinTestRoom(t, rm, "space-1", "bob", 11, 10)
+	rm.UpdateProximity(alice)
+	sent(bob)
+
+	rm.ClearProximity(alice)
+	events := sentOfType(bob, TypeProximityLeave)
+	if len(events) != 1 || events[0].Payload.(ProximityPayload).UserID != "alice" {
+		t.Fatalf("bob got %v, want proximity-leave for alice", events)
+	}
+	if _, near := bob.nearby[alice.ID]; near {
+		t.Fatal("alice is still in bob's neighbour set")
+	}
+}
+
+func TestSignalIsRelayedToTarget(t *testing.T) {
+	rm := GetRoomManager()
+	spaceID := "rtc-" + t.Name()
+	alice := joinTestRoom(t, rm, spaceID, "alice", 1, 1)
+	bob := joinTestRoom(t, rm, spaceID, "bob", 50, 50)
+	carol := joinTestRoom(t, rm, spaceID, "carol", 2, 2)
+
+	alice.handleSignal(TypeRTCOffer, SignalRequest{TargetUserID: "bob", SDP: "v=0"})
+
+	offers := sentOfType(bob, TypeRTCOffer)
+	if len(offers) != 1 {
+		t.Fatalf("bob got %d offers, want 1", len(offers))
+	}
+	if payload := offers[0].Payload.(RTCSignalPayload); payload.FromUserID != "alice" || payload.SDP != "v=0" {
+		t.Fatalf("relayed offer = %+v", payload)
+	}
+	if got := sentOfType(carol, TypeRTCOffer); len(got) != 0 {
+		t.Fatalf("the offer also reached carol: %v", got)
+	}
+
+	candidate := &ICECandidate{Candidate: "candidate:1 1 udp 1 10.0.0.1 9 typ host", SDPMLineIndex: intPtr(0)}
+	bob.handleSignal(TypeRTCIceCandidate, SignalRequest{TargetUserID: "alice", Candidate: candidate})
+	candidates := sentOfType(alice, TypeRTCIceCandidate)
+	if len(candidates) != 1 || candidates[0].Payload.(RTCSignalPayload).Candidate != candidate {
+		t.Fatalf("alice got %v, want the candidate from bob", candidates)
+	}
+}
+
+func TestSignalToUnknownTargetIsRejected(t *testing.T) {
+	rm := GetRoomManager()
+	alice := joinTestRoom(t, rm, "rtc-"+t.Name(), "alice", 1, 1)
+
+	alice.handleSignal(TypeRTCAnswer, SignalRequest{TargetUserID: "nobody", SDP: "v=0"})
+
+	errs := sentOfType(alice, TypeError)
+	if len(errs) != 1 || errs[0].Payload.(ErrorPayload).Code != ErrTargetNotFound {
+		t.Fatalf("sender got %v, want a target_not_found error", errs)
+	}
+}
@@ -0,0 +1,221 @@
+package websocket
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// RateLimit is a sustained rate in messages per second with a burst allowance
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+// Rate limits, configurable through the environment
+var (
+	// MessageRateLimits are applied per user and message type
+	MessageRateLimits = messageRateLimits()
+
+	// RoomChatRateLimit is shared by everyone chatting in a room
+	RoomChatRateLimit = RateLimit{Rate: 20, Burst: 40}
+
+	// OtherRateLimit is applied per user to the messages without a limit of
+	// their own: joins, unknown types and unparsable frames
+	OtherRateLimit = RateLimit{Rate: 1, Burst: 5}
+
+	// RateViolationLimit is how many over-limit messages a user may send,
+	// replenished at one per second, before being disconnected
+	RateViolationLimit = 30
+)
+
+// messageRateLimits builds the per-message limits from WS_RATE_<NAME> and
+// WS_BURST_<NAME>, falling back to the defaults
+func messageRateLimits() map[MessageType]RateLimit {
+	return map[MessageType]RateLimit{
+		TypeMove:              envRateLimit("MOVE", 20, 40),
+		TypeChat:              envRateLimit("CHAT", 1, 5),
+		TypeChatHistory:       envRateLimit("HISTORY", 2, 5),
+		TypeChatEdit:          envRateLimit("CHAT", 1, 5),
+		TypeChatDelete:        envRateLimit("CHAT", 1, 5),
+		TypeMute:              envRateLimit("MODERATION", 1, 10),
+		TypeUnmute:            envRateLimit("MODERATION", 1, 10),
+		TypeKick:              envRateLimit("MODERATION", 1, 10),
+		TypeDirectMessage:     envRateLimit("DM", 1, 5),
+		TypeDirectMessageRead: envRateLimit("DM_READ", 5, 20),
+		TypeRTCOffer:          envRateLimit("SIGNAL", 50, 100),
+		TypeRTCAnswer:         envRateLimit("SIGNAL", 50, 100),
+		TypeRTCIceCandidate:   envRateLimit("SIGNAL", 50, 100),
+	}
+}
+
+// envRateLimit reads WS_RATE_<NAME> and WS_BURST_<NAME> from the environment
+func envRateLimit(name string, rate float64, burst int) RateLimit {
+	return RateLimit{
+		Rate:  envFloat("WS_RATE_"+name, rate),
+		Burst: envInt("WS_BURST_"+name, burst),
+	}
+}
+
+// Buckets of a user that are not tied to a message type
+const (
+	otherBucket      MessageType = "#other"
+	violationsBucket MessageType = "#violations"
+)
+
+// rateKey identifies a token bucket of a user
+type rateKey struct {
+	userID string
+	bucket MessageType
+}
+
+// tokenBucket allows Burst events at once and refills at Rate per second
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(limit RateLimit) *tokenBucket {
+	return &tokenBucket{
+		rate:   limit.Rate,
+		burst:  float64(limit.Burst),
+		tokens: float64(limit.Burst),
+		last:   time.Now(),
+	}
+}
+
+// Allow takes a token if one is available
+func (b *tokenBucket) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// Full reports whether the bucket refilled up to its burst, so that a new
+// bucket would behave the same
+func (b *tokenBucket) Full() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.tokens+time.Since(b.last).Seconds()*b.rate >= b.burst
+}
+
+// allow checks the limit of a message type, or the catch-all limit for types
+// without one, and answers over-limit messages with a rate_limited error.
+// Users who keep sending past their limit are disconnected.
+func (u *User) allow(msgType MessageType) bool {
+	message := fmt.Sprintf("too many %s messages", msgType)
+	bucket := msgType
+	limit, limited := MessageRateLimits[msgType]
+	if !limited || limit.Rate <= 0 {
+		bucket, limit = otherBucket, OtherRateLimit
+		message = "too many messages"
+	}
+	if GetRoomManager().allowRate(u.rateID(), bucket, limit) {
+		return true
+	}
+	u.rateLimited(msgType, message)
+	return false
+}
+
+// allowInvalid counts a message that could not be handled, such as an
+// unknown type or an unparsable frame, as a violation and charges it to the
+// catch-all limit. It returns false when no error reply should follow.
+func (u *User) allowInvalid(msgType MessageType) bool {
+	if !u.violate(msgType) {
+		return false
+	}
+	return u.allow(msgType)
+}
+
+// rateLimited replies to an over-limit message and counts the violation
+func (u *User) rateLimited(msgType MessageType, message string) {
+	if u.violate(msgType) {
+		u.sendError(ErrRateLimited, message, msgType)
+	}
+}
+
+// violate counts a violation, disconnecting the client once it used up its
+// budget. It returns false when the client was disconnected.
+func (u *User) violate(msgType MessageType) bool {
+	if GetRoomManager().allowRate(u.rateID(), violationsBucket, RateLimit{Rate: 1, Burst: RateViolationLimit}) {
+		return true
+	}
+	log.Printf("Disconnecting user %s for exceeding rate limits", u.UserID)
+	u.fail(ErrRateLimited, "rate limits exceeded repeatedly", msgType)
+	return false
+}
+
+// rateID identifies the user whose limits a connection uses. Connections
+// that have not joined yet only have their own.
+func (u *User) rateID() string {
+	if u.UserID == "" {
+		return "conn:" + u.ID
+	}
+	return u.UserID
+}
+
+// allowRate takes a token from a bucket of a user. Buckets are kept across
+// connections, so reconnecting does not reset them.
+func (rm *RoomManager) allowRate(userID string, bucket MessageType, limit RateLimit) bool {
+	if limit.Rate <= 0 {
+		return true
+	}
+
+	key := rateKey{userID: userID, bucket: bucket}
+	rm.mu.RLock()
+	limiter, exists := rm.userLimiters[key]
+	rm.mu.RUnlock()
+	if !exists {
+		rm.mu.Lock()
+		if limiter, exists = rm.userLimiters[key]; !exists {
+			limiter = newTokenBucket(limit)
+			rm.userLimiters[key] = limiter
+		}
+		rm.mu.Unlock()
+	}
+
+	return limiter.Allow()
+}
+
+// expireLimiters drops the buckets of users that refilled completely. The
+// caller must hold the lock.
+func (rm *RoomManager) expireLimiters() {
+	for key, limiter := range rm.userLimiters {
+		if limiter.Full() {
+			delete(rm.userLimiters, key)
+		}
+	}
+}
+
+// AllowChat takes a token from the chat limiter shared by a room
+func (rm *RoomManager) AllowChat(spaceID string) bool {
+	if RoomChatRateLimit.Rate <= 0 {
+		return true
+	}
+
+	rm.mu.Lock()
+	limiter, exists := rm.chatLimiters[spaceID]
+	if !exists {
+		limiter = newTokenBucket(RoomChatRateLimit)
+		rm.chatLimiters[spaceID] = limiter
+	}
+	rm.mu.Unlock()
+
+	return limiter.Allow()
+}
@@ -0,0 +1,198 @@
+package websocket
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTokenBucketAllowsBurstThenRefills(t *testing.T) {
+	b := newTokenBucket(RateLimit{Rate: 2, Burst: 3})
+	for i := 0; i < 3; i++ {
+		if !b.Allow() {
+			t.Fatalf("event %d of the burst was refused", i+1)
+		}
+	}
+	if b.Allow() {
+		t.Fatal("an event past the burst was allowed")
+	}
+
+	// Half a second at 2 per second earns one token
+	b.mu.Lock()
+	b.last = b.last.Add(-500 * time.Millisecond)
+	b.mu.Unlock()
+	if !b.Allow() {
+		t.Fatal("the bucket did not refill")
+	}
+	if b.Allow() {
+		t.Fatal("the bucket refilled more than the elapsed time allows")
+	}
+
+	// Refills never exceed the burst
+	b.mu.Lock()
+	b.last = b.last.Add(-time.Hour)
+	b.mu.Unlock()
+	for i := 0; i < 3; i++ {
+		b.Allow()
+	}
+	if b.Allow() {
+		t.Fatal("a long pause earned more than the burst")
+	}
+}
+
+func TestOverLimitMessagesAreRejectedThenDisconnect(t *testing.T) {
+	keepConfig(t)
+	MessageRateLimits = map[MessageType]RateLimit{TypeMove: {Rate: 0.001, Burst: 2}}
+	RateViolationLimit = 3
+	u, _ := newTestUser(t, "")
+	u.SpaceID = "space-1"
+
+	for i := 0; i < 2; i++ {
+		if !u.allow(TypeMove) {
+			t.Fatalf("move %d within the burst was refused", i+1)
+		}
+	}
+	for i := 0; i < RateViolationLimit; i++ {
+		if u.allow(TypeMove) {
+			t.Fatal("an over-limit move was allowed")
+		}
+		if got := lastError(t, u); got.Code != ErrRateLimited || got.RequestType != TypeMove {
+			t.Fatalf("error = %+v, want rate_limited for move", got)
+		}
+		if isClosing(u) {
+			t.Fatalf("disconnected after %d violations, the budget is %d", i+1, RateViolationLimit)
+		}
+	}
+
+	u.allow(TypeMove)
+	if !isClosing(u) {
+		t.Fatal("a client past its violation budget was kept")
+	}
+}
+
+func TestReconnectingKeepsRateLimits(t *testing.T) {
+	keepConfig(t)
+	MessageRateLimits = map[MessageType]RateLimit{TypeMove: {Rate: 0.001, Burst: 2}}
+	RateViolationLimit = 2
+	first, _ := newTestUser(t, "")
+
+	for i := 0; i < 2; i++ {
+		first.allow(TypeMove)
+	}
+	if first.allow(TypeMove) {
+		t.Fatal("an over-limit move was allowed")
+	}
+
+	// The same user on a new connection picks up where the old one stopped
+	second, _ := newTestUser(t, "")
+	second.UserID = first.UserID
+	if second.allow(TypeMove) {
+		t.Fatal("reconnecting reset the move limit")
+	}
+	second.allow(TypeMove)
+	if !isClosing(second) {
+		t.Fatal("reconnecting reset the violation budget")
+	}
+
+	// Other users have their own limits
+	other, _ := newTestUser(t, "")
+	if !other.allow(TypeMove) {
+		t.Fatal("another user shares the limit")
+	}
+}
+
+func TestIdleRateLimitersExpire(t *testing.T) {
+	rm := newTestRoomManager()
+	limit := RateLimit{Rate: 1, Burst: 2}
+	rm.allowRate("alice", TypeMove, limit)
+	rm.allowRate("bob", TypeMove, limit)
+
+	// Alice's bucket refilled, Bob's did not
+	alice := rm.userLimiters[rateKey{userID: "alice", bucket: TypeMove}]
+	alice.mu.Lock()
+	alice.last = alice.last.Add(-time.Second)
+	alice.mu.Unlock()
+
+	rm.mu.Lock()
+	rm.expireLimiters()
+	rm.mu.Unlock()
+	if _, kept := rm.userLimiters[rateKey{userID: "alice", bucket: TypeMove}]; kept {
+		t.Fatal("a refilled bucket was kept")
+	}
+	if _, kept := rm.userLimiters[rateKey{userID: "bob", bucket: TypeMove}]; !kept {
+		t.Fatal("a bucket still in use was dropped")
+	}
+}
+
+func TestJoinFloodIsRateLimited(t *testing.T) {
+	keepConfig(t)
+	OtherRateLimit = RateLimit{Rate: 0.001, Burst: 2}
+	u, _ := newTestUser(t, "")
+
+	// Joins without a token fail validation, which does not touch the database
+	join := IncomingMessage{Type: TypeJoin, Payload: RawPayload(`{"spaceId":"space-1"}`)}
+	for i := 0; i < 2; i++ {
+		u.processMessage(join)
+		if got := lastError(t, u); got.Code != ErrInvalidPayload {
+			t.Fatalf("join %d: error = %+v, want invalid_payload", i+1, got)
+		}
+	}
+	u.processMessage(join)
+	if got := lastError(t, u); got.Code != ErrRateLimited || got.RequestType != TypeJoin {
+		t.Fatalf("error = %+v, want rate_limited for join", got)
+	}
+}
+
+func TestUnknownTypesCountAsViolations(t *testing.T) {
+	keepConfig(t)
+	OtherRateLimit = RateLimit{Rate: 1000, Burst: 1000}
+	RateViolationLimit = 3
+	u, _ := newTestUser(t, "")
+
+	for i := 0; i < RateViolationLimit; i++ {
+		u.processMessage(IncomingMessage{Type: "teleport"})
+		if got := lastError(t, u); got.Code != ErrUnknownType {
+			t.Fatalf("error = %+v, want unknown_type", got)
+		}
+	}
+	if isClosing(u) {
+		t.Fatal("disconnected within the violation budget")
+	}
+
+	u.processMessage(IncomingMessage{Type: "teleport"})
+	if !isClosing(u) {
+		t.Fatal("a client flooding unknown types was kept")
+	}
+}
+
+func TestUnparsableFramesCountAsViolations(t *testing.T) {
+	keepConfig(t)
+	RateViolationLimit = 2
+	u, _ := newTestUser(t, "")
+
+	for i := 0; i < RateViolationLimit; i++ {
+		if !u.allowInvalid("") {
+			t.Fatalf("frame %d was refused within the budget", i+1)
+		}
+	}
+	if u.allowInvalid("") || !isClosing(u) {
+		t.Fatal("a client flooding unparsable frames was kept")
+	}
+}
+
+func TestRoomChatLimitIsShared(t *testing.T) {
+	keepConfig(t)
+	RoomChatRateLimit = RateLimit{Rate: 0.001, Burst: 3}
+	rm := newTestRoomManager()
+
+	for i := 0; i < 3; i++ {
+		if !rm.AllowChat("space-1") {
+			t.Fatalf("chat %d within the room burst was refused", i+1)
+		}
+	}
+	if rm.AllowChat("space-1") {
+		t.Fatal("chat past the room burst was allowed")
+	}
+	if !rm.AllowChat("space-2") {
+		t.Fatal("another room shares the limit")
+	}
+}
@@ -1,13 +1,50 @@
 package websocket
 
 import (
+	"log"
 	"sync"
+	"time"
+
+	"github.com/genosis18m/Metaverse_go/internal/models"
+	"github.com/genosis18m/Metaverse_go/internal/utils"
 )
 
+// presenceInterval is how often local users are re-announced to the other nodes
+const presenceInterval = 30 * time.Second
+
 // RoomManager manages rooms (spaces) and their users
 type RoomManager struct {
 	rooms map[string][]*User
+	grids map[string]*Grid
+	zones map[string][]*models.SpaceZone
 	mu    sync.RWMutex
+
+	// Users connected to other nodes, keyed by space and connection ID
+	remote    map[string]map[string]*User
+	nodeID    string
+	backplane Backplane
+	subs      map[string]func()
+
+	// Disconnected users waiting to be resumed, keyed by resume token
+	detached map[string]*detachedUser
+
+	// Snapshot tick loops of rooms with clients that opted in
+	tickers map[string]*roomTicker
+
+	// Spatial index of each room for area-of-interest and proximity queries
+	indexes map[string]*spatialIndex
+
+	// Chat limiters shared by everyone in a room
+	chatLimiters map[string]*tokenBucket
+
+	// Rate limiters of each user and message type, see ratelimit.go
+	userLimiters map[rateKey]*tokenBucket
+
+	// Backplane subscriptions for direct messages, keyed by user ID
+	userSubs map[string]*userSubscription
+
+	// Next round-robin spawn point of each space
+	spawnCursors map[string]int
 }
 
 var instance *RoomManager
@@ -17,69 +54,492 @@ var once sync.Once
 func GetRoomManager() *RoomManager {
 	once.Do(func() {
 		instance = &RoomManager{
-			rooms: make(map[string][]*User),
+			rooms:     make(map[string][]*User),
+			grids:     make(map[string]*Grid),
+			zones:     make(map[string][]*models.SpaceZone),
+			remote:    make(map[string]map[string]*User),
+			nodeID:    utils.GenerateRandomString(12),
+			backplane: NewMemoryBackplane(),
+			subs:      make(map[string]func()),
+			detached:  make(map[string]*detachedUser),
+			tickers:   make(map[string]*roomTicker),
+			indexes:   make(map[string]*spatialIndex),
+
+			chatLimiters: make(map[string]*tokenBucket),
+			userLimiters: make(map[rateKey]*tokenBucket),
+			userSubs:     make(map[string]*userSubscription),
+			spawnCursors: make(map[string]int),
 		}
+		go instance.presenceLoop()
 	})
 	return instance
 }
 
-// AddUser adds a user to a room
+// SetBackplane replaces the backplane used to share rooms with other nodes.
+// It must be called before any user joins.
+func (rm *RoomManager) SetBackplane(backplane Backplane) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	rm.backplane = backplane
+}
+
+// AddUser adds a user to a room at its current position
 func (rm *RoomManager) AddUser(spaceID string, user *User) {
 	rm.mu.Lock()
 	defer rm.mu.Unlock()
+	rm.addUser(spaceID, user)
+}
+
+// addUser adds a user to a room. The caller must hold the lock.
+func (rm *RoomManager) addUser(spaceID string, user *User) {
+	if user.snapshots {
+		rm.ensureTicker(spaceID)
+	}
 
 	if _, exists := rm.rooms[spaceID]; !exists {
 		rm.rooms[spaceID] = []*User{user}
-		return
+		rm.subscribe(spaceID)
+	} else {
+		rm.rooms[spaceID] = append(rm.rooms[spaceID], user)
 	}
-	rm.rooms[spaceID] = append(rm.rooms[spaceID], user)
+	rm.addConnection(user.UserID)
+
+	// The user-joined broadcast announces the user to everyone in view
+	rm.refreshView(user, false)
 }
 
 // RemoveUser removes a user from a room
 func (rm *RoomManager) RemoveUser(user *User, spaceID string) {
 	rm.mu.Lock()
 	defer rm.mu.Unlock()
+	rm.removeUser(user, spaceID)
+}
 
+// Transfer moves a user to a position in another room in one step, so it is
+// never seen in both rooms or in neither
+func (rm *RoomManager) Transfer(user *User, spaceID string, x, y int) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	rm.removeUser(user, user.SpaceID)
+	user.SpaceID = spaceID
+	user.X = x
+	user.Y = y
+	rm.addUser(spaceID, user)
+}
+
+// removeUser removes a user from a room. The caller must hold the lock.
+func (rm *RoomManager) removeUser(user *User, spaceID string) {
 	users, exists := rm.rooms[spaceID]
 	if !exists {
 		return
 	}
 
 	newUsers := make([]*User, 0)
+	removed := false
 	for _, u := range users {
 		if u.ID != user.ID {
 			newUsers = append(newUsers, u)
+		} else {
+			removed = true
 		}
 	}
 	rm.rooms[spaceID] = newUsers
+	if removed {
+		rm.removeConnection(user.UserID)
+	}
+	rm.clearView(user)
+
+	rm.publish(spaceID, Envelope{Kind: EnvelopeLeave, User: user.remoteInfo()})
+
+	// Drop empty rooms so the grid and zones are reloaded when someone joins again
+	if len(newUsers) == 0 {
+		delete(rm.rooms, spaceID)
+		delete(rm.grids, spaceID)
+		delete(rm.zones, spaceID)
+		delete(rm.remote, spaceID)
+		delete(rm.indexes, spaceID)
+		delete(rm.chatLimiters, spaceID)
+		rm.stopTicker(spaceID)
+		if unsubscribe, ok := rm.subs[spaceID]; ok {
+			unsubscribe()
+			delete(rm.subs, spaceID)
+		}
+	}
 }
 
-// GetRoomUsers returns all users in a room
+// GetRoomUsers returns all users in a room, including users connected to other nodes
 func (rm *RoomManager) GetRoomUsers(spaceID string) []*User {
 	rm.mu.RLock()
 	defer rm.mu.RUnlock()
 
-	users, exists := rm.rooms[spaceID]
-	if !exists {
-		return []*User{}
+	return rm.members(spaceID)
+}
+
+// VisibleUsers lists the other users of a room that a user can see, with
+// positions read under the lock
+func (rm *RoomManager) VisibleUsers(u *User) []UserInfo {
+	rm.mu.RLock()
+	defer rm.mu.RUnlock()
+
+	infos := make([]UserInfo, 0)
+	for _, user := range rm.members(u.SpaceID) {
+		if user.ID != u.ID && canSee(u, user.ID) {
+			infos = append(infos, UserInfo{
+				UserID:   user.UserID,
+				Username: user.Username,
+				X:        user.X,
+				Y:        user.Y,
+			})
+		}
+	}
+	return infos
+}
+
+// members returns the local and remote users of a room. The caller must hold the lock.
+func (rm *RoomManager) members(spaceID string) []*User {
+	users := make([]*User, 0, len(rm.rooms[spaceID])+len(rm.remote[spaceID]))
+	users = append(users, rm.rooms[spaceID]...)
+	for _, user := range rm.remote[spaceID] {
+		users = append(users, user)
 	}
 	return users
 }
 
 // Broadcast sends a message to all users in a room except the sender
 func (rm *RoomManager) Broadcast(message OutgoingMessage, sender *User, spaceID string) {
-	rm.mu.RLock()
-	defer rm.mu.RUnlock()
+	env := Envelope{Kind: EnvelopeBroadcast, Message: &message}
+	if sender != nil {
+		env.ExcludeID = sender.ID
+		env.User = sender.remoteInfo()
+	}
 
-	users, exists := rm.rooms[spaceID]
-	if !exists {
-		return
+	rm.deliver(spaceID, env.ExcludeID, message)
+	rm.publishUnlocked(spaceID, env)
+}
+
+// deliver queues a message for the local users of a room. Sending happens
+// outside the lock so a slow client never holds up the room.
+func (rm *RoomManager) deliver(spaceID, excludeID string, message OutgoingMessage) {
+	// Clients receiving snapshots get movement batched by the room tick loop
+	batched := false
+	if message.Type == TypeMovement && excludeID != "" {
+		if move, ok := decodeMovement(message); ok {
+			batched = rm.queueMovement(spaceID, excludeID, move)
+		}
 	}
 
+	// Movement and presence only go to users in view of the sender
+	spatial := isSpatial(message.Type) && excludeID != ""
+
+	rm.mu.RLock()
+	users := make([]*User, 0, len(rm.rooms[spaceID]))
+	for _, user := range rm.rooms[spaceID] {
+		if spatial && !canSee(user, excludeID) {
+			continue
+		}
+		users = append(users, user)
+	}
+	rm.mu.RUnlock()
+
 	for _, user := range users {
-		// If sender is nil, broadcast to everyone. Otherwise skip sender.
-		if sender == nil || user.ID != sender.ID {
+		if batched && user.snapshots {
+			continue
+		}
+		// If excludeID is empty, broadcast to everyone. Otherwise skip sender.
+		if user.ID != excludeID {
 			user.Send(message)
 		}
 	}
 }
+
+// sendRemote forwards a message to a user connected to another node
+func (rm *RoomManager) sendRemote(user *User, message OutgoingMessage) {
+	rm.mu.RLock()
+	spaceID := user.SpaceID
+	rm.mu.RUnlock()
+
+	rm.publishUnlocked(spaceID, Envelope{Kind: EnvelopeDirect, TargetID: user.ID, Message: &message})
+}
+
+// publish sends an envelope to the other nodes. The caller must hold the
+// lock. Backplanes only queue envelopes, so this never waits on the network;
+// callers that do not need the lock for anything else use publishUnlocked.
+func (rm *RoomManager) publish(spaceID string, env Envelope) {
+	publishTo(rm.backplane, rm.stamp(spaceID, env))
+}
+
+// publishUnlocked sends envelopes of a topic to the other nodes. The caller
+// must not hold the lock.
+func (rm *RoomManager) publishUnlocked(spaceID string, envs ...Envelope) {
+	rm.mu.RLock()
+	backplane := rm.backplane
+	rm.mu.RUnlock()
+
+	for _, env := range envs {
+		publishTo(backplane, rm.stamp(spaceID, env))
+	}
+}
+
+// stamp marks an envelope as coming from this node
+func (rm *RoomManager) stamp(spaceID string, env Envelope) Envelope {
+	env.NodeID = rm.nodeID
+	env.SpaceID = spaceID
+	return env
+}
+
+func publishTo(backplane Backplane, env Envelope) {
+	if err := backplane.Publish(env.SpaceID, env); err != nil {
+		log.Printf("Error publishing to backplane: %v", err)
+	}
+}
+
+// subscribe starts receiving the envelopes of a room. The caller must hold the lock.
+func (rm *RoomManager) subscribe(spaceID string) {
+	if _, exists := rm.subs[spaceID]; exists {
+		return
+	}
+
+	// Ask the other nodes who is already in the room once their replies can
+	// reach this node, or they would be lost until the next presence round
+	unsubscribe, err := rm.backplane.Subscribe(spaceID, rm.handleEnvelope, func() {
+		rm.publishUnlocked(spaceID, Envelope{Kind: EnvelopeSync})
+	})
+	if err != nil {
+		log.Printf("Error subscribing to backplane: %v", err)
+		return
+	}
+	rm.subs[spaceID] = unsubscribe
+}
+
+// handleEnvelope applies an envelope published by another node
+func (rm *RoomManager) handleEnvelope(env Envelope) {
+	if env.NodeID == rm.nodeID {
+		return
+	}
+
+	if env.User != nil && env.Kind != EnvelopeLeave {
+		joining := env.Kind == EnvelopeBroadcast && env.Message != nil && env.Message.Type == TypeUserJoined
+		rm.trackRemote(env.SpaceID, env.User, joining)
+	}
+
+	switch env.Kind {
+	case EnvelopeBroadcast:
+		if env.Message == nil {
+			return
+		}
+		rm.deliver(env.SpaceID, env.ExcludeID, *env.Message)
+	case EnvelopeDirect:
+		if env.Message == nil {
+			return
+		}
+		rm.mu.RLock()
+		for _, user := range rm.rooms[env.SpaceID] {
+			if user.ID == env.TargetID {
+				user.Send(*env.Message)
+			}
+		}
+		rm.mu.RUnlock()
+	case EnvelopeKick:
+		rm.kickLocal(env.SpaceID, env.TargetID)
+	case EnvelopeUser:
+		if env.Message == nil {
+			return
+		}
+		rm.deliverToUser(env.TargetID, *env.Message)
+	case EnvelopeLeave:
+		if env.User == nil {
+			return
+		}
+		rm.mu.Lock()
+		user, exists := rm.remote[env.SpaceID][env.User.ID]
+		delete(rm.remote[env.SpaceID], env.User.ID)
+		if exists {
+			rm.clearView(user)
+		}
+		rm.mu.Unlock()
+		if exists {
+			rm.ClearProximity(user)
+		}
+	case EnvelopeSync:
+		rm.mu.RLock()
+		presence := make([]Envelope, 0, len(rm.rooms[env.SpaceID]))
+		for _, user := range rm.rooms[env.SpaceID] {
+			presence = append(presence, Envelope{Kind: EnvelopePresence, User: user.remoteInfo()})
+		}
+		rm.mu.RUnlock()
+		rm.publishUnlocked(env.SpaceID, presence...)
+	}
+}
+
+// trackRemote records or refreshes a user connected to another node. Users
+// first seen through anything but their own user-joined broadcast, such as the
+// sync that follows this node joining the room, are announced to local users.
+func (rm *RoomManager) trackRemote(spaceID string, info *RemoteUser, joining bool) {
+	rm.mu.Lock()
+
+	// Only track remote users for rooms this node has users in
+	if _, active := rm.rooms[spaceID]; !active {
+		rm.mu.Unlock()
+		return
+	}
+	if _, exists := rm.remote[spaceID]; !exists {
+		rm.remote[spaceID] = make(map[string]*User)
+	}
+
+	user, exists := rm.remote[spaceID][info.ID]
+	if !exists {
+		user = newRemoteUser(spaceID, info)
+		rm.remote[spaceID][info.ID] = user
+	}
+	user.UserID = info.UserID
+	user.Username = info.Username
+	user.X = info.X
+	user.Y = info.Y
+	user.seenAt = time.Now()
+
+	announce := !exists && !joining
+	events := rm.refreshView(user, exists || announce)
+	joined := UserJoinedPayload{UserID: user.UserID, Username: user.Username, X: user.X, Y: user.Y}
+	rm.mu.Unlock()
+
+	sendViewEvents(events)
+	if announce && ViewRadius <= 0 {
+		rm.deliver(spaceID, user.ID, OutgoingMessage{Type: TypeUserJoined, Payload: joined})
+	}
+}
+
+// presenceLoop periodically re-announces local users and drops remote users
+// whose node stopped announcing them
+func (rm *RoomManager) presenceLoop() {
+	ticker := time.NewTicker(presenceInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		expired := make([]*User, 0)
+		presence := make([]Envelope, 0)
+
+		rm.mu.Lock()
+		backplane := rm.backplane
+		for spaceID, users := range rm.rooms {
+			for _, user := range users {
+				presence = append(presence, rm.stamp(spaceID, Envelope{Kind: EnvelopePresence, User: user.remoteInfo()}))
+			}
+		}
+		for _, users := range rm.remote {
+			for _, user := range users {
+				if time.Since(user.seenAt) > 3*presenceInterval {
+					expired = append(expired, user)
+				}
+			}
+		}
+		rm.expireLimiters()
+		rm.mu.Unlock()
+
+		for _, env := range presence {
+			publishTo(backplane, env)
+		}
+
+		for _, user := range expired {
+			rm.ClearProximity(user)
+			rm.deliver(user.SpaceID, user.ID, OutgoingMessage{
+				Type:    TypeUserLeft,
+				Payload: UserLeftPayload{UserID: user.UserID},
+			})
+
+			rm.mu.Lock()
+			delete(rm.remote[user.SpaceID], user.ID)
+			rm.clearView(user)
+			rm.mu.Unlock()
+		}
+	}
+}
+
+// EnsureGrid loads the occupancy grid of a space if it is not loaded yet
+func (rm *RoomManager) EnsureGrid(spaceID string, width, height int) {
+	rm.mu.RLock()
+	_, loaded := rm.grids[spaceID]
+	rm.mu.RUnlock()
+	if loaded {
+		return
+	}
+
+	grid, err := LoadGrid(spaceID, width, height)
+	if err != nil {
+		log.Printf("Error loading grid for space %s: %v", spaceID, err)
+		grid = NewGrid(width, height)
+	}
+
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	if _, loaded := rm.grids[spaceID]; !loaded {
+		rm.setGrid(spaceID, grid)
+	}
+}
+
+// RefreshGrid reloads the occupancy grid of a space that has users in it
+func (rm *RoomManager) RefreshGrid(spaceID string) {
+	rm.mu.RLock()
+	current, loaded := rm.grids[spaceID]
+	rm.mu.RUnlock()
+	if !loaded {
+		return
+	}
+
+	grid, err := LoadGrid(spaceID, current.Width, current.Height)
+	if err != nil {
+		log.Printf("Error refreshing grid for space %s: %v", spaceID, err)
+		return
+	}
+
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	if _, loaded := rm.grids[spaceID]; loaded {
+		rm.setGrid(spaceID, grid)
+	}
+}
+
+// setGrid installs the grid of a space with the users already in the room.
+// The caller must hold the lock.
+func (rm *RoomManager) setGrid(spaceID string, grid *Grid) {
+	for _, user := range rm.members(spaceID) {
+		grid.Occupy(user.ID, user.X, user.Y)
+	}
+	rm.grids[spaceID] = grid
+}
+
+// PortalAt returns the portal on a tile of a space, or nil
+func (rm *RoomManager) PortalAt(spaceID string, x, y int) *models.SpacePortal {
+	rm.mu.RLock()
+	defer rm.mu.RUnlock()
+
+	grid, exists := rm.grids[spaceID]
+	if !exists {
+		return nil
+	}
+	return grid.PortalAt(x, y)
+}
+
+// IsBlocked reports whether a tile in a space is occupied by a static element
+func (rm *RoomManager) IsBlocked(spaceID string, x, y int) bool {
+	rm.mu.RLock()
+	defer rm.mu.RUnlock()
+
+	grid, exists := rm.grids[spaceID]
+	if !exists {
+		return false
+	}
+	return grid.IsBlocked(x, y)
+}
+
+// IsOccupied reports whether a user stands on a tile in a space
+func (rm *RoomManager) IsOccupied(spaceID string, x, y int) bool {
+	rm.mu.RLock()
+	defer rm.mu.RUnlock()
+
+	grid, exists := rm.grids[spaceID]
+	if !exists {
+		return false
+	}
+	return grid.IsOccupied(x, y)
+}
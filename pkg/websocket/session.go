@@ -0,0 +1,119 @@
+package websocket
+
+import (
+	"log"
+	"time"
+)
+
+// Heartbeat and resume settings, configurable through the environment
+var (
+	PingInterval = 25 * time.Second
+	PongTimeout  = 60 * time.Second
+	ResumeGrace  = 30 * time.Second
+)
+
+// detachedUser is a disconnected user waiting to be resumed
+type detachedUser struct {
+	user  *User
+	timer *time.Timer
+}
+
+// Detach keeps a disconnected user in its room for the resume grace window.
+// It returns false when the user cannot be resumed and should be destroyed now.
+func (rm *RoomManager) Detach(u *User) bool {
+	if u.SpaceID == "" || u.resumeToken == "" || ResumeGrace <= 0 || u.kicked.Load() {
+		return false
+	}
+
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	token := u.resumeToken
+	rm.detached[token] = &detachedUser{
+		user: u,
+		timer: time.AfterFunc(ResumeGrace, func() {
+			rm.mu.Lock()
+			_, pending := rm.detached[token]
+			delete(rm.detached, token)
+			rm.mu.Unlock()
+
+			if pending {
+				u.Destroy()
+			}
+		}),
+	}
+	return true
+}
+
+// Resume hands over a detached user to a reconnecting client of the same account
+func (rm *RoomManager) Resume(token, userID, spaceID string) *User {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	d, exists := rm.detached[token]
+	if !exists || d.user.UserID != userID || d.user.SpaceID != spaceID {
+		return nil
+	}
+	if !d.timer.Stop() {
+		// The grace window already expired
+		return nil
+	}
+	delete(rm.detached, token)
+	return d.user
+}
+
+// ReplaceUser swaps a detached user for the connection that resumed it
+func (rm *RoomManager) ReplaceUser(old, user *User) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	if user.snapshots {
+		rm.ensureTicker(old.SpaceID)
+	}
+
+	for i, u := range rm.rooms[old.SpaceID] {
+		if u == old {
+			rm.rooms[old.SpaceID][i] = user
+		}
+	}
+
+	user.nearby = old.nearby
+	for _, other := range user.nearby {
+		other.nearby[user.ID] = user
+	}
+	user.visible = old.visible
+	for _, other := range user.visible {
+		other.visible[user.ID] = user
+	}
+	rm.index(old.SpaceID).update(user)
+}
+
+// resume takes over the identity and position of a detached user without
+// the rest of the room seeing it leave and join again
+func (u *User) resume(old *User) {
+	u.ID = old.ID
+	u.Username = old.Username
+	u.SpaceID = old.SpaceID
+	u.SpaceWidth = old.SpaceWidth
+	u.SpaceHeight = old.SpaceHeight
+	u.spaceOwnerID = old.spaceOwnerID
+	u.zone = old.zone
+	u.forgetPositions = old.forgetPositions
+	u.X = old.X
+	u.Y = old.Y
+
+	GetRoomManager().ReplaceUser(old, u)
+	log.Printf("User %s resumed session in space %s", u.UserID, u.SpaceID)
+
+	u.sendSpaceJoined()
+
+	// The new client has no peer connections yet, so replay who is nearby
+	GetRoomManager().mu.RLock()
+	events := make([]proximityEvent, 0, len(u.nearby))
+	for _, other := range u.nearby {
+		events = append(events, newProximityEvent(u, TypeProximityEnter, other))
+	}
+	GetRoomManager().mu.RUnlock()
+
+	sendProximityEvents(events)
+}
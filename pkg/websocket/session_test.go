@@ -0,0 +1,63 @@
+package websocket
+
+import (
+	"testing"
+	"time"
+
+	"github.com/genosis18m/Metaverse_go/internal/database"
+	"github.com/genosis18m/Metaverse_go/internal/models"
+	"github.com/genosis18m/Metaverse_go/internal/utils"
+)
+
+func TestResumeChecksSpaceAccessAgain(t *testing.T) {
+	withTestDB(t)
+	t.Setenv("JWT_KEYS_DIR", "")
+	t.Setenv("JWT_SECRET", "test-secret")
+
+	cases := []struct {
+		name   string
+		revoke func(space models.Space, userID string) error
+		code   ErrorCode
+	}{
+		{"membership removed", func(space models.Space, userID string) error {
+			return database.DB.Where("space_id = ? AND user_id = ?", space.ID, userID).Delete(&models.SpaceMember{}).Error
+		}, ErrForbidden},
+		{"kicked", func(space models.Space, userID string) error {
+			return database.DB.Create(&models.SpaceKick{SpaceID: space.ID, UserID: userID, KickedByID: space.CreatorID, Until: time.Now().Add(time.Hour)}).Error
+		}, ErrKicked},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			creator, account := createTestAccount(t), createTestAccount(t)
+			space := createTestSpace(t, creator.ID)
+			if err := database.DB.Model(&space).Update("visibility", models.SpaceVisibilityPrivate).Error; err != nil {
+				t.Fatal(err)
+			}
+			addTestMember(t, space.ID, account.ID, models.SpaceRoleMember)
+
+			rm := GetRoomManager()
+			old := joinTestRoom(t, rm, space.ID, account.ID, 1, 1)
+			old.resumeToken = utils.GenerateRandomString(32)
+			if !rm.Detach(old) {
+				t.Fatal("the session was not detached")
+			}
+			if err := c.revoke(space, account.ID); err != nil {
+				t.Fatal(err)
+			}
+
+			token, err := utils.GenerateToken(account.ID, string(models.RoleUser), "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			u, _ := newTestUser(t, "")
+			u.handleJoin(JoinRequest{SpaceID: space.ID, Token: token, ResumeToken: old.resumeToken})
+
+			if got := lastError(t, u); got.Code != c.code {
+				t.Fatalf("error = %+v, want %s", got, c.code)
+			}
+			if u.SpaceID != "" {
+				t.Fatal("the session was resumed")
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package websocket
+
+import (
+	"math/rand"
+
+	"github.com/genosis18m/Metaverse_go/internal/models"
+)
+
+// spawnOrder returns the spawn points of a space in the order they should be
+// tried. Spaces without spawn points use their centre.
+func (rm *RoomManager) spawnOrder(space models.Space) []models.SpawnPoint {
+	points := space.SpawnPoints
+	if len(points) == 0 {
+		return []models.SpawnPoint{{X: space.Width / 2, Y: space.Height / 2}}
+	}
+
+	ordered := make([]models.SpawnPoint, 0, len(points))
+	if space.SpawnMode == models.SpawnModeRoundRobin {
+		rm.mu.Lock()
+		start := rm.spawnCursors[space.ID] % len(points)
+		rm.spawnCursors[space.ID] = start + 1
+		rm.mu.Unlock()
+
+		ordered = append(ordered, points[start:]...)
+		return append(ordered, points[:start]...)
+	}
+
+	// Weighted draw without replacement, so a busy point falls back to the others
+	remaining := append([]models.SpawnPoint(nil), points...)
+	for len(remaining) > 0 {
+		total := 0
+		for _, p := range remaining {
+			total += spawnWeight(p)
+		}
+		pick := rand.Intn(total)
+		for i, p := range remaining {
+			if pick -= spawnWeight(p); pick < 0 {
+				ordered = append(ordered, p)
+				remaining = append(remaining[:i], remaining[i+1:]...)
+				break
+			}
+		}
+	}
+	return ordered
+}
+
+func spawnWeight(p models.SpawnPoint) int {
+	if p.Weight <= 0 {
+		return 1
+	}
+	return p.Weight
+}
+
+// PickSpawn chooses where a user joining a space appears: the first spawn
+// point that is free, or else the free tile closest to a spawn point. A tile
+// is free when it is not blocked, nobody stands on it and its zone is not full.
+func (rm *RoomManager) PickSpawn(space models.Space) (int, int) {
+	points := rm.spawnOrder(space)
+	for _, p := range points {
+		if rm.isFreeTile(space.ID, p.X, p.Y) {
+			return p.X, p.Y
+		}
+	}
+	if x, y, ok := rm.FreeTileNear(space.ID, points[0].X, points[0].Y, space.Width, space.Height); ok {
+		return x, y
+	}
+	return points[0].X, points[0].Y
+}
+
+// FreeTileNear returns the free tile closest to (x, y) in a width×height space
+func (rm *RoomManager) FreeTileNear(spaceID string, x, y, width, height int) (int, int, bool) {
+	maxDist := width + height
+	for d := 0; d <= maxDist; d++ {
+		// Walk the diamond of tiles at Manhattan distance d
+		for dx := -d; dx <= d; dx++ {
+			dy := d - abs(dx)
+			for _, ty := range []int{y + dy, y - dy} {
+				tx := x + dx
+				if tx >= 0 && tx < width && ty >= 0 && ty < height && rm.isFreeTile(spaceID, tx, ty) {
+					return tx, ty, true
+				}
+				if dy == 0 {
+					break
+				}
+			}
+		}
+	}
+	return 0, 0, false
+}
+
+// isFreeTile reports whether a user can be placed on a tile
+func (rm *RoomManager) isFreeTile(spaceID string, x, y int) bool {
+	rm.mu.RLock()
+	defer rm.mu.RUnlock()
+
+	if grid, exists := rm.grids[spaceID]; exists && grid.IsBlocked(x, y) {
+		return false
+	}
+
+	zone := rm.zoneAt(spaceID, x, y)
+	inZone := 0
+	for _, user := range rm.members(spaceID) {
+		if user.X == x && user.Y == y {
+			return false
+		}
+		if zone != nil {
+			if other := rm.zoneAt(spaceID, user.X, user.Y); other != nil && other.ID == zone.ID {
+				inZone++
+			}
+		}
+	}
+	return zone == nil || zone.MaxOccupancy <= 0 || inZone < zone.MaxOccupancy
+}
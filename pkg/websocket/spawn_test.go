@@ -0,0 +1,89 @@
+package websocket
+
+import (
+	"testing"
+
+	"github.com/genosis18m/Metaverse_go/internal/models"
+)
+
+func TestPickSpawnDefaultsToCentre(t *testing.T) {
+	rm := newTestRoomManager()
+	space := models.Space{ID: "space-1", Width: 20, Height: 10}
+
+	if x, y := rm.PickSpawn(space); x != 10 || y != 5 {
+		t.Fatalf("spawned at (%d,%d), want the centre (10,5)", x, y)
+	}
+
+	// An occupied centre moves the user to the closest free tile
+	joinTestRoom(t, rm, space.ID, "alice", 10, 5)
+	x, y := rm.PickSpawn(space)
+	if abs(x-10)+abs(y-5) != 1 {
+		t.Fatalf("spawned at (%d,%d), want next to the centre", x, y)
+	}
+}
+
+func TestPickSpawnRoundRobin(t *testing.T) {
+	rm := newTestRoomManager()
+	space := models.Space{
+		ID: "space-1", Width: 20, Height: 20, SpawnMode: models.SpawnModeRoundRobin,
+		SpawnPoints: []models.SpawnPoint{{X: 1, Y: 1}, {X: 5, Y: 5}, {X: 9, Y: 9}},
+	}
+
+	want := [][2]int{{1, 1}, {5, 5}, {9, 9}, {1, 1}}
+	for i, w := range want {
+		if x, y := rm.PickSpawn(space); x != w[0] || y != w[1] {
+			t.Fatalf("spawn %d at (%d,%d), want (%d,%d)", i, x, y, w[0], w[1])
+		}
+	}
+}
+
+func TestPickSpawnSkipsTakenPoints(t *testing.T) {
+	rm := newTestRoomManager()
+	space := models.Space{
+		ID: "space-1", Width: 20, Height: 20, SpawnMode: models.SpawnModeRoundRobin,
+		SpawnPoints: []models.SpawnPoint{{X: 1, Y: 1}, {X: 5, Y: 5}, {X: 9, Y: 9}},
+	}
+	joinTestRoom(t, rm, space.ID, "alice", 1, 1)
+	grid := NewGrid(space.Width, space.Height)
+	grid.Block(5, 5, 1, 1)
+	rm.grids[space.ID] = grid
+
+	// The occupied and the blocked point are passed over
+	if x, y := rm.PickSpawn(space); x != 9 || y != 9 {
+		t.Fatalf("spawned at (%d,%d), want the only free point (9,9)", x, y)
+	}
+
+	// A point in a full zone is not free either
+	joinTestRoom(t, rm, space.ID, "bob", 8, 9)
+	setTestZones(t, rm, space.ID, &models.SpaceZone{ID: "corner", Shape: models.ZoneShapeRect, X: 8, Y: 8, Width: 2, Height: 2, MaxOccupancy: 1})
+	x, y := rm.PickSpawn(space)
+	if (x == 9 && y == 9) || rm.ZoneAt(space.ID, x, y) != nil || (x == 1 && y == 1) || (x == 5 && y == 5) {
+		t.Fatalf("spawned at (%d,%d), which is not free", x, y)
+	}
+}
+
+func TestPickSpawnFollowsWeights(t *testing.T) {
+	rm := newTestRoomManager()
+	space := models.Space{
+		ID: "space-1", Width: 20, Height: 20,
+		SpawnPoints: []models.SpawnPoint{{X: 1, Y: 1, Weight: 1000}, {X: 9, Y: 9}},
+	}
+
+	heavy := 0
+	for i := 0; i < 200; i++ {
+		if x, y := rm.PickSpawn(space); x == 1 && y == 1 {
+			heavy++
+		}
+	}
+	if heavy < 180 {
+		t.Fatalf("the point of weight 1000 was picked %d of 200 times", heavy)
+	}
+
+	// Weighted draws still fall back to the other points
+	joinTestRoom(t, rm, space.ID, "alice", 1, 1)
+	for i := 0; i < 20; i++ {
+		if x, y := rm.PickSpawn(space); x != 9 || y != 9 {
+			t.Fatalf("spawned at (%d,%d), want the free point (9,9)", x, y)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package websocket
+
+import (
+	"sync"
+	"time"
+)
+
+// TickRate is how many room snapshots per second are sent to clients that opted in
+var TickRate = 20
+
+// roomTicker accumulates movement in a room and flushes it once per tick
+type roomTicker struct {
+	tick uint64
+
+	// mu guards pending and order, so movement is queued under the room's
+	// read lock
+	mu sync.Mutex
+	// Latest movement of each connection that moved since the last tick
+	pending map[string]MovementPayload
+	order   []string
+	stop    chan struct{}
+}
+
+// ensureTicker starts the tick loop of a room. The caller must hold the lock.
+func (rm *RoomManager) ensureTicker(spaceID string) {
+	if _, running := rm.tickers[spaceID]; running || TickRate <= 0 {
+		return
+	}
+
+	t := &roomTicker{
+		pending: make(map[string]MovementPayload),
+		stop:    make(chan struct{}),
+	}
+	rm.tickers[spaceID] = t
+	go rm.runTicker(spaceID, t)
+}
+
+// stopTicker ends the tick loop of a room. The caller must hold the lock.
+func (rm *RoomManager) stopTicker(spaceID string) {
+	if t, running := rm.tickers[spaceID]; running {
+		close(t.stop)
+		delete(rm.tickers, spaceID)
+	}
+}
+
+// queueMovement records a position change for the next snapshot of a room.
+// It reports false when no client in the room receives snapshots.
+func (rm *RoomManager) queueMovement(spaceID, connID string, move MovementPayload) bool {
+	rm.mu.RLock()
+	t, running := rm.tickers[spaceID]
+	rm.mu.RUnlock()
+	if !running {
+		return false
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, exists := t.pending[connID]; !exists {
+		t.order = append(t.order, connID)
+	}
+	t.pending[connID] = move
+	return true
+}
+
+// runTicker sends one room-snapshot with the latest position of every user
+// that moved since the previous tick
+func (rm *RoomManager) runTicker(spaceID string, t *roomTicker) {
+	ticker := time.NewTicker(time.Second / time.Duration(TickRate))
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-t.stop:
+			return
+		case <-ticker.C:
+		}
+
+		t.mu.Lock()
+		pending, order := t.pending, t.order
+		if len(order) == 0 {
+			t.mu.Unlock()
+			continue
+		}
+		t.pending = make(map[string]MovementPayload)
+		t.order = nil
+		t.tick++
+		tick := t.tick
+		t.mu.Unlock()
+
+		// Snapshots include the recipient's own position so clients can reconcile,
+		// and otherwise only the users within its view
+		rm.mu.RLock()
+		snapshots := make(map[*User][]MovementPayload)
+		for _, user := range rm.rooms[spaceID] {
+			if !user.snapshots {
+				continue
+			}
+			moves := make([]MovementPayload, 0, len(order))
+			for _, connID := range order {
+				if canSee(user, connID) {
+					moves = append(moves, pending[connID])
+				}
+			}
+			snapshots[user] = moves
+		}
+		rm.mu.RUnlock()
+
+		for user, moves := range snapshots {
+			if len(moves) == 0 {
+				continue
+			}
+			user.Send(OutgoingMessage{
+				Type:    TypeRoomSnapshot,
+				Payload: RoomSnapshotPayload{Tick: tick, Moves: moves},
+			})
+		}
+	}
+}
+
+// decodeMovement extracts the movement payload of a message
+func decodeMovement(msg OutgoingMessage) (MovementPayload, bool) {
+	switch payload := msg.Payload.(type) {
+	case MovementPayload:
+		return payload, true
+	case map[string]interface{}:
+		// Messages relayed through the backplane arrive decoded as JSON objects
+		userID, _ := payload["userId"].(string)
+		x, _ := payload["x"].(float64)
+		y, _ := payload["y"].(float64)
+		return MovementPayload{UserID: userID, X: int(x), Y: int(y)}, userID != ""
+	}
+	return MovementPayload{}, false
+}
@@ -0,0 +1,60 @@
+package websocket
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestQueueMovementOnlyReadsRoomLock(t *testing.T) {
+	rm := newTestRoomManager()
+
+	// Another reader holds the room lock; a write lock would wait for it
+	rm.mu.RLock()
+	defer rm.mu.RUnlock()
+
+	done := make(chan bool, 1)
+	go func() { done <- rm.queueMovement("space-1", "conn-1", MovementPayload{UserID: "a"}) }()
+	select {
+	case batched := <-done:
+		if batched {
+			t.Fatal("movement was batched in a room without a tick loop")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("queueMovement waited for the room write lock")
+	}
+}
+
+func TestQueueMovementWithTicker(t *testing.T) {
+	rm := newTestRoomManager()
+	rm.mu.Lock()
+	rm.ensureTicker("space-1")
+	ticker := rm.tickers["space-1"]
+	rm.mu.Unlock()
+	defer func() {
+		rm.mu.Lock()
+		rm.stopTicker("space-1")
+		rm.mu.Unlock()
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for x := 0; x < 100; x++ {
+				if !rm.queueMovement("space-1", "conn", MovementPayload{UserID: "a", X: x, Y: i}) {
+					t.Error("movement was not batched in a room with a tick loop")
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	ticker.mu.Lock()
+	defer ticker.mu.Unlock()
+	if len(ticker.order) > 1 || len(ticker.pending) > 1 {
+		t.Fatalf("one connection should keep one pending move, got %d", len(ticker.order))
+	}
+}
@@ -1,5 +1,10 @@
 package websocket
 
+import (
+	"github.com/genosis18m/Metaverse_go/internal/models"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
 // MessageType represents the type of WebSocket message
 type MessageType string
 
@@ -7,27 +12,96 @@ const (
 	TypeJoin             MessageType = "join"
 	TypeMove             MessageType = "move"
 	TypeChat             MessageType = "chat"
+	TypeChatHistory      MessageType = "chat-history"
 	TypeSpaceJoined      MessageType = "space-joined"
 	TypeUserJoined       MessageType = "user-joined"
 	TypeMovement         MessageType = "movement"
 	TypeMovementRejected MessageType = "movement-rejected"
 	TypeUserLeft         MessageType = "user-left"
+	TypeRoomSnapshot     MessageType = "room-snapshot"
+	TypeError            MessageType = "error"
+
+	// Chat moderation by authors and space owners
+	TypeChatEdit    MessageType = "chat-edit"
+	TypeChatDelete  MessageType = "chat-delete"
+	TypeChatEdited  MessageType = "chat-edited"
+	TypeChatDeleted MessageType = "chat-deleted"
+	TypeMute        MessageType = "mute"
+	TypeUnmute      MessageType = "unmute"
+	TypeKick        MessageType = "kick"
+	TypeUserMuted   MessageType = "user-muted"
+	TypeUserUnmuted MessageType = "user-unmuted"
+	TypeUserKicked  MessageType = "user-kicked"
+
+	// Zone events when users cross zone boundaries
+	TypeZoneEnter MessageType = "zone-enter"
+	TypeZoneLeave MessageType = "zone-leave"
+
+	// Layout changes made through the HTTP API
+	TypeElementAdded   MessageType = "element-added"
+	TypeElementUpdated MessageType = "element-updated"
+	TypeElementRemoved MessageType = "element-removed"
+	TypeSpaceDeleted   MessageType = "space-deleted"
+
+	// Private messages between two users, delivered across spaces
+	TypeDirectMessage     MessageType = "dm"
+	TypeDirectMessageRead MessageType = "dm-read"
+
+	// WebRTC signaling relayed between users in the same space
+	TypeRTCOffer        MessageType = "rtc-offer"
+	TypeRTCAnswer       MessageType = "rtc-answer"
+	TypeRTCIceCandidate MessageType = "rtc-ice-candidate"
+
+	// Proximity events telling clients when to open or close peer connections
+	TypeProximityEnter MessageType = "proximity-enter"
+	TypeProximityLeave MessageType = "proximity-leave"
+
+	// Area-of-interest events when users cross each other's view radius
+	TypeUserEnteredView MessageType = "user-entered-view"
+	TypeUserExitedView  MessageType = "user-exited-view"
 )
 
-// IncomingMessage represents a message from client
+// IncomingMessage represents a message from client. The payload is decoded
+// once the type is known, see protocol.go.
 type IncomingMessage struct {
-	Type    MessageType           `json:"type"`
-	Payload IncomingMessagePayload `json:"payload"`
+	Type    MessageType `json:"type"`
+	Payload RawPayload  `json:"payload"`
+}
+
+// RawPayload is an undecoded payload, in the encoding of the connection it
+// was read from
+type RawPayload []byte
+
+// MarshalJSON returns the payload as is
+func (p RawPayload) MarshalJSON() ([]byte, error) {
+	if p == nil {
+		return []byte("null"), nil
+	}
+	return p, nil
+}
+
+// UnmarshalJSON keeps a copy of the payload
+func (p *RawPayload) UnmarshalJSON(data []byte) error {
+	*p = append((*p)[0:0], data...)
+	return nil
 }
 
-// IncomingMessagePayload represents the payload of incoming message
-type IncomingMessagePayload struct {
-	SpaceID     string `json:"spaceId,omitempty"`
-	Token       string `json:"token,omitempty"`
-	DisplayName string `json:"displayName,omitempty"`
-	X           int    `json:"x,omitempty"`
-	Y           int    `json:"y,omitempty"`
-	Message     string `json:"message,omitempty"`
+// EncodeMsgpack writes the payload as is
+func (p RawPayload) EncodeMsgpack(enc *msgpack.Encoder) error {
+	if p == nil {
+		return enc.EncodeNil()
+	}
+	return enc.Encode(msgpack.RawMessage(p))
+}
+
+// DecodeMsgpack keeps a copy of the encoded payload
+func (p *RawPayload) DecodeMsgpack(dec *msgpack.Decoder) error {
+	raw, err := dec.DecodeRaw()
+	if err != nil {
+		return err
+	}
+	*p = append((*p)[0:0], raw...)
+	return nil
 }
 
 // OutgoingMessage represents a message to client
@@ -38,17 +112,27 @@ type OutgoingMessage struct {
 
 // SpaceJoinedPayload represents the payload when user joins a space
 type SpaceJoinedPayload struct {
+	// SpaceID tells clients which space they are in after taking a portal
+	SpaceID  string        `json:"spaceId"`
 	Spawn    SpawnPoint    `json:"spawn"`
 	Users    []UserInfo    `json:"users"`
 	Messages []ChatMessage `json:"messages"`
+
+	// ResumeToken lets the client reclaim its position after a reconnect
+	ResumeToken string `json:"resumeToken"`
+
+	ProtocolVersion int `json:"protocolVersion"`
 }
 
 // ChatMessage represents a chat history item
 type ChatMessage struct {
-	UserID    string `json:"userId"`
-	Username  string `json:"username"`
-	Message   string `json:"message"`
-	Timestamp string `json:"timestamp"`
+	ID        string           `json:"id"`
+	UserID    string           `json:"userId"`
+	Username  string           `json:"username"`
+	Message   string           `json:"message"`
+	Scope     models.ChatScope `json:"scope"`
+	Timestamp string           `json:"timestamp"`
+	EditedAt  string           `json:"editedAt,omitempty"`
 }
 
 // SpawnPoint represents a spawn position
@@ -87,7 +171,126 @@ type UserLeftPayload struct {
 
 // ChatPayload represents a chat message
 type ChatPayload struct {
+	ID       string           `json:"id,omitempty"`
+	UserID   string           `json:"userId"`
+	Username string           `json:"username"`
+	Message  string           `json:"message"`
+	Scope    models.ChatScope `json:"scope"`
+}
+
+// ProximityPayload represents a user entering or leaving proximity
+type ProximityPayload struct {
+	UserID   string `json:"userId"`
+	Username string `json:"username"`
+	X        int    `json:"x"`
+	Y        int    `json:"y"`
+}
+
+// RTCSignalPayload represents a relayed WebRTC offer, answer or ICE candidate
+type RTCSignalPayload struct {
+	FromUserID string        `json:"fromUserId"`
+	SDP        string        `json:"sdp,omitempty"`
+	Candidate  *ICECandidate `json:"candidate,omitempty"`
+}
+
+// ICECandidate is a WebRTC ICE candidate, as returned by RTCIceCandidate.toJSON()
+type ICECandidate struct {
+	Candidate        string  `json:"candidate"`
+	SDPMid           *string `json:"sdpMid,omitempty"`
+	SDPMLineIndex    *int    `json:"sdpMLineIndex,omitempty"`
+	UsernameFragment *string `json:"usernameFragment,omitempty"`
+}
+
+// RoomSnapshotPayload represents the movement of a room during one tick
+type RoomSnapshotPayload struct {
+	Tick  uint64            `json:"tick"`
+	Moves []MovementPayload `json:"moves"`
+}
+
+// ViewPayload represents a user entering or leaving the view radius
+type ViewPayload struct {
 	UserID   string `json:"userId"`
 	Username string `json:"username"`
+	X        int    `json:"x"`
+	Y        int    `json:"y"`
+}
+
+// ChatHistoryPayload represents a page of chat history, oldest first
+type ChatHistoryPayload struct {
+	Messages []ChatMessage `json:"messages"`
+	HasMore  bool          `json:"hasMore"`
+}
+
+// DirectMessagePayload represents a private message between two users
+type DirectMessagePayload struct {
+	ID           string `json:"id"`
+	FromUserID   string `json:"fromUserId"`
+	FromUsername string `json:"fromUsername"`
+	ToUserID     string `json:"toUserId"`
+	SpaceID      string `json:"spaceId,omitempty"`
+	Message      string `json:"message"`
+	Timestamp    string `json:"timestamp"`
+}
+
+// DirectMessageReadPayload is the read receipt for direct messages up to MessageID
+type DirectMessageReadPayload struct {
+	ReaderID  string `json:"readerId"`
+	SenderID  string `json:"senderId"`
+	MessageID string `json:"messageId"`
+	ReadAt    string `json:"readAt"`
+}
+
+// ChatEditedPayload announces the new text of a chat message
+type ChatEditedPayload struct {
+	ID       string `json:"id"`
+	UserID   string `json:"userId"`
 	Message  string `json:"message"`
+	EditedBy string `json:"editedBy"`
+	EditedAt string `json:"editedAt"`
+}
+
+// ChatDeletedPayload announces that a chat message was removed
+type ChatDeletedPayload struct {
+	ID        string `json:"id"`
+	DeletedBy string `json:"deletedBy"`
+}
+
+// ModerationPayload announces that a user was muted, unmuted or kicked
+type ModerationPayload struct {
+	UserID string `json:"userId"`
+	By     string `json:"by"`
+	Until  string `json:"until,omitempty"`
+}
+
+// ElementPayload describes an element added, moved or removed by an editor
+type ElementPayload struct {
+	ID       string        `json:"id"`
+	Element  ElementDetail `json:"element"`
+	X        int           `json:"x"`
+	Y        int           `json:"y"`
+	Rotation int           `json:"rotation"`
+	By       string        `json:"by"`
+}
+
+// SpaceDeletedPayload tells the users of a space that it was deleted
+type SpaceDeletedPayload struct {
+	SpaceID string `json:"spaceId"`
+}
+
+// ElementDetail describes the element placed in a space
+type ElementDetail struct {
+	ID       string `json:"id"`
+	ImageURL string `json:"imageUrl"`
+	Width    int    `json:"width"`
+	Height   int    `json:"height"`
+	Static   bool   `json:"static"`
+}
+
+// ZonePayload announces a user entering or leaving a zone
+type ZonePayload struct {
+	ZoneID       string `json:"zoneId"`
+	Name         string `json:"name"`
+	UserID       string `json:"userId"`
+	Occupancy    int    `json:"occupancy"`
+	MaxOccupancy int    `json:"maxOccupancy"`
 }
@@ -1,9 +1,11 @@
 package websocket
 
 import (
-	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/genosis18m/Metaverse_go/internal/database"
@@ -12,6 +14,10 @@ import (
 	"github.com/gorilla/websocket"
 )
 
+// maxMessageSize is the largest frame a client may send, which fits an SDP
+// offer with room to spare
+const maxMessageSize = 64 << 10
+
 // User represents a connected WebSocket user
 type User struct {
 	ID          string
@@ -23,27 +29,103 @@ type User struct {
 	X           int
 	Y           int
 	conn        *websocket.Conn
+	codec       Codec
+	queue       *sendQueue
 	mu          sync.Mutex
+
+	// resumeToken lets a reconnecting client reclaim this user, see session.go
+	resumeToken string
+
+	// spaceOwnerID is the creator of the space, who owns it without a membership
+	spaceOwnerID string
+
+	// zone is the zone the user stands in, see zone.go
+	zone *models.SpaceZone
+
+	// forgetPositions is set when the space does not remember where users left, see position.go
+	forgetPositions bool
+
+	// kicked is set when the space owner removed the user, see moderation.go
+	kicked atomic.Bool
+
+	// snapshots is set when the client wants movement batched into room-snapshot messages
+	snapshots bool
+
+	// nearby holds the users within proximity, guarded by the RoomManager lock
+	nearby map[string]*User
+
+	// visible holds the users within view radius, guarded by the RoomManager lock
+	visible map[string]*User
+
+	// remote users are connected to another node and reached through the backplane
+	remote bool
+	seenAt time.Time
 }
 
-// NewUser creates a new user from a WebSocket connection
+// NewUser creates a new user from a WebSocket connection, speaking the
+// encoding of the subprotocol negotiated during the upgrade
 func NewUser(conn *websocket.Conn) *User {
 	user := &User{
-		ID:   utils.GenerateRandomString(10),
-		X:    0,
-		Y:    0,
-		conn: conn,
+		ID:     utils.GenerateRandomString(10),
+		X:      0,
+		Y:      0,
+		conn:   conn,
+		codec:  CodecFor(conn.Subprotocol()),
+		queue:  newSendQueue(),
+		nearby: make(map[string]*User),
+
+		visible: make(map[string]*User),
 	}
 	return user
 }
 
+// newRemoteUser creates a placeholder for a user connected to another node
+func newRemoteUser(spaceID string, info *RemoteUser) *User {
+	return &User{
+		ID:       info.ID,
+		UserID:   info.UserID,
+		Username: info.Username,
+		SpaceID:  spaceID,
+		X:        info.X,
+		Y:        info.Y,
+		nearby:   make(map[string]*User),
+		visible:  make(map[string]*User),
+		remote:   true,
+	}
+}
+
+// remoteInfo describes the user for the other nodes
+func (u *User) remoteInfo() *RemoteUser {
+	return &RemoteUser{
+		ID:       u.ID,
+		UserID:   u.UserID,
+		Username: u.Username,
+		X:        u.X,
+		Y:        u.Y,
+	}
+}
+
 // HandleMessages listens for messages from the user
 func (u *User) HandleMessages() {
 	defer func() {
-		u.Destroy()
-		u.conn.Close()
+		u.close()
+		// Keep the user in its room for a while so the client can resume
+		if !GetRoomManager().Detach(u) {
+			u.Destroy()
+		}
 	}()
 
+	// Bound the work a single frame can cause in either decoder
+	u.conn.SetReadLimit(maxMessageSize)
+
+	// Drop half-open connections that stop answering pings
+	u.conn.SetReadDeadline(time.Now().Add(PongTimeout))
+	u.conn.SetPongHandler(func(string) error {
+		return u.conn.SetReadDeadline(time.Now().Add(PongTimeout))
+	})
+
+	go u.writePump()
+
 	for {
 		_, message, err := u.conn.ReadMessage()
 		if err != nil {
@@ -52,8 +134,11 @@ func (u *User) HandleMessages() {
 		}
 
 		var incomingMsg IncomingMessage
-		if err := json.Unmarshal(message, &incomingMsg); err != nil {
+		if err := u.codec.Unmarshal(message, &incomingMsg); err != nil {
 			log.Printf("Error parsing message: %v", err)
+			if u.allowInvalid("") {
+				u.sendError(ErrInvalidMessage, "message could not be parsed", "")
+			}
 			continue
 		}
 
@@ -61,41 +146,174 @@ func (u *User) HandleMessages() {
 	}
 }
 
-// processMessage handles different message types
+// processMessage decodes the payload of a message and dispatches it by type
 func (u *User) processMessage(msg IncomingMessage) {
+	if msg.Type == TypeJoin {
+		if !u.allow(msg.Type) {
+			return
+		}
+		var payload JoinRequest
+		if u.decodePayload(msg, &payload) {
+			u.handleJoin(payload)
+		}
+		return
+	}
+
+	switch msg.Type {
+	case TypeMove, TypeChat, TypeChatHistory, TypeChatEdit, TypeChatDelete,
+		TypeDirectMessage, TypeDirectMessageRead, TypeMute, TypeUnmute, TypeKick,
+		TypeRTCOffer, TypeRTCAnswer, TypeRTCIceCandidate:
+	default:
+		if u.allowInvalid(msg.Type) {
+			u.sendError(ErrUnknownType, fmt.Sprintf("unknown message type %q", msg.Type), msg.Type)
+		}
+		return
+	}
+
+	// Everything but join needs a space
+	if u.SpaceID == "" {
+		u.sendError(ErrNotJoined, "join a space first", msg.Type)
+		return
+	}
+
+	if !u.allow(msg.Type) {
+		return
+	}
+
 	switch msg.Type {
-	case TypeJoin:
-		u.handleJoin(msg.Payload)
 	case TypeMove:
-		u.handleMove(msg.Payload)
+		var payload MoveRequest
+		if u.decodePayload(msg, &payload) {
+			u.handleMove(payload)
+		}
 	case TypeChat:
-		u.handleChat(msg.Payload)
+		var payload ChatRequest
+		if u.decodePayload(msg, &payload) {
+			u.handleChat(payload)
+		}
+	case TypeChatHistory:
+		var payload ChatHistoryRequest
+		if u.decodePayload(msg, &payload) {
+			u.handleChatHistory(payload)
+		}
+	case TypeChatEdit:
+		var payload ChatEditRequest
+		if u.decodePayload(msg, &payload) {
+			u.handleChatEdit(payload)
+		}
+	case TypeChatDelete:
+		var payload ChatDeleteRequest
+		if u.decodePayload(msg, &payload) {
+			u.handleChatDelete(payload)
+		}
+	case TypeMute:
+		var payload MuteRequest
+		if u.decodePayload(msg, &payload) {
+			u.handleMute(payload)
+		}
+	case TypeUnmute:
+		var payload MuteRequest
+		if u.decodePayload(msg, &payload) {
+			u.handleUnmute(payload)
+		}
+	case TypeKick:
+		var payload KickRequest
+		if u.decodePayload(msg, &payload) {
+			u.handleKick(payload)
+		}
+	case TypeDirectMessage:
+		var payload DirectMessageRequest
+		if u.decodePayload(msg, &payload) {
+			u.handleDirectMessage(payload)
+		}
+	case TypeDirectMessageRead:
+		var payload DirectMessageReadRequest
+		if u.decodePayload(msg, &payload) {
+			u.handleDirectMessageRead(payload)
+		}
+	case TypeRTCOffer, TypeRTCAnswer, TypeRTCIceCandidate:
+		var payload SignalRequest
+		if u.decodePayload(msg, &payload) {
+			u.handleSignal(msg.Type, payload)
+		}
 	}
 }
 
 // handleJoin handles user joining a space
-func (u *User) handleJoin(payload IncomingMessagePayload) {
+func (u *User) handleJoin(payload JoinRequest) {
 	spaceID := payload.SpaceID
 	token := payload.Token
 
+	if u.SpaceID != "" {
+		u.sendError(ErrAlreadyJoined, "already joined a space", TypeJoin)
+		return
+	}
+
+	// Clients that predate versioning speak version 1
+	version := payload.Version
+	if version == 0 {
+		version = 1
+	}
+	if version != ProtocolVersion {
+		u.fail(ErrUnsupportedVersion, fmt.Sprintf("protocol version %d is not supported, use %d", version, ProtocolVersion), TypeJoin)
+		return
+	}
+
 	// Validate JWT token
 	claims, err := utils.ValidateToken(token)
 	if err != nil {
 		log.Printf("Invalid token: %v", err)
-		u.conn.Close()
+		u.fail(ErrInvalidToken, "invalid or expired token", TypeJoin)
+		return
+	}
+	if database.IsTokenRevoked(claims) {
+		u.fail(ErrInvalidToken, "token has been revoked", TypeJoin)
+		return
+	}
+	if _, suspended, err := database.AccountStatus(claims.UserID); err == nil && suspended {
+		u.fail(ErrSuspended, "your account is suspended", TypeJoin)
 		return
 	}
 
 	u.UserID = claims.UserID
+	u.snapshots = payload.Snapshots
+
+	// Find space. Resuming needs access too, which may have been revoked
+	// or ended by a kick since the user disconnected.
+	var space models.Space
+	result := database.GetDB().First(&space, "id = ?", spaceID)
+	if result.Error != nil {
+		log.Printf("Space not found: %v", result.Error)
+		u.fail(ErrSpaceNotFound, "space not found", TypeJoin)
+		return
+	}
+	if !database.CanAccessSpace(space, u.UserID) {
+		u.fail(ErrForbidden, "you do not have access to this space", TypeJoin)
+		return
+	}
+	if kicked, err := database.IsKicked(spaceID, u.UserID); err != nil {
+		log.Printf("Error checking kick: %v", err)
+	} else if kicked {
+		u.fail(ErrKicked, "you were removed from this space", TypeJoin)
+		return
+	}
+
+	// Reclaim a recently disconnected user instead of joining again
+	if payload.ResumeToken != "" {
+		if old := GetRoomManager().Resume(payload.ResumeToken, u.UserID, spaceID); old != nil {
+			u.resume(old)
+			return
+		}
+	}
 
 	// Look up the username from the database
 	var dbUser models.User
 	if err := database.GetDB().First(&dbUser, "id = ?", u.UserID).Error; err != nil {
 		log.Printf("User not found: %v", err)
-		u.conn.Close()
+		u.fail(ErrUserNotFound, "user not found", TypeJoin)
 		return
 	}
-	
+
 	// Use displayName from payload if provided, otherwise use DB username
 	if payload.DisplayName != "" {
 		u.Username = payload.DisplayName
@@ -103,70 +321,35 @@ func (u *User) handleJoin(payload IncomingMessagePayload) {
 		u.Username = dbUser.Username
 	}
 
-	// Find space
-	var space models.Space
-	result := database.GetDB().First(&space, "id = ?", spaceID)
-	if result.Error != nil {
-		log.Printf("Space not found: %v", result.Error)
-		u.conn.Close()
-		return
-	}
-
 	u.SpaceID = spaceID
 	u.SpaceWidth = space.Width
 	u.SpaceHeight = space.Height
+	u.spaceOwnerID = space.CreatorID
 
-	// Add user to room
-	GetRoomManager().AddUser(spaceID, u)
+	// Load the static elements and zones of the space before anyone can move
+	GetRoomManager().EnsureGrid(spaceID, space.Width, space.Height)
+	GetRoomManager().EnsureZones(spaceID)
 
-	// Spawn at center of the space
-	u.X = space.Width / 2
-	u.Y = space.Height / 2
+	u.forgetPositions = space.ForgetPositions
 
-	// Get other users in the room
-	roomUsers := GetRoomManager().GetRoomUsers(spaceID)
-	userInfos := make([]UserInfo, 0)
-	for _, user := range roomUsers {
-		if user.ID != u.ID {
-			userInfos = append(userInfos, UserInfo{
-				UserID:   user.UserID,
-				Username: user.Username,
-				X:        user.X,
-				Y:        user.Y,
-			})
-		}
+	// Return to where the user left, else spawn on a free tile, preferring
+	// the spawn points of the space
+	if x, y, ok := u.lastPosition(space); ok {
+		u.X, u.Y = x, y
+	} else {
+		u.X, u.Y = GetRoomManager().PickSpawn(space)
 	}
 
-	// Fetch chat history (last 50 messages)
-	var messages []models.Message
-	database.GetDB().Where("space_id = ?", spaceID).Order("created_at desc").Limit(50).Find(&messages)
+	// Add user to room
+	GetRoomManager().AddUser(spaceID, u)
 
-	// Convert to ChatMessage struct (reverse order to show oldest first)
-	chatHistory := make([]ChatMessage, len(messages))
-	for i, msg := range messages {
-		// Look up username for each message
-		var msgUser models.User
-		username := msg.UserID // fallback to ID
-		if err := database.GetDB().First(&msgUser, "id = ?", msg.UserID).Error; err == nil {
-			username = msgUser.Username
-		}
-		chatHistory[len(messages)-1-i] = ChatMessage{
-			UserID:    msg.UserID,
-			Username:  username,
-			Message:   msg.Text,
-			Timestamp: msg.CreatedAt.Format(time.RFC3339),
-		}
-	}
+	u.announceJoin()
+}
 
-	// Send space-joined message to the user
-	u.Send(OutgoingMessage{
-		Type: TypeSpaceJoined,
-		Payload: SpaceJoinedPayload{
-			Spawn:    SpawnPoint{X: u.X, Y: u.Y},
-			Users:    userInfos,
-			Messages: chatHistory,
-		},
-	})
+// announceJoin sends the room state to a user that just entered its room
+// and tells everyone else
+func (u *User) announceJoin() {
+	u.sendSpaceJoined()
 
 	// Broadcast user-joined to other users
 	GetRoomManager().Broadcast(OutgoingMessage{
@@ -177,13 +360,49 @@ func (u *User) handleJoin(payload IncomingMessagePayload) {
 			X:        u.X,
 			Y:        u.Y,
 		},
-	}, u, spaceID)
+	}, u, u.SpaceID)
+
+	u.updateZone()
+	GetRoomManager().UpdateProximity(u)
+}
+
+// sendSpaceJoined sends the current room state and chat history to the user
+func (u *User) sendSpaceJoined() {
+	// Get other users in the room
+	userInfos := GetRoomManager().VisibleUsers(u)
+
+	// Fetch chat history (last 50 messages)
+	messages, _, err := database.ListMessages(u.SpaceID, database.MessageQuery{
+		Limit:    database.DefaultMessageLimit,
+		ViewerID: u.UserID,
+	})
+	if err != nil {
+		log.Printf("Error fetching chat history: %v", err)
+	}
+	chatHistory := toChatMessages(messages)
+
+	// A fresh resume token for every session
+	u.resumeToken = utils.GenerateRandomString(32)
+
+	// Send space-joined message to the user
+	u.Send(OutgoingMessage{
+		Type: TypeSpaceJoined,
+		Payload: SpaceJoinedPayload{
+			SpaceID:     u.SpaceID,
+			Spawn:       SpawnPoint{X: u.X, Y: u.Y},
+			Users:       userInfos,
+			Messages:    chatHistory,
+			ResumeToken: u.resumeToken,
+
+			ProtocolVersion: ProtocolVersion,
+		},
+	})
 }
 
 // handleMove handles user movement
-func (u *User) handleMove(payload IncomingMessagePayload) {
-	newX := payload.X
-	newY := payload.Y
+func (u *User) handleMove(payload MoveRequest) {
+	newX := *payload.X
+	newY := *payload.Y
 
 	// Check boundaries
 	if newX < 0 || newX >= u.SpaceWidth || newY < 0 || newY >= u.SpaceHeight {
@@ -200,14 +419,40 @@ func (u *User) handleMove(payload IncomingMessagePayload) {
 	yDisp := abs(u.Y - newY)
 
 	if (xDisp == 1 && yDisp == 0) || (xDisp == 0 && yDisp == 1) {
-		u.X = newX
-		u.Y = newY
+		// Reject movement into tiles covered by static elements or other users
+		if GetRoomManager().IsBlocked(u.SpaceID, newX, newY) || GetRoomManager().IsOccupied(u.SpaceID, newX, newY) {
+			u.Send(OutgoingMessage{
+				Type:    TypeMovementRejected,
+				Payload: MovementPayload{UserID: u.UserID, X: u.X, Y: u.Y},
+			})
+			return
+		}
+
+		// Reject movement into zones at their occupancy limit
+		if zone := GetRoomManager().ZoneAt(u.SpaceID, newX, newY); u.zoneIsFull(zone) {
+			u.sendError(ErrZoneFull, fmt.Sprintf("zone %q is full", zone.Name), TypeMove)
+			u.Send(OutgoingMessage{
+				Type:    TypeMovementRejected,
+				Payload: MovementPayload{UserID: u.UserID, X: u.X, Y: u.Y},
+			})
+			return
+		}
+
+		// Stepping onto a portal takes the user to another space
+		if portal := GetRoomManager().PortalAt(u.SpaceID, newX, newY); portal != nil && u.teleport(portal) {
+			return
+		}
+
+		GetRoomManager().MoveUser(u, newX, newY)
 
 		// Broadcast movement to other users with userId
 		GetRoomManager().Broadcast(OutgoingMessage{
 			Type:    TypeMovement,
 			Payload: MovementPayload{UserID: u.UserID, X: u.X, Y: u.Y},
 		}, u, u.SpaceID)
+
+		u.updateZone()
+		GetRoomManager().UpdateProximity(u)
 		return
 	}
 
@@ -218,47 +463,154 @@ func (u *User) handleMove(payload IncomingMessagePayload) {
 	})
 }
 
-// handleChat handles chat messages
-func (u *User) handleChat(payload IncomingMessagePayload) {
-	if u.SpaceID == "" {
+// handleChat handles chat messages. Room chat reaches the whole space,
+// nearby chat the users within ChatRadius of the sender, and zone chat the
+// users in the sender's zone. Chat sent inside a private-chat zone stays in it.
+func (u *User) handleChat(payload ChatRequest) {
+	zone := u.zone
+	if zone != nil && zone.Muted {
+		u.sendError(ErrMuted, fmt.Sprintf("chat is muted in zone %q", zone.Name), TypeChat)
 		return
 	}
+	if zone != nil && zone.PrivateChat {
+		payload.Scope = models.ChatScopeZone
+	}
+	if payload.Scope == models.ChatScopeZone && zone == nil {
+		u.sendError(ErrInvalidPayload, "zone chat requires standing in a zone", TypeChat)
+		return
+	}
+
+	if muted, err := database.IsMuted(u.SpaceID, u.UserID); err != nil {
+		log.Printf("Error checking mute: %v", err)
+	} else if muted {
+		u.sendError(ErrMuted, "you are muted in this space", TypeChat)
+		return
+	}
+	if !GetRoomManager().AllowChat(u.SpaceID) {
+		u.rateLimited(TypeChat, "this space is receiving too many messages")
+		return
+	}
+
+	text, err := u.moderate(payload.Message)
+	if err != nil {
+		u.sendError(ErrMessageRejected, err.Error(), TypeChat)
+		return
+	}
+
+	// Scoped messages go to whoever is in range now, sender included
+	var recipients []*User
+	switch payload.Scope {
+	case models.ChatScopeNearby:
+		recipients = GetRoomManager().UsersWithin(u.SpaceID, u.X, u.Y, ChatRadius)
+	case models.ChatScopeZone:
+		recipients = GetRoomManager().ZoneMembers(u.SpaceID, zone.ID)
+	}
 
 	// Save message to database
 	msg := models.Message{
 		ID:        utils.GenerateCUID(),
-		Text:      payload.Message,
+		Text:      text,
 		UserID:    u.UserID,
 		SpaceID:   u.SpaceID,
+		Scope:     payload.Scope,
 		CreatedAt: time.Now(),
 	}
+	seen := map[string]bool{u.UserID: true}
+	for _, r := range recipients {
+		if !seen[r.UserID] {
+			seen[r.UserID] = true
+			msg.Recipients = append(msg.Recipients, models.MessageRecipient{UserID: r.UserID})
+		}
+	}
 	database.GetDB().Create(&msg)
 
-	// Broadcast chat message to all users in the room (including sender)
-	GetRoomManager().Broadcast(OutgoingMessage{
+	out := OutgoingMessage{
 		Type: TypeChat,
 		Payload: ChatPayload{
+			ID:       msg.ID,
 			UserID:   u.UserID,
 			Username: u.Username,
-			Message:  payload.Message,
+			Message:  text,
+			Scope:    payload.Scope,
 		},
-	}, nil, u.SpaceID) // Pass nil as sender to broadcast to EVERYONE including self
+	}
+	if payload.Scope == models.ChatScopeRoom {
+		// Broadcast chat message to all users in the room (including sender)
+		GetRoomManager().Broadcast(out, nil, u.SpaceID) // Pass nil as sender to broadcast to EVERYONE including self
+		return
+	}
+	for _, r := range recipients {
+		r.Send(out)
+	}
 }
 
-// Send sends a message to the user
-func (u *User) Send(msg OutgoingMessage) {
-	u.mu.Lock()
-	defer u.mu.Unlock()
-
-	data, err := json.Marshal(msg)
+// handleChatHistory sends a page of older or newer chat messages
+func (u *User) handleChatHistory(payload ChatHistoryRequest) {
+	messages, hasMore, err := database.ListMessages(u.SpaceID, database.MessageQuery{
+		Before:   payload.Before,
+		After:    payload.After,
+		Search:   payload.Query,
+		Limit:    payload.Limit,
+		ViewerID: u.UserID,
+	})
+	if errors.Is(err, database.ErrCursorNotFound) {
+		u.sendError(ErrInvalidPayload, "cursor message not found", TypeChatHistory)
+		return
+	}
 	if err != nil {
-		log.Printf("Error marshaling message: %v", err)
+		log.Printf("Error fetching chat history: %v", err)
+		u.sendError(ErrInternal, "could not fetch chat history", TypeChatHistory)
 		return
 	}
 
-	if err := u.conn.WriteMessage(websocket.TextMessage, data); err != nil {
-		log.Printf("Error sending message: %v", err)
+	u.Send(OutgoingMessage{
+		Type: TypeChatHistory,
+		Payload: ChatHistoryPayload{
+			Messages: toChatMessages(messages),
+			HasMore:  hasMore,
+		},
+	})
+}
+
+// toChatMessages converts stored messages, oldest first, to chat history items
+func toChatMessages(messages []models.Message) []ChatMessage {
+	history := make([]ChatMessage, len(messages))
+	for i, msg := range messages {
+		username := msg.User.Username
+		if username == "" {
+			username = msg.UserID // fallback to ID
+		}
+		history[i] = ChatMessage{
+			ID:        msg.ID,
+			UserID:    msg.UserID,
+			Username:  username,
+			Message:   msg.Text,
+			Scope:     msg.Scope,
+			Timestamp: msg.CreatedAt.Format(time.RFC3339),
+		}
+		if msg.EditedAt != nil {
+			history[i].EditedAt = msg.EditedAt.Format(time.RFC3339)
+		}
 	}
+	return history
+}
+
+// handleSignal relays a WebRTC offer, answer or ICE candidate to another user in the space
+func (u *User) handleSignal(msgType MessageType, payload SignalRequest) {
+	target := GetRoomManager().FindUser(u.SpaceID, payload.TargetUserID)
+	if target == nil {
+		u.sendError(ErrTargetNotFound, "target user is not in this space", msgType)
+		return
+	}
+
+	target.Send(OutgoingMessage{
+		Type: msgType,
+		Payload: RTCSignalPayload{
+			FromUserID: u.UserID,
+			SDP:        payload.SDP,
+			Candidate:  payload.Candidate,
+		},
+	})
 }
 
 // Destroy cleans up when user disconnects
@@ -267,12 +619,17 @@ func (u *User) Destroy() {
 		return
 	}
 
+	u.rememberPosition()
+	u.leaveZone()
+
 	// Broadcast user-left to other users
 	GetRoomManager().Broadcast(OutgoingMessage{
 		Type:    TypeUserLeft,
 		Payload: UserLeftPayload{UserID: u.UserID},
 	}, u, u.SpaceID)
 
+	GetRoomManager().ClearProximity(u)
+
 	// Remove user from room
 	GetRoomManager().RemoveUser(u, u.SpaceID)
 }
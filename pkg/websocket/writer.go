@@ -0,0 +1,293 @@
+package websocket
+
+import (
+	"encoding/json"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// MovementPolicy decides what happens to movement messages when a send queue is full
+type MovementPolicy string
+
+const (
+	// MovementDrop discards movement messages that do not fit in the queue
+	MovementDrop MovementPolicy = "drop"
+	// MovementCoalesce keeps only the latest position of each user until the queue drains
+	MovementCoalesce MovementPolicy = "coalesce"
+)
+
+// Send queue settings, configurable through the environment
+var (
+	SendQueueSize     = 256
+	WriteTimeout      = 10 * time.Second
+	SlowClientTimeout = 5 * time.Second
+	MovementOverflow  = MovementCoalesce
+)
+
+// sendQueue is the bounded outbound buffer of a connection
+type sendQueue struct {
+	messages chan OutgoingMessage
+	wake     chan struct{}
+	done     chan struct{}
+	once     sync.Once
+
+	mu sync.Mutex
+	// Messages that did not fit in the queue, sent in order once it drains.
+	// Messages describing current state are coalesced under a shared key so
+	// only the latest is kept; others get a key of their own.
+	pending      map[string]OutgoingMessage
+	pendingOrder []string
+	// pendingSeq counts the overflowed messages that could not be coalesced
+	pendingSeq int
+	fullSince  time.Time
+	// closing is set once the connection should close after the queue drains
+	closing bool
+}
+
+func newSendQueue() *sendQueue {
+	return &sendQueue{
+		messages: make(chan OutgoingMessage, SendQueueSize),
+		wake:     make(chan struct{}, 1),
+		done:     make(chan struct{}),
+		pending:  make(map[string]OutgoingMessage),
+	}
+}
+
+// Send queues a message for the user without blocking the caller
+func (u *User) Send(msg OutgoingMessage) {
+	if u.remote {
+		GetRoomManager().sendRemote(u, msg)
+		return
+	}
+
+	q := u.queue
+	select {
+	case <-q.done:
+		return
+	default:
+	}
+
+	q.mu.Lock()
+	// Once messages overflowed, new ones wait behind them to keep the order
+	if len(q.pendingOrder) == 0 {
+		select {
+		case q.messages <- msg:
+			q.fullSince = time.Time{}
+			q.mu.Unlock()
+			return
+		default:
+		}
+	}
+
+	// The queue is full. Clients get SlowClientTimeout to catch up, and room
+	// for a queue's worth of messages that cannot be coalesced, before they
+	// are disconnected.
+	if q.fullSince.IsZero() {
+		q.fullSince = time.Now()
+	}
+	stalled := time.Since(q.fullSince) > SlowClientTimeout || q.pendingSeq >= SendQueueSize
+	if !stalled {
+		q.overflow(msg)
+	}
+	q.mu.Unlock()
+
+	if stalled {
+		log.Printf("Send queue stalled for user %s, disconnecting", u.UserID)
+		u.close()
+		return
+	}
+
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// overflow keeps a message that did not fit in the queue. The caller must
+// hold the lock.
+func (q *sendQueue) overflow(msg OutgoingMessage) {
+	key, coalesce := coalesceKey(msg)
+	if !coalesce {
+		q.pendingSeq++
+		key = "#" + strconv.Itoa(q.pendingSeq)
+	} else if msg.Type == TypeMovement && MovementOverflow == MovementDrop {
+		return
+	}
+
+	previous, exists := q.pending[key]
+	if !exists {
+		q.pendingOrder = append(q.pendingOrder, key)
+	} else if msg.Type == TypeRoomSnapshot {
+		msg = mergeSnapshots(previous, msg)
+	}
+	q.pending[key] = msg
+}
+
+// coalesceKey returns the key of messages where only the latest matters: the
+// position of a user, whether another user is in proximity, in view or in a
+// zone, and room snapshots, which are merged
+func coalesceKey(msg OutgoingMessage) (string, bool) {
+	switch msg.Type {
+	case TypeMovement:
+		move, _ := decodeMovement(msg)
+		return "move:" + move.UserID, true
+	case TypeRoomSnapshot:
+		return "snapshot", true
+	case TypeProximityEnter, TypeProximityLeave:
+		return "proximity:" + payloadField(msg.Payload, "userId"), true
+	case TypeUserEnteredView, TypeUserExitedView:
+		return "view:" + payloadField(msg.Payload, "userId"), true
+	case TypeZoneEnter, TypeZoneLeave:
+		return "zone:" + payloadField(msg.Payload, "zoneId") + ":" + payloadField(msg.Payload, "userId"), true
+	}
+	return "", false
+}
+
+// payloadField reads a string field of a payload, which is a struct when the
+// message was created locally and a decoded JSON object when it was relayed
+// through the backplane
+func payloadField(payload interface{}, field string) string {
+	fields, ok := payload.(map[string]interface{})
+	if !ok {
+		data, err := json.Marshal(payload)
+		if err != nil || json.Unmarshal(data, &fields) != nil {
+			return ""
+		}
+	}
+	value, _ := fields[field].(string)
+	return value
+}
+
+// mergeSnapshots combines two room snapshots, keeping the latest move of each user
+func mergeSnapshots(older, newer OutgoingMessage) OutgoingMessage {
+	a, okA := older.Payload.(RoomSnapshotPayload)
+	b, okB := newer.Payload.(RoomSnapshotPayload)
+	if !okA || !okB {
+		return newer
+	}
+
+	merged := RoomSnapshotPayload{Tick: b.Tick, Moves: make([]MovementPayload, 0, len(a.Moves)+len(b.Moves))}
+	index := make(map[string]int, len(a.Moves)+len(b.Moves))
+	for _, moves := range [][]MovementPayload{a.Moves, b.Moves} {
+		for _, move := range moves {
+			if i, exists := index[move.UserID]; exists {
+				merged.Moves[i] = move
+				continue
+			}
+			index[move.UserID] = len(merged.Moves)
+			merged.Moves = append(merged.Moves, move)
+		}
+	}
+	return OutgoingMessage{Type: TypeRoomSnapshot, Payload: merged}
+}
+
+// writePump drains the send queue into the connection
+func (u *User) writePump() {
+	q := u.queue
+	ping := time.NewTicker(PingInterval)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-q.done:
+			return
+		case <-ping.C:
+			if err := u.ping(); err != nil {
+				log.Printf("Error sending ping: %v", err)
+				u.close()
+				return
+			}
+			continue
+		case msg := <-q.messages:
+			if err := u.write(msg); err != nil {
+				log.Printf("Error sending message: %v", err)
+				u.close()
+				return
+			}
+		case <-q.wake:
+		}
+
+		// Flush the overflow once the queue has drained
+		if len(q.messages) > 0 {
+			continue
+		}
+		q.mu.Lock()
+		pending := make([]OutgoingMessage, 0, len(q.pendingOrder))
+		for _, key := range q.pendingOrder {
+			pending = append(pending, q.pending[key])
+		}
+		q.pending = make(map[string]OutgoingMessage)
+		q.pendingOrder = nil
+		q.pendingSeq = 0
+		q.fullSince = time.Time{}
+		closing := q.closing
+		q.mu.Unlock()
+
+		for _, msg := range pending {
+			if err := u.write(msg); err != nil {
+				log.Printf("Error sending message: %v", err)
+				u.close()
+				return
+			}
+		}
+
+		// The overflow, which holds the final error when the queue was
+		// full, goes out before the close frame
+		if closing {
+			u.mu.Lock()
+			u.conn.WriteControl(websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.ClosePolicyViolation, ""),
+				time.Now().Add(WriteTimeout))
+			u.mu.Unlock()
+			u.close()
+			return
+		}
+	}
+}
+
+// write encodes a message and writes it to the connection with a deadline
+func (u *User) write(msg OutgoingMessage) error {
+	data, err := u.codec.Marshal(msg)
+	if err != nil {
+		log.Printf("Error marshaling message: %v", err)
+		return nil
+	}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.conn.SetWriteDeadline(time.Now().Add(WriteTimeout))
+	return u.conn.WriteMessage(u.codec.FrameType(), data)
+}
+
+// ping sends a keepalive ping to the client
+func (u *User) ping() error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	return u.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(WriteTimeout))
+}
+
+// closeAfterFlush closes the connection once everything queued so far was sent
+func (u *User) closeAfterFlush() {
+	u.queue.mu.Lock()
+	u.queue.closing = true
+	u.queue.mu.Unlock()
+
+	select {
+	case u.queue.wake <- struct{}{}:
+	default:
+	}
+}
+
+// close stops the writer and closes the connection, which ends HandleMessages
+func (u *User) close() {
+	u.queue.once.Do(func() {
+		close(u.queue.done)
+		u.conn.Close()
+	})
+}
@@ -0,0 +1,145 @@
+package websocket
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// withQueueSize shrinks the send queue of users created during a test
+func withQueueSize(t *testing.T, size int) {
+	t.Helper()
+	saved := SendQueueSize
+	SendQueueSize = size
+	t.Cleanup(func() { SendQueueSize = saved })
+}
+
+func isClosed(u *User) bool {
+	select {
+	case <-u.queue.done:
+		return true
+	default:
+		return false
+	}
+}
+
+func chat(text string) OutgoingMessage {
+	return OutgoingMessage{Type: TypeChat, Payload: ChatPayload{Message: text}}
+}
+
+func TestSendCoalescesStateWhenQueueIsFull(t *testing.T) {
+	withQueueSize(t, 2)
+	user, _ := newTestUser(t, "")
+
+	user.Send(chat("fills"))
+	user.Send(chat("the queue"))
+	user.Send(OutgoingMessage{Type: TypeRoomSnapshot, Payload: RoomSnapshotPayload{Tick: 1, Moves: []MovementPayload{
+		{UserID: "a", X: 1, Y: 1}, {UserID: "b", X: 2, Y: 2},
+	}}})
+	user.Send(OutgoingMessage{Type: TypeProximityEnter, Payload: ProximityPayload{UserID: "a"}})
+	user.Send(chat("overflows"))
+	user.Send(OutgoingMessage{Type: TypeRoomSnapshot, Payload: RoomSnapshotPayload{Tick: 2, Moves: []MovementPayload{
+		{UserID: "a", X: 3, Y: 3},
+	}}})
+	// Relayed through the backplane, so the payload is a decoded JSON object
+	user.Send(OutgoingMessage{Type: TypeProximityLeave, Payload: map[string]interface{}{"userId": "a"}})
+
+	if isClosed(user) {
+		t.Fatal("a burst of overflowing messages disconnected the client")
+	}
+
+	q := user.queue
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.pendingOrder) != 3 {
+		t.Fatalf("pending = %v, want snapshot, proximity and chat", q.pendingOrder)
+	}
+	snapshot := q.pending[q.pendingOrder[0]].Payload.(RoomSnapshotPayload)
+	if snapshot.Tick != 2 || len(snapshot.Moves) != 2 || snapshot.Moves[0] != (MovementPayload{UserID: "a", X: 3, Y: 3}) {
+		t.Fatalf("merged snapshot = %+v", snapshot)
+	}
+	if proximity := q.pending[q.pendingOrder[1]]; proximity.Type != TypeProximityLeave {
+		t.Fatalf("proximity = %+v, want the latest event", proximity)
+	}
+	if msg := q.pending[q.pendingOrder[2]]; msg.Type != TypeChat {
+		t.Fatalf("chat = %+v", msg)
+	}
+}
+
+func TestSendDisconnectsClientThatStaysFull(t *testing.T) {
+	withQueueSize(t, 2)
+	user, _ := newTestUser(t, "")
+
+	user.Send(chat("fills"))
+	user.Send(chat("the queue"))
+	user.Send(chat("overflows"))
+	if isClosed(user) {
+		t.Fatal("disconnected before the grace period")
+	}
+
+	user.queue.mu.Lock()
+	user.queue.fullSince = time.Now().Add(-SlowClientTimeout - time.Second)
+	user.queue.mu.Unlock()
+	user.Send(chat("still full"))
+	if !isClosed(user) {
+		t.Fatal("a client full for longer than the grace period was kept")
+	}
+}
+
+func TestWritePumpFlushesOverflowInOrder(t *testing.T) {
+	withQueueSize(t, 2)
+	user, client := newTestUser(t, "")
+
+	for _, text := range []string{"one", "two", "three"} {
+		user.Send(chat(text))
+	}
+	go user.writePump()
+
+	for _, want := range []string{"one", "two", "three"} {
+		client.SetReadDeadline(time.Now().Add(5 * time.Second))
+		var msg struct {
+			Type    MessageType `json:"type"`
+			Payload ChatPayload `json:"payload"`
+		}
+		if err := client.ReadJSON(&msg); err != nil {
+			t.Fatal(err)
+		}
+		if msg.Payload.Message != want {
+			t.Fatalf("got %q, want %q", msg.Payload.Message, want)
+		}
+	}
+}
+
+func TestFailSendsErrorBeforeClosingWhenQueueIsFull(t *testing.T) {
+	withQueueSize(t, 2)
+	user, client := newTestUser(t, "")
+
+	user.Send(chat("one"))
+	user.Send(chat("two"))
+	user.fail(ErrRateLimited, "too many violations", TypeChat)
+	go user.writePump()
+
+	var got []MessageType
+	for {
+		client.SetReadDeadline(time.Now().Add(5 * time.Second))
+		var msg struct {
+			Type    MessageType  `json:"type"`
+			Payload ErrorPayload `json:"payload"`
+		}
+		err := client.ReadJSON(&msg)
+		if websocket.IsCloseError(err, websocket.ClosePolicyViolation) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("after %v: %v", got, err)
+		}
+		got = append(got, msg.Type)
+		if msg.Type == TypeError && msg.Payload.Code != ErrRateLimited {
+			t.Fatalf("error code %q, want %q", msg.Payload.Code, ErrRateLimited)
+		}
+	}
+	if len(got) != 3 || got[2] != TypeError {
+		t.Fatalf("got %v before the close frame, want two chats and an error", got)
+	}
+}
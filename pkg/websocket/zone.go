@@ -0,0 +1,152 @@
+package websocket
+
+import (
+	"log"
+
+	"github.com/genosis18m/Metaverse_go/internal/database"
+	"github.com/genosis18m/Metaverse_go/internal/models"
+)
+
+// LoadZones loads the zones of a space, oldest first. Where zones overlap the
+// oldest one wins.
+func LoadZones(spaceID string) ([]*models.SpaceZone, error) {
+	var zones []*models.SpaceZone
+	err := database.GetDB().Where("space_id = ?", spaceID).Order("created_at asc").Find(&zones).Error
+	return zones, err
+}
+
+// EnsureZones loads the zones of a space if they are not loaded yet
+func (rm *RoomManager) EnsureZones(spaceID string) {
+	rm.mu.RLock()
+	_, loaded := rm.zones[spaceID]
+	rm.mu.RUnlock()
+	if loaded {
+		return
+	}
+
+	zones, err := LoadZones(spaceID)
+	if err != nil {
+		log.Printf("Error loading zones for space %s: %v", spaceID, err)
+	}
+
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	if _, loaded := rm.zones[spaceID]; !loaded {
+		rm.zones[spaceID] = zones
+	}
+}
+
+// RefreshZones reloads the zones of a space that has users in it. Users pick
+// up their new zone on their next move.
+func (rm *RoomManager) RefreshZones(spaceID string) {
+	rm.mu.RLock()
+	_, loaded := rm.zones[spaceID]
+	rm.mu.RUnlock()
+	if !loaded {
+		return
+	}
+
+	zones, err := LoadZones(spaceID)
+	if err != nil {
+		log.Printf("Error refreshing zones for space %s: %v", spaceID, err)
+		return
+	}
+
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+	if _, loaded := rm.zones[spaceID]; loaded {
+		rm.zones[spaceID] = zones
+	}
+}
+
+// ZoneAt returns the zone covering a tile, or nil
+func (rm *RoomManager) ZoneAt(spaceID string, x, y int) *models.SpaceZone {
+	rm.mu.RLock()
+	defer rm.mu.RUnlock()
+	return rm.zoneAt(spaceID, x, y)
+}
+
+// zoneAt returns the zone covering a tile. The caller must hold the lock.
+func (rm *RoomManager) zoneAt(spaceID string, x, y int) *models.SpaceZone {
+	for _, zone := range rm.zones[spaceID] {
+		if zone.Contains(x, y) {
+			return zone
+		}
+	}
+	return nil
+}
+
+// ZoneMembers returns the local and remote users standing in a zone
+func (rm *RoomManager) ZoneMembers(spaceID, zoneID string) []*User {
+	rm.mu.RLock()
+	defer rm.mu.RUnlock()
+
+	users := make([]*User, 0)
+	for _, user := range rm.members(spaceID) {
+		if zone := rm.zoneAt(spaceID, user.X, user.Y); zone != nil && zone.ID == zoneID {
+			users = append(users, user)
+		}
+	}
+	return users
+}
+
+// zoneIsFull reports whether a zone the user is not in yet has no room left
+func (u *User) zoneIsFull(zone *models.SpaceZone) bool {
+	if zone == nil || zone.MaxOccupancy <= 0 || (u.zone != nil && u.zone.ID == zone.ID) {
+		return false
+	}
+	return len(GetRoomManager().ZoneMembers(u.SpaceID, zone.ID)) >= zone.MaxOccupancy
+}
+
+// updateZone moves the user into the zone at its position and tells the room
+// about the zones it left and entered
+func (u *User) updateZone() {
+	rm := GetRoomManager()
+	zone := rm.ZoneAt(u.SpaceID, u.X, u.Y)
+
+	old := u.zone
+	if old != nil && zone != nil && old.ID == zone.ID {
+		u.zone = zone
+		return
+	}
+	u.zone = zone
+
+	if old != nil {
+		u.broadcastZone(TypeZoneLeave, old)
+	}
+	if zone != nil {
+		u.broadcastZone(TypeZoneEnter, zone)
+	}
+}
+
+// leaveZone tells the room the user left its zone when it leaves the space
+func (u *User) leaveZone() {
+	if u.zone == nil {
+		return
+	}
+	zone := u.zone
+	u.zone = nil
+	u.broadcastZone(TypeZoneLeave, zone)
+}
+
+// broadcastZone sends a zone-enter or zone-leave event with the zone's new occupancy
+func (u *User) broadcastZone(msgType MessageType, zone *models.SpaceZone) {
+	rm := GetRoomManager()
+	occupancy := 0
+	for _, user := range rm.ZoneMembers(u.SpaceID, zone.ID) {
+		if msgType == TypeZoneEnter || user.ID != u.ID {
+			occupancy++
+		}
+	}
+
+	rm.Broadcast(OutgoingMessage{
+		Type: msgType,
+		Payload: ZonePayload{
+			ZoneID:       zone.ID,
+			Name:         zone.Name,
+			UserID:       u.UserID,
+			Occupancy:    occupancy,
+			MaxOccupancy: zone.MaxOccupancy,
+		},
+	}, nil, u.SpaceID)
+}
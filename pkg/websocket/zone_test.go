@@ -0,0 +1,113 @@
+package websocket
+
+import (
+	"testing"
+
+	"github.com/genosis18m/Metaverse_go/internal/models"
+)
+
+// setTestZones replaces the loaded zones of a room
+func setTestZones(t *testing.T, rm *RoomManager, spaceID string, zones ...*models.SpaceZone) {
+	t.Helper()
+	rm.mu.Lock()
+	rm.zones[spaceID] = zones
+	rm.mu.Unlock()
+	t.Cleanup(func() {
+		rm.mu.Lock()
+		delete(rm.zones, spaceID)
+		rm.mu.Unlock()
+	})
+}
+
+// moveTo moves a test user one tile, as a move request would
+func moveTo(u *User, x, y int) {
+	u.handleMove(MoveRequest{X: intPtr(x), Y: intPtr(y)})
+}
+
+func TestZoneEnterAndLeave(t *testing.T) {
+	rm := GetRoomManager()
+	spaceID := "zone-" + t.Name()
+	alice := joinTestRoom(t, rm, spaceID, "alice", 4, 5)
+	bob := joinTestRoom(t, rm, spaceID, "bob", 0, 0)
+	booth := &models.SpaceZone{ID: "booth", Name: "Booth", Shape: models.ZoneShapeRect, X: 5, Y: 5, Width: 2, Height: 2}
+	setTestZones(t, rm, spaceID, booth)
+
+	moveTo(alice, 5, 5)
+	events := sentOfType(bob, TypeZoneEnter)
+	if len(events) != 1 {
+		t.Fatalf("bob got %d zone-enter events, want 1", len(events))
+	}
+	if payload := events[0].Payload.(ZonePayload); payload.ZoneID != "booth" || payload.UserID != "alice" || payload.Occupancy != 1 {
+		t.Fatalf("zone-enter = %+v, want alice entering the booth alone", payload)
+	}
+	if alice.zone == nil || alice.zone.ID != "booth" {
+		t.Fatalf("alice's zone = %+v, want the booth", alice.zone)
+	}
+
+	// Moving within the zone is not an event
+	moveTo(alice, 6, 5)
+	if got := append(sentOfType(bob, TypeZoneEnter), sentOfType(bob, TypeZoneLeave)...); len(got) != 0 {
+		t.Fatalf("a move inside the zone sent %v", got)
+	}
+
+	moveTo(alice, 6, 4)
+	events = sentOfType(bob, TypeZoneLeave)
+	if len(events) != 1 {
+		t.Fatalf("bob got %d zone-leave events, want 1", len(events))
+	}
+	if payload := events[0].Payload.(ZonePayload); payload.ZoneID != "booth" || payload.Occupancy != 0 {
+		t.Fatalf("zone-leave = %+v, want the booth left empty", payload)
+	}
+	if alice.zone != nil {
+		t.Fatalf("alice is still in zone %s", alice.zone.ID)
+	}
+}
+
+func TestFullZoneRejectsMoves(t *testing.T) {
+	rm := GetRoomManager()
+	spaceID := "zone-" + t.Name()
+	alice := joinTestRoom(t, rm, spaceID, "alice", 4, 5)
+	bob := joinTestRoom(t, rm, spaceID, "bob", 7, 5)
+	booth := &models.SpaceZone{ID: "booth", Name: "Booth", Shape: models.ZoneShapeRect, X: 5, Y: 5, Width: 2, Height: 2, MaxOccupancy: 1}
+	setTestZones(t, rm, spaceID, booth)
+
+	moveTo(alice, 5, 5)
+	sent(bob)
+
+	moveTo(bob, 6, 5)
+	if got := lastError(t, bob); got.Code != ErrZoneFull || got.RequestType != TypeMove {
+		t.Fatalf("error = %+v, want zone_full", got)
+	}
+	if bob.X != 7 || bob.Y != 5 || bob.zone != nil {
+		t.Fatalf("bob moved to (%d,%d) into a full zone", bob.X, bob.Y)
+	}
+
+	// Users already inside can keep moving around
+	moveTo(alice, 5, 6)
+	if alice.X != 5 || alice.Y != 6 {
+		t.Fatalf("alice is stuck at (%d,%d) inside the zone", alice.X, alice.Y)
+	}
+
+	// Once the zone empties there is room again
+	moveTo(alice, 5, 7)
+	moveTo(bob, 6, 5)
+	if bob.zone == nil || bob.zone.ID != "booth" {
+		t.Fatalf("bob could not enter the emptied zone: at (%d,%d)", bob.X, bob.Y)
+	}
+}
+
+func TestZoneMembersOnlyCountsUsersInside(t *testing.T) {
+	rm := newTestRoomManager()
+	joinTestRoom(t, rm, "space-1", "inside", 2, 2)
+	joinTestRoom(t, rm, "space-1", "outside", 9, 9)
+	triangle := &models.SpaceZone{ID: "triangle", Shape: models.ZoneShapePolygon, Points: []models.ZonePoint{{X: 0, Y: 0}, {X: 8, Y: 0}, {X: 0, Y: 8}}}
+	setTestZones(t, rm, "space-1", triangle)
+
+	members := rm.ZoneMembers("space-1", "triangle")
+	if len(members) != 1 || members[0].UserID != "inside" {
+		t.Fatalf("zone members = %v, want only the user inside", members)
+	}
+	if zone := rm.ZoneAt("space-1", 7, 7); zone != nil {
+		t.Fatalf("(7,7) lies in zone %s, want outside the triangle", zone.ID)
+	}
+}